@@ -11,12 +11,14 @@ import (
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"nearby-msg/api/internal/handler"
 	"nearby-msg/api/internal/infrastructure/auth"
+	"nearby-msg/api/internal/infrastructure/blobstore"
 	"nearby-msg/api/internal/infrastructure/database"
 	"nearby-msg/api/internal/infrastructure/logging"
 	"nearby-msg/api/internal/service"
@@ -24,6 +26,18 @@ import (
 	"github.com/joho/godotenv"
 )
 
+const (
+	defaultTombstoneHorizon      = 30 * 24 * time.Hour
+	defaultCompactionInterval    = time.Hour
+	defaultMessageEditWindow     = 15 * time.Minute
+	defaultAttachmentMaxBytes    = 10 << 20
+	defaultAttachmentDir         = "./data/attachments"
+	defaultSOSEscalationAfter    = 5 * time.Minute
+	defaultSOSEscalationRadius   = 2000
+	defaultSOSEscalationCooldown = 15 * time.Minute
+	defaultRateLimitCleanup      = 10 * time.Minute
+)
+
 func main() {
 	// Initialize structured logger
 	logging.Init()
@@ -59,45 +73,196 @@ func main() {
 	favoriteRepo := database.NewFavoriteRepository(dbPool)
 	statusRepo := database.NewStatusRepository(dbPool)
 	pinRepo := database.NewPinRepository(dbPool)
+	reactionRepo := database.NewReactionRepository(dbPool)
+	readMarkerRepo := database.NewReadMarkerRepository(dbPool)
+	attachmentRepo := database.NewAttachmentRepository(dbPool)
+	locationShareRepo := database.NewLocationShareRepository(dbPool)
+	sosIncidentRepo := database.NewSOSIncidentRepository(dbPool)
 	replicationRepo := database.NewReplicationRepository(dbPool)
+	groupBanRepo := database.NewGroupBanRepository(dbPool)
+	mutationRepo := database.NewMutationRepository(dbPool)
+
+	// Conflict strategies for stale updates: reject (default), lww (last writer by client timestamp) or merge (field-level)
+	groupConflictStrategy, err := service.ParseConflictStrategy(os.Getenv("CONFLICT_STRATEGY_GROUPS"))
+	if err != nil {
+		logger.Error("Invalid CONFLICT_STRATEGY_GROUPS", "error", err)
+		os.Exit(1)
+	}
+	statusConflictStrategy, err := service.ParseConflictStrategy(os.Getenv("CONFLICT_STRATEGY_USER_STATUS"))
+	if err != nil {
+		logger.Error("Invalid CONFLICT_STRATEGY_USER_STATUS", "error", err)
+		os.Exit(1)
+	}
+
+	// Tombstones (soft-deleted rows) are kept for TOMBSTONE_HORIZON, then purged every
+	// TOMBSTONE_COMPACTION_INTERVAL; a horizon of 0 keeps them forever
+	tombstoneHorizon, err := durationFromEnv("TOMBSTONE_HORIZON", defaultTombstoneHorizon)
+	if err != nil {
+		logger.Error("Invalid TOMBSTONE_HORIZON", "error", err)
+		os.Exit(1)
+	}
+	compactionInterval, err := durationFromEnv("TOMBSTONE_COMPACTION_INTERVAL", defaultCompactionInterval)
+	if err != nil || compactionInterval <= 0 {
+		logger.Error("Invalid TOMBSTONE_COMPACTION_INTERVAL", "error", err)
+		os.Exit(1)
+	}
+
+	// Authors may edit their messages for MESSAGE_EDIT_WINDOW after sending them
+	messageEditWindow, err := durationFromEnv("MESSAGE_EDIT_WINDOW", defaultMessageEditWindow)
+	if err != nil || messageEditWindow < 0 {
+		logger.Error("Invalid MESSAGE_EDIT_WINDOW", "error", err)
+		os.Exit(1)
+	}
+
+	// Attachment files go to ATTACHMENT_STORE: local (default, under ATTACHMENT_DIR) or s3
+	// (any S3-compatible service, e.g. MinIO); uploads are capped at ATTACHMENT_MAX_BYTES
+	blobStore, err := newBlobStore()
+	if err != nil {
+		logger.Error("Failed to initialize attachment store", "error", err)
+		os.Exit(1)
+	}
+	attachmentMaxBytes, err := int64FromEnv("ATTACHMENT_MAX_BYTES", defaultAttachmentMaxBytes)
+	if err != nil || attachmentMaxBytes <= 0 {
+		logger.Error("Invalid ATTACHMENT_MAX_BYTES", "error", err)
+		os.Exit(1)
+	}
+
+	// SOS incidents still open after SOS_ESCALATION_AFTER (0 disables escalation) are sent to the
+	// groups within SOS_ESCALATION_RADIUS meters; a group hears from the same origin group at most
+	// once per SOS_ESCALATION_COOLDOWN
+	sosEscalationAfter, err := durationFromEnv("SOS_ESCALATION_AFTER", defaultSOSEscalationAfter)
+	if err != nil || sosEscalationAfter < 0 {
+		logger.Error("Invalid SOS_ESCALATION_AFTER", "error", err)
+		os.Exit(1)
+	}
+	sosEscalationRadius, err := int64FromEnv("SOS_ESCALATION_RADIUS", defaultSOSEscalationRadius)
+	if err != nil || sosEscalationRadius <= 0 {
+		logger.Error("Invalid SOS_ESCALATION_RADIUS", "error", err)
+		os.Exit(1)
+	}
+	sosEscalationCooldown, err := durationFromEnv("SOS_ESCALATION_COOLDOWN", defaultSOSEscalationCooldown)
+	if err != nil || sosEscalationCooldown < 0 {
+		logger.Error("Invalid SOS_ESCALATION_COOLDOWN", "error", err)
+		os.Exit(1)
+	}
+
+	// Per-device rate limits, each written as <limit>/<window> (e.g. 10/1m) or off
+	rateLimits, err := rateLimitsFromEnv()
+	if err != nil {
+		logger.Error("Invalid rate limit", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize rate limiter
+	// RATE_LIMITER=postgres keeps the buckets in the database, so limits hold across replicas and restarts
+	var rateLimiter service.RateLimiter
+	switch os.Getenv("RATE_LIMITER") {
+	case "postgres":
+		postgresLimiter := service.NewPostgresRateLimiter(dbPool, database.NewRateLimitRepository(dbPool))
+		go postgresLimiter.RunCleanup(ctx, defaultRateLimitCleanup)
+		rateLimiter = postgresLimiter
+		logger.Info("Using PostgreSQL rate limiter")
+	default:
+		rateLimiter = service.NewInMemoryRateLimiter()
+	}
+	rateLimitPolicy := service.NewRateLimitPolicy(rateLimiter, rateLimits)
 
 	// Initialize services
+	accessPolicy := service.NewAccessPolicy(groupRepo, groupBanRepo)
 	deviceService := service.NewDeviceService(deviceRepo)
-	groupService := service.NewGroupService(groupRepo)
-	messageService := service.NewMessageService(messageRepo)
+	groupService := service.NewGroupService(groupRepo, groupConflictStrategy, rateLimitPolicy)
+	messageService := service.NewMessageService(messageRepo, accessPolicy, rateLimitPolicy, messageEditWindow)
 	favoriteService := service.NewFavoriteService(favoriteRepo)
-	statusService := service.NewStatusService(statusRepo)
-	pinService := service.NewPinService(pinRepo, messageRepo)
+	statusService := service.NewStatusService(statusRepo, statusConflictStrategy)
+	pinService := service.NewPinService(pinRepo, messageRepo, accessPolicy, rateLimitPolicy)
+	readMarkerService := service.NewReadMarkerService(readMarkerRepo, messageRepo, favoriteRepo, accessPolicy)
+	attachmentService := service.NewAttachmentService(attachmentRepo, blobStore, accessPolicy, attachmentMaxBytes)
+	locationService := service.NewLocationService(locationShareRepo, messageRepo, accessPolicy, rateLimitPolicy)
+	sosService := service.NewSOSService(sosIncidentRepo, groupRepo, accessPolicy)
+	reactionService := service.NewReactionService(reactionRepo, messageRepo, accessPolicy, sosService)
+	groupBanService := service.NewGroupBanService(groupRepo, groupBanRepo)
+
+	// Initialize cross-instance broadcaster and presence
+	// WS_BROADCASTER=postgres fans out WebSocket events to every replica via LISTEN/NOTIFY,
+	// and tracks presence in the database so it counts connections on every replica
+	var broadcaster service.Broadcaster
+	var presenceTracker service.PresenceTracker
+	var postgresPresence *service.PostgresPresenceTracker
+	switch os.Getenv("WS_BROADCASTER") {
+	case "postgres":
+		broadcaster = service.NewPostgresBroadcaster(database.NewNotifier(dbPool))
+		postgresPresence, err = service.NewPostgresPresenceTracker(database.NewPresenceRepository(dbPool))
+		if err != nil {
+			logger.Error("Failed to initialize presence tracker", "error", err)
+			os.Exit(1)
+		}
+		presenceTracker = postgresPresence
+		logger.Info("Using PostgreSQL broadcaster for WebSocket fan-out")
+	default:
+		broadcaster = service.NewInMemoryBroadcaster()
+		presenceTracker = service.NewInMemoryPresenceTracker()
+	}
 
 	// Initialize WebSocket service (needed by replication service for broadcasting)
-	wsService := service.NewWebSocketService(messageService, messageRepo, pinService)
+	wsService := service.NewWebSocketService(messageService, messageRepo, pinService, reactionService, readMarkerService, locationService, sosService, accessPolicy, broadcaster, presenceTracker)
+	if postgresPresence != nil {
+		go postgresPresence.Run(ctx, wsService.PresenceGone)
+	}
+	presenceService := service.NewPresenceService(wsService, deviceRepo, accessPolicy)
 
 	// Initialize Replication service (now with WebSocket dependency for broadcasting)
 	replicationService := service.NewReplicationService(
+		dbPool,
 		messageRepo,
 		groupRepo,
 		favoriteRepo,
 		pinRepo,
+		reactionRepo,
+		readMarkerRepo,
+		attachmentRepo,
 		statusRepo,
 		replicationRepo,
+		mutationRepo,
+		accessPolicy,
 		messageService,
 		groupService,
 		favoriteService,
 		statusService,
 		deviceService,
 		wsService,
+		tombstoneHorizon,
 	)
 
 	// Start WebSocket service hub
 	go wsService.Run(ctx)
 
+	// Start tombstone compaction
+	if tombstoneHorizon > 0 {
+		compactor := service.NewTombstoneCompactor(database.NewTombstoneRepository(dbPool), tombstoneHorizon, compactionInterval)
+		go compactor.Run(ctx)
+	}
+
+	// Announce live location shares that expired without being stopped
+	go locationService.RunExpiry(ctx, wsService.LocationShareEnded)
+
+	// Remove files of purged attachments and of uploads never sent
+	go attachmentService.RunCleanup(ctx, compactionInterval, tombstoneHorizon)
+
+	// Escalate SOS incidents nobody acknowledged to nearby groups
+	if sosEscalationAfter > 0 {
+		sosEscalationService := service.NewSOSEscalationService(dbPool, sosIncidentRepo, groupRepo, messageRepo, wsService, sosEscalationAfter, float64(sosEscalationRadius), sosEscalationCooldown)
+		go sosEscalationService.Run(ctx)
+	}
+
 	// Initialize handlers
 	deviceHandler := handler.NewDeviceHandler(deviceService)
-	groupHandler := handler.NewGroupHandler(groupService, favoriteService, statusService, pinService)
+	groupHandler := handler.NewGroupHandler(groupService, favoriteService, statusService, pinService, messageService, readMarkerService, presenceService, locationService, sosService, groupBanService, wsService)
 	replicationHandler := handler.NewReplicationHandler(replicationService)
 	statusHandler := handler.NewStatusHandler(statusService)
-	messageHandler := handler.NewMessageHandler(pinService)
+	messageHandler := handler.NewMessageHandler(pinService, messageService, reactionService, wsService)
 	wsHandler := handler.NewWebSocketHandler(wsService)
+	attachmentHandler := handler.NewAttachmentHandler(attachmentService)
+	sosHandler := handler.NewSOSHandler(sosService, wsService)
 
 	// Get port from environment or use default
 	port := os.Getenv("PORT")
@@ -147,16 +312,26 @@ func main() {
 	mux.Handle("/v1/groups/nearby", cors(errorHandler(http.HandlerFunc(groupHandler.GetNearbyGroups))))
 	mux.Handle("/v1/groups/suggest", cors(errorHandler(http.HandlerFunc(groupHandler.SuggestGroup))))
 	mux.Handle("/v1/groups", cors(errorHandler(auth.AuthMiddleware(http.HandlerFunc(groupHandler.CreateGroup)))))
+	mux.Handle("/v1/groups/unread", cors(errorHandler(auth.AuthMiddleware(http.HandlerFunc(groupHandler.GetUnreadCounts)))))
 	// Group and favorite routes (handler will route based on path and method)
 	mux.Handle("/v1/groups/", cors(errorHandler(auth.AuthMiddleware(http.HandlerFunc(groupHandler.HandleGroupRoutes)))))
 
 	// Replication routes
 	mux.Handle("/v1/replicate/push", cors(errorHandler(auth.AuthMiddleware(http.HandlerFunc(replicationHandler.Push)))))
 	mux.Handle("/v1/replicate/pull", cors(errorHandler(auth.AuthMiddleware(http.HandlerFunc(replicationHandler.Pull)))))
+	// SSE stream authenticates itself, since EventSource can't send an Authorization header
+	mux.Handle("/v1/replicate/stream", cors(errorHandler(http.HandlerFunc(replicationHandler.Stream))))
 
 	// Message routes (pin/unpin)
 	mux.Handle("/v1/messages/", cors(errorHandler(auth.AuthMiddleware(http.HandlerFunc(messageHandler.HandleMessageRoutes)))))
 
+	// Attachment routes (upload, metadata and file download)
+	mux.Handle("/v1/attachments", cors(errorHandler(auth.AuthMiddleware(http.HandlerFunc(attachmentHandler.Upload)))))
+	mux.Handle("/v1/attachments/", cors(errorHandler(auth.AuthMiddleware(http.HandlerFunc(attachmentHandler.HandleAttachmentRoutes)))))
+
+	// SOS incident routes (state changes and responders)
+	mux.Handle("/v1/sos/", cors(errorHandler(auth.AuthMiddleware(http.HandlerFunc(sosHandler.HandleSOSRoutes)))))
+
 	// Status routes
 	mux.Handle("/v1/status", cors(errorHandler(auth.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodPut {
@@ -206,6 +381,71 @@ func main() {
 	logger.Info("Server exited")
 }
 
+// durationFromEnv parses a duration (e.g. "720h") from an environment variable, or returns def if it is unset
+func durationFromEnv(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// int64FromEnv parses an integer from an environment variable, or returns def if it is unset
+func int64FromEnv(name string, def int64) (int64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// rateLimitsFromEnv reads each rate limit rule from its RATE_LIMIT_* variable, keeping the
+// default for those unset
+func rateLimitsFromEnv() (service.RateLimits, error) {
+	limits := service.DefaultRateLimits()
+	rules := []struct {
+		name string
+		rule *service.RateLimitRule
+	}{
+		{"RATE_LIMIT_MESSAGES", &limits.Messages},
+		{"RATE_LIMIT_SOS", &limits.SOS},
+		{"RATE_LIMIT_SOS_COOLDOWN", &limits.SOSCooldown},
+		{"RATE_LIMIT_GROUP_CREATE", &limits.GroupCreate},
+		{"RATE_LIMIT_PINS", &limits.Pins},
+		{"RATE_LIMIT_LOCATIONS", &limits.Locations},
+	}
+	for _, r := range rules {
+		rule, err := service.ParseRateLimitRule(os.Getenv(r.name), *r.rule)
+		if err != nil {
+			return limits, fmt.Errorf("%s: %w", r.name, err)
+		}
+		*r.rule = rule
+	}
+	return limits, nil
+}
+
+// newBlobStore creates the attachment store selected by ATTACHMENT_STORE
+func newBlobStore() (blobstore.BlobStore, error) {
+	switch os.Getenv("ATTACHMENT_STORE") {
+	case "", "local":
+		dir := os.Getenv("ATTACHMENT_DIR")
+		if dir == "" {
+			dir = defaultAttachmentDir
+		}
+		return blobstore.NewLocalStore(dir)
+	case "s3":
+		return blobstore.NewS3Store(blobstore.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown ATTACHMENT_STORE: %s", os.Getenv("ATTACHMENT_STORE"))
+	}
+}
+
 // runMigrations executes database migrations in order
 func runMigrations(ctx context.Context, pool *database.Pool) error {
 	logger := logging.GetLogger()
@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxMessageAttachments is the most attachments a single message may carry
+const MaxMessageAttachments = 4
+
+var (
+	ErrTooManyAttachments     = fmt.Errorf("a message can have at most %d attachments", MaxMessageAttachments)
+	ErrDuplicateAttachment    = errors.New("an attachment can only be listed once per message")
+	ErrUnsupportedContentType = errors.New("unsupported attachment type: only JPEG, PNG and WebP images and MP3, Ogg, WebM, MP4 and WAV audio are accepted")
+)
+
+// AttachmentKind is the broad kind of an attachment, for clients to pick how to show it
+type AttachmentKind string
+
+const (
+	AttachmentKindImage AttachmentKind = "image"
+	AttachmentKindAudio AttachmentKind = "audio" // Voice notes
+)
+
+// Attachment is a file uploaded to a group and then sent with a message
+type Attachment struct {
+	ID         string         `json:"id"`
+	GroupID    string         `json:"group_id"`
+	DeviceID   string         `json:"device_id"`
+	MessageID  *string        `json:"message_id,omitempty"` // Set once a message is sent with the attachment
+	Kind       AttachmentKind `json:"kind"`
+	MimeType   string         `json:"mime_type"`
+	SizeBytes  int64          `json:"size_bytes"`
+	Width      *int           `json:"width,omitempty"`  // Image dimensions, when known
+	Height     *int           `json:"height,omitempty"` // Image dimensions, when known
+	StorageKey string         `json:"-"`                // Key of the file in the blob store
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// ValidateAttachmentIDs checks the attachments listed on a message
+func ValidateAttachmentIDs(ids []string) error {
+	if len(ids) > MaxMessageAttachments {
+		return ErrTooManyAttachments
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if id == "" {
+			return errors.New("attachment ID cannot be empty")
+		}
+		if seen[id] {
+			return ErrDuplicateAttachment
+		}
+		seen[id] = true
+	}
+	return nil
+}
@@ -29,15 +29,18 @@ const (
 
 // Group represents a community chat room for a geographic area
 type Group struct {
-	ID              string    `json:"id"`
-	Name            string    `json:"name"`
-	Type            GroupType `json:"type"`
-	Latitude        float64   `json:"latitude"`
-	Longitude       float64   `json:"longitude"`
-	RegionCode      *string   `json:"region_code,omitempty"`
-	CreatorDeviceID *string  `json:"creator_device_id,omitempty"` // NULL when creator device is deleted
-	CreatedAt       time.Time `json:"created_at"`
-	UpdatedAt       time.Time `json:"updated_at"`
+	ID              string           `json:"id"`
+	Name            string           `json:"name"`
+	Type            GroupType        `json:"type"`
+	Latitude        float64          `json:"latitude"`
+	Longitude       float64          `json:"longitude"`
+	RegionCode      *string          `json:"region_code,omitempty"`
+	CreatorDeviceID *string          `json:"creator_device_id,omitempty"` // NULL when creator device is deleted
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+	Revision        int64            `json:"revision"`                    // Incremented on every write; send back as base_revision
+	ClientUpdatedAt *time.Time       `json:"client_updated_at,omitempty"` // Client clock of the last write, if it sent one
+	FieldRevisions  map[string]int64 `json:"-"`                           // Revision at which each field last changed
 }
 
 // Validate validates group fields
@@ -48,13 +51,7 @@ func (g *Group) Validate() error {
 	if !g.Type.IsValid() {
 		return ErrInvalidGroupType
 	}
-	if g.Latitude < -90 || g.Latitude > 90 {
-		return ErrInvalidLatitude
-	}
-	if g.Longitude < -180 || g.Longitude > 180 {
-		return ErrInvalidLongitude
-	}
-	return nil
+	return ValidateCoordinates(g.Latitude, g.Longitude)
 }
 
 // IsValid checks if GroupType is valid
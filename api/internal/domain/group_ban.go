@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// MaxBanReasonLength is the longest reason a ban may carry
+const MaxBanReasonLength = 200
+
+var (
+	ErrBanDeviceRequired  = errors.New("device_id is required")
+	ErrBanReasonTooLong   = errors.New("ban reason must be at most 200 characters")
+	ErrInvalidBanDuration = errors.New("duration_seconds must not be negative")
+)
+
+// GroupBan keeps a device out of a group: it may not subscribe to, post in or pin messages of it
+type GroupBan struct {
+	GroupID   string     `json:"group_id"`
+	DeviceID  string     `json:"device_id"`
+	Reason    *string    `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Unset for a permanent ban
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// MaxLocationAccuracy bounds the accuracy radius a device may report, in meters
+const MaxLocationAccuracy = 100000
+
+var (
+	ErrInvalidAccuracy     = errors.New("accuracy must be between 0 and 100000 meters")
+	ErrIncompleteLocation  = errors.New("latitude and longitude must be given together")
+	ErrAccuracyWithoutFix  = errors.New("accuracy requires a latitude and longitude")
+	ErrLocationShareExpiry = errors.New("location share duration must be positive")
+)
+
+// ValidateCoordinates checks a latitude/longitude pair; groups and messages share these rules
+func ValidateCoordinates(latitude, longitude float64) error {
+	if latitude < -90 || latitude > 90 {
+		return ErrInvalidLatitude
+	}
+	if longitude < -180 || longitude > 180 {
+		return ErrInvalidLongitude
+	}
+	return nil
+}
+
+// ValidateAccuracy checks a reported accuracy radius in meters
+func ValidateAccuracy(accuracy float64) error {
+	if accuracy < 0 || accuracy > MaxLocationAccuracy || math.IsNaN(accuracy) {
+		return ErrInvalidAccuracy
+	}
+	return nil
+}
+
+// DistanceMeters returns the great-circle distance between two points using the Haversine formula
+func DistanceMeters(lat1, lon1, lat2, lon2 float64) float64 {
+	const R = 6371000 // Earth's radius in meters
+	dLat := (lat2 - lat1) * math.Pi / 180.0
+	dLon := (lon2 - lon1) * math.Pi / 180.0
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180.0)*math.Cos(lat2*math.Pi/180.0)*
+			math.Sin(dLon/2)*math.Sin(dLon/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return R * c
+}
+
+// LocationShare is a device's live position in a group, streamed until ExpiresAt
+type LocationShare struct {
+	ID        string    `json:"id"`
+	DeviceID  string    `json:"device_id"`
+	GroupID   string    `json:"group_id"`
+	MessageID *string   `json:"message_id,omitempty"` // SOS message the share follows up, if any
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Accuracy  *float64  `json:"accuracy,omitempty"` // Meters
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UpdatedAt time.Time `json:"updated_at"` // Time of the latest position
+}
+
+// IsActive reports whether the share is still streaming at the given time
+func (s *LocationShare) IsActive(now time.Time) bool {
+	return now.Before(s.ExpiresAt)
+}
+
+// Validate validates the shared position
+func (s *LocationShare) Validate() error {
+	if err := ValidateCoordinates(s.Latitude, s.Longitude); err != nil {
+		return err
+	}
+	if s.Accuracy != nil {
+		if err := ValidateAccuracy(*s.Accuracy); err != nil {
+			return err
+		}
+	}
+	if !s.ExpiresAt.After(s.StartedAt) {
+		return ErrLocationShareExpiry
+	}
+	return nil
+}
@@ -6,7 +6,7 @@ import (
 )
 
 var (
-	ErrInvalidMessageContent = errors.New("message content must be 1-2048 characters")
+	ErrInvalidMessageContent = errors.New("message content must be 1-2048 characters, or empty with attachments")
 	ErrInvalidMessageType    = errors.New("invalid message type")
 	ErrInvalidSOSType        = errors.New("invalid SOS type")
 	ErrSOSTypeRequired       = errors.New("SOS type is required for SOS messages")
@@ -33,25 +33,86 @@ const (
 
 // Message represents a communication within a group
 type Message struct {
-	ID             string      `json:"id"`
-	GroupID        string      `json:"group_id"`
-	DeviceID       string      `json:"device_id"`
-	Content        string      `json:"content"`
-	MessageType    MessageType `json:"message_type"`
-	SOSType        *SOSType    `json:"sos_type,omitempty"`
-	Tags           []string    `json:"tags,omitempty"`
-	Pinned         bool        `json:"pinned"`
-	CreatedAt      time.Time   `json:"created_at"`
-	DeviceSequence *int        `json:"device_sequence,omitempty"`
-	SyncedAt       *time.Time  `json:"synced_at,omitempty"`
+	ID             string               `json:"id"`
+	GroupID        string               `json:"group_id"`
+	DeviceID       string               `json:"device_id"`
+	Content        string               `json:"content"`
+	MessageType    MessageType          `json:"message_type"`
+	SOSType        *SOSType             `json:"sos_type,omitempty"`
+	Tags           []string             `json:"tags,omitempty"`
+	Pinned         bool                 `json:"pinned"`
+	CreatedAt      time.Time            `json:"created_at"`
+	DeviceSequence *int                 `json:"device_sequence,omitempty"`
+	SyncedAt       *time.Time           `json:"synced_at,omitempty"`
+	EditedAt       *time.Time           `json:"edited_at,omitempty"`   // Set once the author edits the message
+	UpdatedAt      *time.Time           `json:"updated_at,omitempty"`  // Server time the message, its replies, reactions or quote last changed, filled in on reads
+	DeletedAt      *time.Time           `json:"deleted_at,omitempty"`  // Set when the author deletes the message
+	ReplyToID      *string              `json:"reply_to_id,omitempty"` // Message this one replies to, in the same group
+	ReplyTo        *MessageQuote        `json:"reply_to,omitempty"`    // Quote of the message replied to, filled in on reads
+	ReplyCount     int                  `json:"reply_count"`           // Live replies to this message, as of the read
+	Reactions      map[ReactionKind]int `json:"reactions,omitempty"`   // Live reaction counts by kind, as of the read
+	AttachmentIDs  []string             `json:"attachment_ids,omitempty"`
+	Latitude       *float64             `json:"latitude,omitempty"` // Where the sender was, e.g. for an SOS
+	Longitude      *float64             `json:"longitude,omitempty"`
+	Accuracy       *float64             `json:"accuracy,omitempty"` // Meters
+}
+
+// QuoteSnippetLength is the maximum number of characters of a parent message quoted in a reply
+const QuoteSnippetLength = 100
+
+// MessageQuote is the part of a replied-to message shown alongside its replies
+type MessageQuote struct {
+	ID       string `json:"id"`
+	DeviceID string `json:"device_id"`
+	Snippet  string `json:"snippet"` // Start of the parent's content; empty once the parent is deleted
+	Deleted  bool   `json:"deleted"`
+}
+
+// NewMessageQuote quotes the start of a message's content
+func NewMessageQuote(id, deviceID, content string, deleted bool) *MessageQuote {
+	quote := &MessageQuote{ID: id, DeviceID: deviceID, Deleted: deleted}
+	if !deleted {
+		quote.Snippet = content
+		if runes := []rune(content); len(runes) > QuoteSnippetLength {
+			quote.Snippet = string(runes[:QuoteSnippetLength]) + "…"
+		}
+	}
+	return quote
+}
+
+// ChangedAt returns when the message last changed: its change time if it was read, otherwise its
+// last edit or its creation. Replication orders messages by this time so changes are pulled again.
+func (m *Message) ChangedAt() time.Time {
+	if m.UpdatedAt != nil {
+		return *m.UpdatedAt
+	}
+	if m.EditedAt != nil {
+		return *m.EditedAt
+	}
+	return m.CreatedAt
+}
+
+// MessageEdit records the content an edit replaced
+type MessageEdit struct {
+	ID              string    `json:"id"`
+	MessageID       string    `json:"message_id"`
+	DeviceID        string    `json:"device_id"`
+	PreviousContent string    `json:"previous_content"`
+	EditedAt        time.Time `json:"edited_at"`
 }
 
 // Validate validates message fields
 func (m *Message) Validate() error {
-	// Basic content length guard (1–2048 characters, ~2KB max)
-	if len(m.Content) < 1 || len(m.Content) > 2048 {
+	// Basic content length guard (1–2048 characters, ~2KB max); a photo or voice note may go without text
+	if len(m.Content) > 2048 || (len(m.Content) < 1 && len(m.AttachmentIDs) == 0) {
 		return ErrInvalidMessageContent
 	}
+	if err := ValidateAttachmentIDs(m.AttachmentIDs); err != nil {
+		return err
+	}
+	if err := m.validateLocation(); err != nil {
+		return err
+	}
 	// Basic group and device validation
 	if m.GroupID == "" {
 		return errors.New("group_id is required")
@@ -89,6 +150,31 @@ func (m *Message) Validate() error {
 	return nil
 }
 
+// validateLocation checks the optional location with the same rules as a group's
+func (m *Message) validateLocation() error {
+	if (m.Latitude == nil) != (m.Longitude == nil) {
+		return ErrIncompleteLocation
+	}
+	if m.Latitude == nil {
+		if m.Accuracy != nil {
+			return ErrAccuracyWithoutFix
+		}
+		return nil
+	}
+	if err := ValidateCoordinates(*m.Latitude, *m.Longitude); err != nil {
+		return err
+	}
+	if m.Accuracy != nil {
+		return ValidateAccuracy(*m.Accuracy)
+	}
+	return nil
+}
+
+// HasLocation reports whether the message carries a location
+func (m *Message) HasLocation() bool {
+	return m.Latitude != nil && m.Longitude != nil
+}
+
 // IsValid checks if MessageType is valid
 func (mt MessageType) IsValid() bool {
 	switch mt {
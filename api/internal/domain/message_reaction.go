@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidReactionKind = errors.New("invalid reaction kind")
+	ErrReactionNotSOS      = errors.New("ack and responding reactions are only allowed on SOS messages")
+)
+
+// ReactionKind is the kind of reaction a device leaves on a message
+type ReactionKind string
+
+const (
+	ReactionLike  ReactionKind = "like"
+	ReactionLove  ReactionKind = "love"
+	ReactionSad   ReactionKind = "sad"
+	ReactionPray  ReactionKind = "pray"
+	ReactionThank ReactionKind = "thanks"
+
+	// SOS acknowledgements: the device has seen the SOS, or is on its way to help
+	ReactionAck        ReactionKind = "ack"
+	ReactionResponding ReactionKind = "responding"
+)
+
+// IsValid checks if the reaction kind is valid
+func (k ReactionKind) IsValid() bool {
+	switch k {
+	case ReactionLike, ReactionLove, ReactionSad, ReactionPray, ReactionThank, ReactionAck, ReactionResponding:
+		return true
+	}
+	return false
+}
+
+// IsSOSOnly reports whether the kind may only be used on SOS messages
+func (k ReactionKind) IsSOSOnly() bool {
+	return k == ReactionAck || k == ReactionResponding
+}
+
+// ValidateFor checks the kind can be used on the message
+func (k ReactionKind) ValidateFor(message *Message) error {
+	if !k.IsValid() {
+		return ErrInvalidReactionKind
+	}
+	if k.IsSOSOnly() && message.MessageType != MessageTypeSOS {
+		return ErrReactionNotSOS
+	}
+	return nil
+}
+
+// MessageReaction is a device's reaction to a message
+type MessageReaction struct {
+	ID        string       `json:"id"`
+	MessageID string       `json:"message_id"`
+	GroupID   string       `json:"group_id"`
+	DeviceID  string       `json:"device_id"`
+	Kind      ReactionKind `json:"kind"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package domain
+
+import "time"
+
+// ReadMarker records how far a device has read in a group. Messages positioned at or before
+// (LastReadAt, LastReadMessageID) in (created_at, id) order count as read.
+type ReadMarker struct {
+	ID                string    `json:"id"`
+	DeviceID          string    `json:"device_id"`
+	GroupID           string    `json:"group_id"`
+	LastReadMessageID string    `json:"last_read_message_id,omitempty"` // Empty when marked read up to a time rather than a message
+	LastReadAt        time.Time `json:"last_read_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
@@ -0,0 +1,90 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidSOSState      = errors.New("invalid SOS state")
+	ErrInvalidSOSTransition = errors.New("SOS incident cannot move to that state")
+	ErrSOSResolved          = errors.New("SOS incident is already resolved")
+)
+
+// SOSState is where an SOS incident is in its lifecycle. States only move forward:
+// open -> acknowledged -> in_progress -> resolved, and any earlier state may skip ahead.
+type SOSState string
+
+const (
+	SOSStateOpen         SOSState = "open"
+	SOSStateAcknowledged SOSState = "acknowledged" // Someone has seen the SOS
+	SOSStateInProgress   SOSState = "in_progress"  // Help is on its way
+	SOSStateResolved     SOSState = "resolved"
+)
+
+// sosStateOrder positions each state in the lifecycle
+var sosStateOrder = map[SOSState]int{
+	SOSStateOpen:         0,
+	SOSStateAcknowledged: 1,
+	SOSStateInProgress:   2,
+	SOSStateResolved:     3,
+}
+
+// IsValid checks if the SOS state is valid
+func (s SOSState) IsValid() bool {
+	_, ok := sosStateOrder[s]
+	return ok
+}
+
+// CanTransitionTo reports whether an incident in this state may move to next
+func (s SOSState) CanTransitionTo(next SOSState) bool {
+	from, ok := sosStateOrder[s]
+	if !ok {
+		return false
+	}
+	to, ok := sosStateOrder[next]
+	return ok && to > from
+}
+
+// StatesBefore returns the states from which an incident may move to s
+func (s SOSState) StatesBefore() []SOSState {
+	var states []SOSState
+	for state := range sosStateOrder {
+		if state.CanTransitionTo(s) {
+			states = append(states, state)
+		}
+	}
+	return states
+}
+
+// SOSIncident tracks an SOS message until it is resolved. It shares its message's ID.
+type SOSIncident struct {
+	ID             string         `json:"id"`
+	GroupID        string         `json:"group_id"`
+	DeviceID       string         `json:"device_id"` // Who raised the SOS
+	SOSType        *SOSType       `json:"sos_type,omitempty"`
+	State          SOSState       `json:"state"`
+	Responders     []SOSResponder `json:"responders"`
+	CreatedAt      time.Time      `json:"created_at"` // Server time the SOS reached the server, which may be long after it was sent offline
+	UpdatedAt      time.Time      `json:"updated_at"`
+	AcknowledgedAt *time.Time     `json:"acknowledged_at,omitempty"`
+	ResolvedAt     *time.Time     `json:"resolved_at,omitempty"`
+	ResolvedBy     *string        `json:"resolved_by,omitempty"`
+	EscalatedAt    *time.Time     `json:"escalated_at,omitempty"` // Set once rebroadcast to nearby groups for being left open
+}
+
+// SOSResponder is a device that claimed an incident to help
+type SOSResponder struct {
+	DeviceID  string    `json:"device_id"`
+	ClaimedAt time.Time `json:"claimed_at"`
+}
+
+// HasResponder reports whether the device has claimed the incident
+func (i *SOSIncident) HasResponder(deviceID string) bool {
+	for _, responder := range i.Responders {
+		if responder.DeviceID == deviceID {
+			return true
+		}
+	}
+	return false
+}
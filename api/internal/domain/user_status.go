@@ -21,12 +21,15 @@ const (
 
 // UserStatus represents a user's current safety/need state
 type UserStatus struct {
-	ID          string     `json:"id"`
-	DeviceID    string     `json:"device_id"`
-	StatusType  StatusType `json:"status_type"`
-	Description *string    `json:"description,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID              string           `json:"id"`
+	DeviceID        string           `json:"device_id"`
+	StatusType      StatusType       `json:"status_type"`
+	Description     *string          `json:"description,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+	Revision        int64            `json:"revision"`                    // Incremented on every write; send back as base_revision
+	ClientUpdatedAt *time.Time       `json:"client_updated_at,omitempty"` // Client clock of the last write, if it sent one
+	FieldRevisions  map[string]int64 `json:"-"`                           // Revision at which each field last changed
 }
 
 // Validate validates user status fields
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"nearby-msg/api/internal/domain"
+	"nearby-msg/api/internal/service"
+)
+
+// multipartOverhead is allowed on top of the attachment size for the multipart envelope and form fields
+const multipartOverhead = 64 << 10
+
+// AttachmentHandler handles photo and voice note uploads and downloads
+type AttachmentHandler struct {
+	attachmentService *service.AttachmentService
+}
+
+// NewAttachmentHandler creates a new attachment handler
+func NewAttachmentHandler(attachmentService *service.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{attachmentService: attachmentService}
+}
+
+// Upload handles POST /attachments, a multipart/form-data body with a "file" part.
+// The group is given by the group_id query parameter or a group_id field before the file.
+func (h *AttachmentHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	if !RequireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.attachmentService.MaxBytes()+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		WriteError(w, fmt.Errorf("expected a multipart/form-data body: %w", err), http.StatusBadRequest)
+		return
+	}
+
+	// Parts are read as they stream in, so the file is never buffered on disk
+	groupID := r.URL.Query().Get("group_id")
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			WriteError(w, fmt.Errorf("file is required"), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeUploadReadError(w, err)
+			return
+		}
+
+		switch part.FormName() {
+		case "group_id":
+			value, err := io.ReadAll(io.LimitReader(part, 64))
+			if err != nil {
+				writeUploadReadError(w, err)
+				return
+			}
+			groupID = strings.TrimSpace(string(value))
+		case "file":
+			if groupID == "" {
+				WriteError(w, fmt.Errorf("group_id is required before the file"), http.StatusBadRequest)
+				return
+			}
+			attachment, err := h.attachmentService.Upload(r.Context(), deviceID, groupID, part)
+			if err != nil {
+				writeAttachmentError(w, err)
+				return
+			}
+			WriteJSON(w, http.StatusCreated, attachment)
+			return
+		}
+	}
+}
+
+// HandleAttachmentRoutes routes /attachments/{id} and /attachments/{id}/content
+func (h *AttachmentHandler) HandleAttachmentRoutes(w http.ResponseWriter, r *http.Request) {
+	if !RequireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// Extract attachment ID from path: /v1/attachments/{id}[/content]
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var attachmentID string
+	var isContentRoute bool
+	for i, part := range pathParts {
+		if part == "attachments" && i+1 < len(pathParts) {
+			attachmentID = pathParts[i+1]
+			isContentRoute = i+2 < len(pathParts) && pathParts[i+2] == "content"
+			break
+		}
+	}
+
+	if attachmentID == "" {
+		WriteError(w, fmt.Errorf("attachment ID required"), http.StatusBadRequest)
+		return
+	}
+
+	if !isContentRoute {
+		attachment, err := h.attachmentService.GetAttachment(r.Context(), deviceID, attachmentID)
+		if err != nil {
+			writeAttachmentError(w, err)
+			return
+		}
+		WriteJSON(w, http.StatusOK, attachment)
+		return
+	}
+
+	attachment, file, err := h.attachmentService.OpenAttachment(r.Context(), deviceID, attachmentID)
+	if err != nil {
+		writeAttachmentError(w, err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", attachment.MimeType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.SizeBytes, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Attachments never change once uploaded
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, file)
+}
+
+// writeUploadReadError reports a failure reading the multipart body
+func writeUploadReadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		WriteError(w, service.ErrAttachmentTooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+	WriteError(w, fmt.Errorf("invalid multipart body: %w", err), http.StatusBadRequest)
+}
+
+// writeAttachmentError maps an attachment service error to its HTTP status
+func writeAttachmentError(w http.ResponseWriter, err error) {
+	if WriteAccessError(w, err) {
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, service.ErrAttachmentTooLarge), errors.As(err, &tooLarge):
+		WriteError(w, service.ErrAttachmentTooLarge, http.StatusRequestEntityTooLarge)
+	case errors.Is(err, domain.ErrUnsupportedContentType):
+		WriteError(w, err, http.StatusUnsupportedMediaType)
+	case errors.Is(err, service.ErrEmptyAttachment), errors.Is(err, service.ErrInvalidImage):
+		WriteError(w, err, http.StatusBadRequest)
+	case strings.Contains(err.Error(), "not found"):
+		WriteError(w, err, http.StatusNotFound)
+	default:
+		WriteError(w, err, http.StatusInternalServerError)
+	}
+}
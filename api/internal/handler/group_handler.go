@@ -2,12 +2,16 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"nearby-msg/api/internal/domain"
 	"nearby-msg/api/internal/infrastructure/auth"
+	"nearby-msg/api/internal/infrastructure/database"
 	"nearby-msg/api/internal/service"
 )
 
@@ -17,15 +21,29 @@ type GroupHandler struct {
 	favoriteService *service.FavoriteService
 	statusService   *service.StatusService
 	pinService      *service.PinService
+	messageService  *service.MessageService
+	markerService   *service.ReadMarkerService
+	presenceService *service.PresenceService
+	locationService *service.LocationService
+	sosService      *service.SOSService
+	banService      *service.GroupBanService
+	wsService       *service.WebSocketService
 }
 
 // NewGroupHandler creates a new group handler
-func NewGroupHandler(groupService *service.GroupService, favoriteService *service.FavoriteService, statusService *service.StatusService, pinService *service.PinService) *GroupHandler {
+func NewGroupHandler(groupService *service.GroupService, favoriteService *service.FavoriteService, statusService *service.StatusService, pinService *service.PinService, messageService *service.MessageService, markerService *service.ReadMarkerService, presenceService *service.PresenceService, locationService *service.LocationService, sosService *service.SOSService, banService *service.GroupBanService, wsService *service.WebSocketService) *GroupHandler {
 	return &GroupHandler{
 		groupService:    groupService,
 		favoriteService: favoriteService,
 		statusService:   statusService,
 		pinService:      pinService,
+		messageService:  messageService,
+		markerService:   markerService,
+		presenceService: presenceService,
+		locationService: locationService,
+		sosService:      sosService,
+		banService:      banService,
+		wsService:       wsService,
 	}
 }
 
@@ -121,6 +139,9 @@ func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 
 	group, err := h.groupService.CreateGroup(ctx, req)
 	if err != nil {
+		if WriteRateLimitError(w, err) {
+			return
+		}
 		// Check if error is "device has already created a group" - return 409 Conflict
 		if err.Error() == "device has already created a group" {
 			WriteError(w, err, http.StatusConflict)
@@ -135,11 +156,21 @@ func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 
 // HandleGroupRoutes routes group-related requests based on path and method
 func (h *GroupHandler) HandleGroupRoutes(w http.ResponseWriter, r *http.Request) {
-	// Extract group ID from path: /v1/groups/{id} or /v1/groups/{id}/favorite or /v1/groups/{id}/pinned
+	// Extract group ID from path: /v1/groups/{id}, /v1/groups/{id}/favorite, /v1/groups/{id}/pinned
+	// /v1/groups/{id}/messages, /v1/groups/{id}/messages/search, /v1/groups/{id}/read, /v1/groups/{id}/presence
+	// /v1/groups/{id}/sos, /v1/groups/{id}/sos-locations, /v1/groups/{id}/bans or /v1/groups/{id}/bans/{deviceId}
 	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
 	var groupID string
 	var isFavoriteRoute bool
 	var isPinnedRoute bool
+	var isMessagesRoute bool
+	var isSearchRoute bool
+	var isReadRoute bool
+	var isPresenceRoute bool
+	var isSOSLocationsRoute bool
+	var isSOSRoute bool
+	var isBansRoute bool
+	var bannedDeviceID string
 
 	// Find "groups" in path and extract group ID
 	for i, part := range pathParts {
@@ -151,6 +182,25 @@ func (h *GroupHandler) HandleGroupRoutes(w http.ResponseWriter, r *http.Request)
 					isFavoriteRoute = true
 				} else if pathParts[i+2] == "pinned" {
 					isPinnedRoute = true
+				} else if pathParts[i+2] == "read" {
+					isReadRoute = true
+				} else if pathParts[i+2] == "presence" {
+					isPresenceRoute = true
+				} else if pathParts[i+2] == "sos-locations" {
+					isSOSLocationsRoute = true
+				} else if pathParts[i+2] == "sos" {
+					isSOSRoute = true
+				} else if pathParts[i+2] == "bans" {
+					isBansRoute = true
+					if i+3 < len(pathParts) {
+						bannedDeviceID = pathParts[i+3]
+					}
+				} else if pathParts[i+2] == "messages" {
+					if i+3 < len(pathParts) && pathParts[i+3] == "search" {
+						isSearchRoute = true
+					} else {
+						isMessagesRoute = true
+					}
 				}
 			}
 			break
@@ -190,6 +240,45 @@ func (h *GroupHandler) HandleGroupRoutes(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if isSearchRoute {
+		h.SearchMessages(w, r, groupID)
+		return
+	}
+
+	if isMessagesRoute {
+		h.GetMessages(w, r, groupID)
+		return
+	}
+
+	if isReadRoute {
+		h.MarkRead(w, r, groupID)
+		return
+	}
+
+	if isPresenceRoute {
+		h.GetPresence(w, r, groupID)
+		return
+	}
+
+	if isSOSLocationsRoute {
+		h.GetSOSLocations(w, r, groupID)
+		return
+	}
+
+	if isSOSRoute {
+		h.GetSOSIncidents(w, r, groupID)
+		return
+	}
+
+	if isBansRoute {
+		if bannedDeviceID == "" {
+			h.BanDevice(w, r, groupID)
+		} else {
+			h.UnbanDevice(w, r, groupID, bannedDeviceID)
+		}
+		return
+	}
+
 	// Regular group routes
 	switch r.Method {
 	case http.MethodGet:
@@ -390,6 +479,294 @@ func (h *GroupHandler) GetPinnedMessages(w http.ResponseWriter, r *http.Request)
 	WriteJSON(w, http.StatusOK, pins)
 }
 
+// SearchMessages handles GET /groups/{id}/messages/search
+// Query parameters: q (required), message_type, sos_type, tags (comma-separated, all required),
+// from and to (RFC3339), cursor and limit
+func (h *GroupHandler) SearchMessages(w http.ResponseWriter, r *http.Request, groupID string) {
+	if !RequireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	req := service.SearchMessagesRequest{
+		Query:  query.Get("q"),
+		Tags:   splitList(query.Get("tags")),
+		Cursor: query.Get("cursor"),
+	}
+	if v := query.Get("message_type"); v != "" {
+		messageType := domain.MessageType(v)
+		req.MessageType = &messageType
+	}
+	if v := query.Get("sos_type"); v != "" {
+		sosType := domain.SOSType(v)
+		req.SOSType = &sosType
+	}
+	var err error
+	if req.From, err = parseTimeParam(query.Get("from")); err != nil {
+		WriteError(w, fmt.Errorf("invalid from: %w", err), http.StatusBadRequest)
+		return
+	}
+	if req.To, err = parseTimeParam(query.Get("to")); err != nil {
+		WriteError(w, fmt.Errorf("invalid to: %w", err), http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			WriteError(w, fmt.Errorf("invalid limit: %w", err), http.StatusBadRequest)
+			return
+		}
+		req.Limit = limit
+	}
+
+	resp, err := h.messageService.SearchMessages(r.Context(), deviceID, groupID, req)
+	if err != nil {
+		if WriteAccessError(w, err) {
+			return
+		}
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// GetMessages handles GET /groups/{id}/messages
+// Query parameters: before or after (cursor or RFC3339 timestamp) and limit
+func (h *GroupHandler) GetMessages(w http.ResponseWriter, r *http.Request, groupID string) {
+	if !RequireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	var req service.GroupHistoryRequest
+	var err error
+	if req.Before, err = parseCursorParam(query.Get("before")); err != nil {
+		WriteError(w, fmt.Errorf("invalid before: %w", err), http.StatusBadRequest)
+		return
+	}
+	if req.After, err = parseCursorParam(query.Get("after")); err != nil {
+		WriteError(w, fmt.Errorf("invalid after: %w", err), http.StatusBadRequest)
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		if req.Limit, err = strconv.Atoi(v); err != nil {
+			WriteError(w, fmt.Errorf("invalid limit: %w", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp, err := h.messageService.GetGroupHistory(r.Context(), deviceID, groupID, req)
+	if err != nil {
+		if WriteAccessError(w, err) {
+			return
+		}
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// MarkRead handles POST /groups/{id}/read
+func (h *GroupHandler) MarkRead(w http.ResponseWriter, r *http.Request, groupID string) {
+	if !RequireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional; without a message ID the group is read up to now
+	var req struct {
+		MessageID string `json:"message_id,omitempty"`
+	}
+	if r.ContentLength != 0 {
+		if err := DecodeJSON(w, r, &req); err != nil {
+			return
+		}
+	}
+
+	marker, moved, err := h.markerService.MarkRead(r.Context(), deviceID, groupID, req.MessageID)
+	if err != nil {
+		if WriteAccessError(w, err) {
+			return
+		}
+		if strings.Contains(err.Error(), "message not found") {
+			WriteError(w, err, http.StatusNotFound)
+			return
+		}
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if moved {
+		h.wsService.SendToDevice(deviceID, service.ReadMarkerFrame(marker))
+	}
+
+	WriteJSON(w, http.StatusOK, marker)
+}
+
+// GetPresence handles GET /groups/{id}/presence
+func (h *GroupHandler) GetPresence(w http.ResponseWriter, r *http.Request, groupID string) {
+	if !RequireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	presence, err := h.presenceService.GetGroupPresence(r.Context(), deviceID, groupID)
+	if err != nil {
+		if WriteAccessError(w, err) {
+			return
+		}
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, presence)
+}
+
+// GetSOSLocations handles GET /groups/{id}/sos-locations. Optional latitude and longitude query
+// parameters give the viewer's position, to include distances and sort nearest first.
+func (h *GroupHandler) GetSOSLocations(w http.ResponseWriter, r *http.Request, groupID string) {
+	if !RequireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	var latitude, longitude *float64
+	if latStr := r.URL.Query().Get("latitude"); latStr != "" {
+		value, err := strconv.ParseFloat(latStr, 64)
+		if err != nil {
+			WriteError(w, fmt.Errorf("invalid latitude: %w", err), http.StatusBadRequest)
+			return
+		}
+		latitude = &value
+	}
+	if lonStr := r.URL.Query().Get("longitude"); lonStr != "" {
+		value, err := strconv.ParseFloat(lonStr, 64)
+		if err != nil {
+			WriteError(w, fmt.Errorf("invalid longitude: %w", err), http.StatusBadRequest)
+			return
+		}
+		longitude = &value
+	}
+
+	locations, err := h.locationService.GetSOSLocations(r.Context(), deviceID, groupID, latitude, longitude)
+	if err != nil {
+		if WriteAccessError(w, err) {
+			return
+		}
+		if errors.Is(err, domain.ErrIncompleteLocation) || errors.Is(err, domain.ErrInvalidLatitude) || errors.Is(err, domain.ErrInvalidLongitude) {
+			WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, locations)
+}
+
+// GetSOSIncidents handles GET /groups/{id}/sos. An optional state query parameter, comma
+// separated, limits the list to incidents in those states.
+func (h *GroupHandler) GetSOSIncidents(w http.ResponseWriter, r *http.Request, groupID string) {
+	if !RequireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	var states []domain.SOSState
+	if stateParam := r.URL.Query().Get("state"); stateParam != "" {
+		for _, state := range strings.Split(stateParam, ",") {
+			states = append(states, domain.SOSState(strings.TrimSpace(state)))
+		}
+	}
+
+	incidents, err := h.sosService.ListIncidents(r.Context(), deviceID, groupID, states)
+	if err != nil {
+		if WriteAccessError(w, err) {
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidSOSState) {
+			WriteError(w, err, http.StatusBadRequest)
+			return
+		}
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"incidents": incidents})
+}
+
+// GetUnreadCounts handles GET /groups/unread
+func (h *GroupHandler) GetUnreadCounts(w http.ResponseWriter, r *http.Request) {
+	if !RequireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	counts, err := h.markerService.GetUnreadCounts(r.Context(), deviceID)
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"groups": counts})
+}
+
+// parseCursorParam parses an optional cursor query parameter
+func parseCursorParam(value string) (*database.Cursor, error) {
+	if value == "" {
+		return nil, nil
+	}
+	cursor, err := database.ParseCursor(value)
+	if err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// parseTimeParam parses an optional RFC3339 query parameter
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
 // UpdateGroup handles PUT/PATCH /groups/{id}
 func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
 	// Get device ID from context
@@ -413,7 +790,7 @@ func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	group, err := h.groupService.UpdateGroup(ctx, groupID, deviceID, req)
+	group, conflict, err := h.groupService.UpdateGroup(ctx, groupID, deviceID, req)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			WriteError(w, err, http.StatusNotFound)
@@ -426,6 +803,11 @@ func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
 		WriteError(w, err, http.StatusBadRequest)
 		return
 	}
+	if conflict != nil {
+		// Stale base revision: return the current group so the client can reconcile
+		WriteJSON(w, http.StatusConflict, conflict)
+		return
+	}
 
 	WriteJSON(w, http.StatusOK, group)
 }
@@ -440,3 +822,62 @@ func extractGroupIDFromPath(path string) string {
 	}
 	return ""
 }
+
+// BanDevice handles POST /groups/{id}/bans, letting the group's creator ban a device from it
+func (h *GroupHandler) BanDevice(w http.ResponseWriter, r *http.Request, groupID string) {
+	if !RequireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	var req service.BanDeviceRequest
+	if err := DecodeJSON(w, r, &req); err != nil {
+		return
+	}
+
+	ban, err := h.banService.BanDevice(r.Context(), deviceID, groupID, req)
+	if err != nil {
+		writeBanError(w, err)
+		return
+	}
+
+	WriteJSON(w, http.StatusCreated, ban)
+}
+
+// UnbanDevice handles DELETE /groups/{id}/bans/{deviceId}, letting the group's creator lift a ban
+func (h *GroupHandler) UnbanDevice(w http.ResponseWriter, r *http.Request, groupID, bannedDeviceID string) {
+	if !RequireMethod(w, r, http.MethodDelete) {
+		return
+	}
+
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.banService.UnbanDevice(r.Context(), deviceID, groupID, bannedDeviceID); err != nil {
+		writeBanError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeBanError maps ban and unban errors to HTTP statuses
+func writeBanError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrNotGroupModerator):
+		WriteError(w, err, http.StatusForbidden)
+	case strings.Contains(err.Error(), "not found"):
+		WriteError(w, err, http.StatusNotFound)
+	case errors.Is(err, service.ErrCannotBanSelf), errors.Is(err, domain.ErrBanDeviceRequired),
+		errors.Is(err, domain.ErrBanReasonTooLong), errors.Is(err, domain.ErrInvalidBanDuration):
+		WriteError(w, err, http.StatusBadRequest)
+	default:
+		WriteError(w, err, http.StatusInternalServerError)
+	}
+}
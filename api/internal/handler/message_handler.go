@@ -2,23 +2,32 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"nearby-msg/api/internal/domain"
 	"nearby-msg/api/internal/infrastructure/auth"
 	"nearby-msg/api/internal/service"
 )
 
 // MessageHandler handles message-related HTTP requests
 type MessageHandler struct {
-	pinService *service.PinService
+	pinService      *service.PinService
+	messageService  *service.MessageService
+	reactionService *service.ReactionService
+	wsService       *service.WebSocketService
 }
 
 // NewMessageHandler creates a new message handler
-func NewMessageHandler(pinService *service.PinService) *MessageHandler {
+func NewMessageHandler(pinService *service.PinService, messageService *service.MessageService, reactionService *service.ReactionService, wsService *service.WebSocketService) *MessageHandler {
 	return &MessageHandler{
-		pinService: pinService,
+		pinService:      pinService,
+		messageService:  messageService,
+		reactionService: reactionService,
+		wsService:       wsService,
 	}
 }
 
@@ -56,6 +65,9 @@ func (h *MessageHandler) PinMessage(w http.ResponseWriter, r *http.Request) {
 
 	pin, err := h.pinService.PinMessage(ctx, deviceID, messageID, req.Tag)
 	if err != nil {
+		if WriteAccessError(w, err) || WriteRateLimitError(w, err) {
+			return
+		}
 		if strings.Contains(err.Error(), "message not found") {
 			WriteError(w, err, http.StatusNotFound)
 			return
@@ -100,20 +112,222 @@ func (h *MessageHandler) UnpinMessage(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// EditMessage handles PATCH /messages/{id}
+func (h *MessageHandler) EditMessage(w http.ResponseWriter, r *http.Request, messageID string) {
+	if !RequireMethod(w, r, http.MethodPatch) {
+		return
+	}
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := DecodeJSON(w, r, &req); err != nil {
+		return
+	}
+
+	message, err := h.messageService.EditMessage(r.Context(), deviceID, messageID, req.Content)
+	if err != nil {
+		writeMessageChangeError(w, err)
+		return
+	}
+
+	h.wsService.BroadcastToGroup(message.GroupID, service.MessageEditedFrame(message))
+
+	WriteJSON(w, http.StatusOK, message)
+}
+
+// DeleteMessage handles DELETE /messages/{id}
+func (h *MessageHandler) DeleteMessage(w http.ResponseWriter, r *http.Request, messageID string) {
+	if !RequireMethod(w, r, http.MethodDelete) {
+		return
+	}
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	message, err := h.messageService.DeleteMessage(r.Context(), deviceID, messageID)
+	if err != nil {
+		writeMessageChangeError(w, err)
+		return
+	}
+
+	h.wsService.BroadcastToGroup(message.GroupID, service.MessageDeletedFrame(message))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetReplies handles GET /messages/{id}/replies
+func (h *MessageHandler) GetReplies(w http.ResponseWriter, r *http.Request, messageID string) {
+	if !RequireMethod(w, r, http.MethodGet) {
+		return
+	}
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	after, err := parseCursorParam(query.Get("after"))
+	if err != nil {
+		WriteError(w, fmt.Errorf("invalid after: %w", err), http.StatusBadRequest)
+		return
+	}
+	var limit int
+	if v := query.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil {
+			WriteError(w, fmt.Errorf("invalid limit: %w", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp, err := h.messageService.GetReplies(r.Context(), deviceID, messageID, after, limit)
+	if err != nil {
+		if WriteAccessError(w, err) {
+			return
+		}
+		if strings.Contains(err.Error(), "message not found") {
+			WriteError(w, err, http.StatusNotFound)
+			return
+		}
+		WriteError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
+}
+
+// AddReaction handles POST /messages/{id}/reactions. Responds 201 if the reaction was added,
+// or 200 if the device already had it.
+func (h *MessageHandler) AddReaction(w http.ResponseWriter, r *http.Request, messageID string) {
+	if !RequireMethod(w, r, http.MethodPost) {
+		return
+	}
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Kind domain.ReactionKind `json:"kind"`
+	}
+	if err := DecodeJSON(w, r, &req); err != nil {
+		return
+	}
+
+	change, err := h.reactionService.AddReaction(r.Context(), deviceID, messageID, req.Kind)
+	if err != nil {
+		writeReactionError(w, err)
+		return
+	}
+
+	if change.Incident != nil {
+		h.wsService.BroadcastToGroup(change.Incident.GroupID, service.SOSIncidentFrame(change.Incident, deviceID))
+	}
+	if !change.Changed {
+		WriteJSON(w, http.StatusOK, change)
+		return
+	}
+
+	h.wsService.BroadcastToGroup(change.Reaction.GroupID, service.ReactionFrame(true, change))
+	WriteJSON(w, http.StatusCreated, change)
+}
+
+// RemoveReaction handles DELETE /messages/{id}/reactions/{kind}. Removing a reaction the device
+// doesn't have succeeds without a broadcast.
+func (h *MessageHandler) RemoveReaction(w http.ResponseWriter, r *http.Request, messageID string, kind domain.ReactionKind) {
+	if !RequireMethod(w, r, http.MethodDelete) {
+		return
+	}
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	change, err := h.reactionService.RemoveReaction(r.Context(), deviceID, messageID, kind)
+	if err != nil {
+		writeReactionError(w, err)
+		return
+	}
+
+	if change.Changed {
+		h.wsService.BroadcastToGroup(change.Reaction.GroupID, service.ReactionFrame(false, change))
+	}
+	if change.Incident != nil {
+		h.wsService.BroadcastToGroup(change.Incident.GroupID, service.SOSIncidentFrame(change.Incident, deviceID))
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeReactionError writes the response for a failed reaction change
+func writeReactionError(w http.ResponseWriter, err error) {
+	if WriteAccessError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, domain.ErrInvalidReactionKind), errors.Is(err, domain.ErrReactionNotSOS):
+		WriteError(w, err, http.StatusBadRequest)
+	case strings.Contains(err.Error(), "not found"):
+		WriteError(w, err, http.StatusNotFound)
+	default:
+		WriteError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// GetMessageEdits handles GET /messages/{id}/edits
+func (h *MessageHandler) GetMessageEdits(w http.ResponseWriter, r *http.Request, messageID string) {
+	if !RequireMethod(w, r, http.MethodGet) {
+		return
+	}
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	edits, err := h.messageService.GetMessageEdits(r.Context(), deviceID, messageID)
+	if err != nil {
+		writeMessageChangeError(w, err)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{"edits": edits})
+}
+
+// writeMessageChangeError writes the response for a failed edit, deletion or edit history lookup
+func writeMessageChangeError(w http.ResponseWriter, err error) {
+	if WriteAccessError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrNotMessageAuthor), errors.Is(err, service.ErrEditWindowExpired):
+		WriteError(w, err, http.StatusForbidden)
+	case strings.Contains(err.Error(), "message not found"):
+		WriteError(w, err, http.StatusNotFound)
+	case strings.Contains(err.Error(), "validation failed"):
+		WriteError(w, err, http.StatusBadRequest)
+	default:
+		WriteError(w, err, http.StatusInternalServerError)
+	}
+}
+
 // HandleMessageRoutes routes message-related requests based on path and method
 func (h *MessageHandler) HandleMessageRoutes(w http.ResponseWriter, r *http.Request) {
-	// Extract message ID from path: /v1/messages/{id}/pin
+	// Extract message ID from path: /v1/messages/{id}[/pin|/edits|/replies|/reactions[/{kind}]]
 	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
 	var messageID string
-	var isPinRoute bool
+	var subRoute string
 
 	// Find "messages" in path and extract message ID
 	for i, part := range pathParts {
 		if part == "messages" && i+1 < len(pathParts) {
 			messageID = pathParts[i+1]
-			// Check if next part is "pin"
-			if i+2 < len(pathParts) && pathParts[i+2] == "pin" {
-				isPinRoute = true
+			if i+2 < len(pathParts) {
+				subRoute = strings.Join(pathParts[i+2:], "/")
 			}
 			break
 		}
@@ -124,7 +338,27 @@ func (h *MessageHandler) HandleMessageRoutes(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	if isPinRoute {
+	switch subRoute {
+	case "":
+		switch r.Method {
+		case http.MethodPatch:
+			h.EditMessage(w, r, messageID)
+		case http.MethodDelete:
+			h.DeleteMessage(w, r, messageID)
+		default:
+			WriteError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+		return
+	case "edits":
+		h.GetMessageEdits(w, r, messageID)
+		return
+	case "replies":
+		h.GetReplies(w, r, messageID)
+		return
+	case "reactions":
+		h.AddReaction(w, r, messageID)
+		return
+	case "pin":
 		switch r.Method {
 		case http.MethodPost:
 			h.PinMessage(w, r)
@@ -136,6 +370,11 @@ func (h *MessageHandler) HandleMessageRoutes(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	if kind, ok := strings.CutPrefix(subRoute, "reactions/"); ok && kind != "" {
+		h.RemoveReaction(w, r, messageID, domain.ReactionKind(kind))
+		return
+	}
+
 	WriteError(w, fmt.Errorf("not found"), http.StatusNotFound)
 }
 
@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
 
 	"nearby-msg/api/internal/infrastructure/auth"
 	"nearby-msg/api/internal/infrastructure/logging"
+	"nearby-msg/api/internal/service"
 )
 
 // ErrorResponse represents a standardized error response
@@ -68,7 +70,7 @@ func CORSMiddleware(next http.Handler) http.Handler {
 			w.Header().Set("Vary", "Origin")
 			// Allow credentials so JWT in Authorization header can be used
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
-			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+			w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Last-Event-ID")
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		}
 
@@ -89,6 +91,11 @@ type responseWriter struct {
 	statusCode int
 }
 
+// Unwrap exposes the underlying writer to http.ResponseController (e.g. for flushing streams)
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
@@ -121,6 +128,8 @@ func WriteError(w http.ResponseWriter, err error, statusCode int) {
 		code = "NOT_FOUND"
 	} else if statusCode == http.StatusConflict {
 		code = "CONFLICT"
+	} else if statusCode == http.StatusGone {
+		code = "GONE"
 	} else if statusCode == http.StatusTooManyRequests {
 		code = "RATE_LIMIT_EXCEEDED"
 	} else if statusCode >= 500 {
@@ -134,6 +143,39 @@ func WriteError(w http.ResponseWriter, err error, statusCode int) {
 	writeErrorResponse(w, statusCode, message, code)
 }
 
+// WriteAccessError writes an access policy denial with its status and code.
+// Returns false if err is not an access denial, leaving the response untouched.
+func WriteAccessError(w http.ResponseWriter, err error) bool {
+	accessErr, ok := service.AsAccessError(err)
+	if !ok {
+		return false
+	}
+
+	statusCode := http.StatusForbidden
+	switch accessErr.Code {
+	case service.AccessGroupNotFound:
+		statusCode = http.StatusNotFound
+	case service.AccessGroupDeleted:
+		statusCode = http.StatusGone
+	}
+
+	writeErrorResponse(w, statusCode, err.Error(), strings.ToUpper(string(accessErr.Code)))
+	return true
+}
+
+// WriteRateLimitError writes a rate limit denial as 429 with a Retry-After header.
+// Returns false if err is not a rate limit denial, leaving the response untouched.
+func WriteRateLimitError(w http.ResponseWriter, err error) bool {
+	rateErr, ok := service.AsRateLimitError(err)
+	if !ok {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(rateErr.RetryAfterSeconds()))
+	WriteError(w, rateErr, http.StatusTooManyRequests)
+	return true
+}
+
 // WriteJSON writes a JSON response
 func WriteJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -166,6 +208,19 @@ func RequireAuth(w http.ResponseWriter, r *http.Request) (string, bool) {
 	return deviceID, true
 }
 
+// BearerToken returns the token from the "token" query parameter or a Bearer Authorization header.
+// The query parameter is for clients that can't set headers (WebSocket, EventSource).
+func BearerToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	parts := strings.Split(r.Header.Get("Authorization"), " ")
+	if len(parts) == 2 && parts[0] == "Bearer" {
+		return parts[1]
+	}
+	return ""
+}
+
 // DecodeJSON decodes request body JSON into the provided struct
 // Returns error if decoding fails (and writes error response)
 func DecodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
@@ -5,42 +5,26 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"sync"
-	"time"
+	"strconv"
+	"strings"
 
-	"nearby-msg/api/internal/domain"
 	"nearby-msg/api/internal/infrastructure/auth"
+	"nearby-msg/api/internal/infrastructure/database"
 	"nearby-msg/api/internal/service"
 )
 
-const (
-	maxMessagesPerMinute = 10
-	rateLimitWindow      = time.Minute
-
-	// Additional SOS-specific limit (defence-in-depth, besides cooldown in MessageService)
-	maxSOSPerHour = 6
-	sosWindow     = time.Hour
-)
-
 // ReplicationHandler handles replication push/pull endpoints.
 type ReplicationHandler struct {
 	replicationService *service.ReplicationService
-
-	mu          sync.Mutex
-	messageLogs map[string][]time.Time
-	sosLogs     map[string][]time.Time
 }
 
 // NewReplicationHandler creates a new replication handler.
 func NewReplicationHandler(replicationService *service.ReplicationService) *ReplicationHandler {
-	return &ReplicationHandler{
-		replicationService: replicationService,
-		messageLogs:        make(map[string][]time.Time),
-		sosLogs:            make(map[string][]time.Time),
-	}
+	return &ReplicationHandler{replicationService: replicationService}
 }
 
 // Push handles POST /replicate/push
+// Responds with a per-mutation result report (applied, duplicate or rejected)
 func (h *ReplicationHandler) Push(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		WriteError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
@@ -68,34 +52,24 @@ func (h *ReplicationHandler) Push(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Rate limit only for messages (existing behavior)
-	if len(req.Messages) > 0 {
-		// Generic per-message limit
-		if !h.allowMessages(deviceID, len(req.Messages)) {
-			WriteError(w, fmt.Errorf("rate limit exceeded (max %d messages/minute)", maxMessagesPerMinute), http.StatusTooManyRequests)
-			return
-		}
-
-		// SOS-specific limit (count how many SOS messages are in this batch)
-		sosCount := 0
-		for _, msg := range req.Messages {
-			if msg.MessageType == domain.MessageTypeSOS {
-				sosCount++
-			}
-		}
-		if sosCount > 0 && !h.allowSOS(deviceID, sosCount) {
-			WriteError(w, fmt.Errorf("SOS rate limit exceeded (max %d SOS/hour)", maxSOSPerHour), http.StatusTooManyRequests)
-			return
-		}
-	}
-
 	// Use PushMutations to handle all mutation types
-	if err := h.replicationService.PushMutations(ctx, deviceID, req); err != nil {
-		WriteError(w, err, http.StatusBadRequest)
+	// Individual mutations that fail are reported in the results rather than failing the request
+	resp, err := h.replicationService.PushMutations(ctx, deviceID, req)
+	if err != nil {
+		WriteError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	// Rate-limited mutations are rejected on their own; tell the client when to retry them
+	retryAfter := 0
+	for _, result := range resp.Results {
+		retryAfter = max(retryAfter, result.RetryAfter)
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+
+	WriteJSON(w, http.StatusOK, resp)
 }
 
 // Pull handles POST /replicate/pull
@@ -180,64 +154,151 @@ func (h *ReplicationHandler) Pull(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, http.StatusOK, resp)
 }
 
-func (h *ReplicationHandler) allowMessages(deviceID string, count int) bool {
-	if count <= 0 {
-		return true
+// Stream handles GET/POST /replicate/stream
+// Server-Sent Events alternative to polling pull: streams the backlog since the given
+// checkpoints, then new documents and deletions as they are written.
+// POST takes a PullDocumentsRequest body. GET (for EventSource) takes query parameters:
+// collections and group_ids (comma-separated), checkpoint (repeatable, "collection:cursor"),
+// limit and token. A Last-Event-ID header (or last_event_id parameter) resumes a stream.
+// Auth is checked here rather than by the auth middleware, since EventSource can't send headers.
+func (h *ReplicationHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		WriteError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		return
 	}
 
-	now := time.Now()
-	windowStart := now.Add(-rateLimitWindow)
-
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	deviceID, err := auth.ValidateToken(BearerToken(r))
+	if err != nil {
+		WriteError(w, fmt.Errorf("unauthorized"), http.StatusUnauthorized)
+		return
+	}
 
-	log := h.messageLogs[deviceID]
-	var filtered []time.Time
-	for _, ts := range log {
-		if ts.After(windowStart) {
-			filtered = append(filtered, ts)
+	req, err := parseStreamRequest(r)
+	if err != nil {
+		WriteError(w, err, http.StatusBadRequest)
+		return
+	}
+	for _, collection := range req.Collections {
+		if !service.ValidCollections[collection] {
+			WriteError(w, fmt.Errorf("invalid collection: %s", collection), http.StatusBadRequest)
+			return
 		}
 	}
 
-	if len(filtered)+count > maxMessagesPerMinute {
-		return false
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable response buffering in nginx
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(event service.StreamEvent) error {
+		if err := writeStreamEvent(w, event); err != nil {
+			return err
+		}
+		return rc.Flush()
 	}
 
-	for i := 0; i < count; i++ {
-		filtered = append(filtered, now)
+	// Ask EventSource to reconnect quickly if the connection drops
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetryMillis)
+
+	if err := h.replicationService.StreamDocuments(r.Context(), deviceID, req, send); err != nil && r.Context().Err() == nil {
+		// Headers are already sent, so report the failure as an event
+		send(service.StreamEvent{Event: "error", Data: ErrorResponse{Error: err.Error()}})
 	}
-	h.messageLogs[deviceID] = filtered
-	return true
 }
 
-// allowSOS enforces an additional per-device SOS rate limit over a longer window.
-// This is in addition to the cooldown enforced in MessageService.
-func (h *ReplicationHandler) allowSOS(deviceID string, count int) bool {
-	if count <= 0 {
-		return true
-	}
+// streamRetryMillis is the reconnection delay suggested to EventSource clients
+const streamRetryMillis = 3000
 
-	now := time.Now()
-	windowStart := now.Add(-sosWindow)
+// parseStreamRequest reads a stream request from the JSON body (POST) or query parameters (GET)
+// and applies the resume position from Last-Event-ID
+func parseStreamRequest(r *http.Request) (service.PullDocumentsRequest, error) {
+	var req service.PullDocumentsRequest
+	query := r.URL.Query()
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, fmt.Errorf("invalid request body: %w", err)
+		}
+	} else {
+		req.Collections = splitList(query.Get("collections"))
+		req.GroupIDs = splitList(query.Get("group_ids"))
+		for _, param := range query["checkpoint"] {
+			collection, value, ok := strings.Cut(param, ":")
+			if !ok {
+				return req, fmt.Errorf("invalid checkpoint %q (expected collection:cursor)", param)
+			}
+			cursor, err := database.ParseCursor(value)
+			if err != nil {
+				return req, fmt.Errorf("invalid checkpoint for %s: %w", collection, err)
+			}
+			if req.Checkpoint == nil {
+				req.Checkpoint = make(map[string]database.Cursor)
+			}
+			req.Checkpoint[collection] = cursor
+		}
+		if limit := query.Get("limit"); limit != "" {
+			n, err := strconv.Atoi(limit)
+			if err != nil {
+				return req, fmt.Errorf("invalid limit: %w", err)
+			}
+			req.Limit = n
+		}
+	}
+	if len(req.Collections) == 0 {
+		return req, fmt.Errorf("collections array cannot be empty")
+	}
 
-	log := h.sosLogs[deviceID]
-	var filtered []time.Time
-	for _, ts := range log {
-		if ts.After(windowStart) {
-			filtered = append(filtered, ts)
+	// The last event ID the client saw overrides the checkpoints it was started with
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("last_event_id")
+	}
+	if lastEventID != "" {
+		resumed, err := service.ParseStreamCheckpoint(lastEventID)
+		if err != nil {
+			return req, err
+		}
+		if req.Checkpoint == nil {
+			req.Checkpoint = make(map[string]database.Cursor)
+		}
+		for collection, cursor := range resumed {
+			req.Checkpoint[collection] = cursor
 		}
 	}
 
-	if len(filtered)+count > maxSOSPerHour {
-		return false
+	return req, nil
+}
+
+// writeStreamEvent writes a single Server-Sent Event. Heartbeats are written as comments,
+// which keep the connection open without reaching the client's event handlers.
+func writeStreamEvent(w io.Writer, event service.StreamEvent) error {
+	if event.Event == service.StreamEventHeartbeat {
+		_, err := io.WriteString(w, ": heartbeat\n\n")
+		return err
 	}
 
-	for i := 0; i < count; i++ {
-		filtered = append(filtered, now)
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to encode stream event: %w", err)
+	}
+	if event.ID != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", event.ID); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data)
+	return err
+}
+
+// splitList splits a comma-separated query parameter, ignoring empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	h.sosLogs[deviceID] = filtered
-	return true
+	return items
 }
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"nearby-msg/api/internal/domain"
+	"nearby-msg/api/internal/service"
+)
+
+// SOSHandler handles SOS incident requests
+type SOSHandler struct {
+	sosService *service.SOSService
+	wsService  *service.WebSocketService
+}
+
+// NewSOSHandler creates a new SOS handler
+func NewSOSHandler(sosService *service.SOSService, wsService *service.WebSocketService) *SOSHandler {
+	return &SOSHandler{
+		sosService: sosService,
+		wsService:  wsService,
+	}
+}
+
+// HandleSOSRoutes routes /sos/{id} (GET, PATCH) and /sos/{id}/responders (POST, DELETE).
+// An incident's ID is its SOS message's ID.
+func (h *SOSHandler) HandleSOSRoutes(w http.ResponseWriter, r *http.Request) {
+	// Extract incident ID from path: /v1/sos/{id}[/responders]
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	var incidentID string
+	var subRoute string
+	for i, part := range pathParts {
+		if part == "sos" && i+1 < len(pathParts) {
+			incidentID = pathParts[i+1]
+			if i+2 < len(pathParts) {
+				subRoute = strings.Join(pathParts[i+2:], "/")
+			}
+			break
+		}
+	}
+
+	if incidentID == "" {
+		WriteError(w, fmt.Errorf("SOS incident ID required"), http.StatusBadRequest)
+		return
+	}
+
+	switch subRoute {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			h.GetIncident(w, r, incidentID)
+		case http.MethodPatch:
+			h.UpdateIncident(w, r, incidentID)
+		default:
+			WriteError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	case "responders":
+		switch r.Method {
+		case http.MethodPost, http.MethodDelete:
+			h.ChangeResponder(w, r, incidentID)
+		default:
+			WriteError(w, fmt.Errorf("method not allowed"), http.StatusMethodNotAllowed)
+		}
+	default:
+		WriteError(w, fmt.Errorf("not found"), http.StatusNotFound)
+	}
+}
+
+// GetIncident handles GET /sos/{id}
+func (h *SOSHandler) GetIncident(w http.ResponseWriter, r *http.Request, incidentID string) {
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	incident, err := h.sosService.GetIncident(r.Context(), deviceID, incidentID)
+	if err != nil {
+		writeSOSError(w, err)
+		return
+	}
+
+	WriteJSON(w, http.StatusOK, incident)
+}
+
+// UpdateIncident handles PATCH /sos/{id}, moving the incident to the state in the body
+func (h *SOSHandler) UpdateIncident(w http.ResponseWriter, r *http.Request, incidentID string) {
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		State domain.SOSState `json:"state"`
+	}
+	if err := DecodeJSON(w, r, &req); err != nil {
+		return
+	}
+
+	change, err := h.sosService.Transition(r.Context(), deviceID, incidentID, req.State)
+	if err != nil {
+		writeSOSError(w, err)
+		return
+	}
+
+	if change.Changed {
+		h.wsService.BroadcastToGroup(change.Incident.GroupID, service.SOSIncidentFrame(change.Incident, deviceID))
+	}
+
+	WriteJSON(w, http.StatusOK, change)
+}
+
+// ChangeResponder handles POST /sos/{id}/responders (claim) and DELETE /sos/{id}/responders
+// (release) for the calling device
+func (h *SOSHandler) ChangeResponder(w http.ResponseWriter, r *http.Request, incidentID string) {
+	deviceID, ok := RequireAuth(w, r)
+	if !ok {
+		return
+	}
+
+	var change *service.SOSChange
+	var err error
+	if r.Method == http.MethodPost {
+		change, err = h.sosService.Claim(r.Context(), deviceID, incidentID)
+	} else {
+		change, err = h.sosService.Release(r.Context(), deviceID, incidentID)
+	}
+	if err != nil {
+		writeSOSError(w, err)
+		return
+	}
+
+	if change.Changed {
+		h.wsService.BroadcastToGroup(change.Incident.GroupID, service.SOSIncidentFrame(change.Incident, deviceID))
+	}
+
+	WriteJSON(w, http.StatusOK, change)
+}
+
+// writeSOSError writes the response for a failed SOS incident request
+func writeSOSError(w http.ResponseWriter, err error) {
+	if WriteAccessError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, service.ErrNotSOSResolver):
+		WriteError(w, err, http.StatusForbidden)
+	case errors.Is(err, domain.ErrInvalidSOSState):
+		WriteError(w, err, http.StatusBadRequest)
+	case errors.Is(err, domain.ErrInvalidSOSTransition), errors.Is(err, domain.ErrSOSResolved):
+		WriteError(w, err, http.StatusConflict)
+	case strings.Contains(err.Error(), "not found"):
+		WriteError(w, err, http.StatusNotFound)
+	default:
+		WriteError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -34,11 +34,16 @@ func (h *StatusHandler) UpdateStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	status, err := h.statusService.UpdateStatus(ctx, deviceID, req)
+	status, conflict, err := h.statusService.UpdateStatus(ctx, deviceID, req)
 	if err != nil {
 		WriteError(w, err, http.StatusBadRequest)
 		return
 	}
+	if conflict != nil && conflict.Resolution == service.ConflictResolutionRejected {
+		// Stale base revision: return the current status so the client can reconcile
+		WriteJSON(w, http.StatusConflict, conflict)
+		return
+	}
 
 	WriteJSON(w, http.StatusOK, status)
 }
@@ -6,10 +6,11 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"strings"
+	"strconv"
 	"time"
 
 	"nearby-msg/api/internal/infrastructure/auth"
+	"nearby-msg/api/internal/protocol"
 	"nearby-msg/api/internal/service"
 	"nearby-msg/api/internal/utils"
 
@@ -41,17 +42,7 @@ func NewWebSocketHandler(wsService *service.WebSocketService) *WebSocketHandler
 // HandleWebSocket handles WebSocket upgrade and connection
 func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Extract token from query parameter or Authorization header
-	token := r.URL.Query().Get("token")
-	if token == "" {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader != "" {
-			parts := strings.Split(authHeader, " ")
-			if len(parts) == 2 && parts[0] == "Bearer" {
-				token = parts[1]
-			}
-		}
-	}
-
+	token := BearerToken(r)
 	if token == "" {
 		http.Error(w, "Authorization token required", http.StatusUnauthorized)
 		return
@@ -64,6 +55,21 @@ func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Negotiate protocol version (optional ?protocolVersion=N query parameter)
+	var requestedVersion int
+	if v := r.URL.Query().Get("protocolVersion"); v != "" {
+		requestedVersion, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid protocolVersion", http.StatusBadRequest)
+			return
+		}
+	}
+	protocolVersion, err := protocol.Negotiate(requestedVersion)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Upgrade connection to WebSocket
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -84,12 +90,13 @@ func (h *WebSocketHandler) HandleWebSocket(w http.ResponseWriter, r *http.Reques
 
 	// Create client
 	client := &service.Client{
-		ID:            clientID,
-		DeviceID:      deviceID,
-		Conn:          &websocketConn{conn: conn},
-		Subscriptions: make(map[string]bool),
-		Send:          make(chan service.WebSocketMessage, 256),
-		LastPing:      time.Now(),
+		ID:              clientID,
+		DeviceID:        deviceID,
+		Conn:            &websocketConn{conn: conn},
+		Subscriptions:   make(map[string]bool),
+		Send:            make(chan protocol.Frame, 256),
+		LastPing:        time.Now(),
+		ProtocolVersion: protocolVersion,
 	}
 
 	// Register client
@@ -190,22 +197,22 @@ func (h *WebSocketHandler) readPump(client *service.Client) {
 			continue
 		}
 
-		// Decode JSON message
-		var msg service.WebSocketMessage
+		// Decode frame envelope
+		var msg protocol.Frame
 		decoder := json.NewDecoder(reader)
 		if err := decoder.Decode(&msg); err != nil {
-			fmt.Printf("Failed to decode WebSocket message: %v\n", err)
+			errorMsg := protocol.ErrorFrame("", "", protocol.NewError(protocol.CodeInvalidFrame, "invalid frame: %v", err))
+			select {
+			case client.Send <- errorMsg:
+			default:
+			}
 			continue
 		}
 
 		// Handle message
 		ctx := context.Background()
 		if err := h.wsService.HandleClientMessage(ctx, client, msg); err != nil {
-			errorMsg := service.WebSocketMessage{
-				Type:      "error",
-				Payload:   map[string]string{"error": err.Error()},
-				Timestamp: time.Now().UTC().Format(time.RFC3339),
-			}
+			errorMsg := protocol.ErrorFrame(msg.Type, msg.MessageID, err)
 			select {
 			case client.Send <- errorMsg:
 			default:
@@ -0,0 +1,23 @@
+// Package blobstore stores attachment files outside the database, on the local filesystem
+// or in an S3-compatible object store.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores opaque files by key. Keys are slash-separated paths such as
+// "attachments/{group_id}/{id}".
+type BlobStore interface {
+	// Put stores size bytes read from body under key, replacing any existing blob
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens the blob stored under key; the caller must close it
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,101 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLocalStoreRoundTrip puts, gets and deletes a blob
+func TestLocalStoreRoundTrip(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	key := "attachments/g1/a1"
+	content := []byte("voice note")
+
+	if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "audio/webm"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Get returned %q, want %q", got, content)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+}
+
+// TestLocalStoreRejectsEscapingKeys checks keys can't read, write or delete files outside the root
+func TestLocalStoreRejectsEscapingKeys(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "blobs")
+	store, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file next to the root that a traversal would reach
+	outside := filepath.Join(parent, "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	keys := []string{
+		"../secret",
+		"attachments/../../secret",
+		"/etc/passwd",
+		filepath.Join(parent, "secret"),
+		"attachments/./a1",
+		"attachments//a1",
+		"attachments/a1/",
+		".",
+		"",
+	}
+	for _, key := range keys {
+		content := []byte("overwritten")
+		if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), ""); err == nil {
+			t.Errorf("Put(%q) succeeded, want an invalid key error", key)
+		}
+		if body, err := store.Get(ctx, key); err == nil {
+			body.Close()
+			t.Errorf("Get(%q) succeeded, want an invalid key error", key)
+		} else if !strings.Contains(err.Error(), "invalid blob key") {
+			t.Errorf("Get(%q): err = %v, want an invalid key error", key, err)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) succeeded, want an invalid key error", key)
+		}
+	}
+
+	data, err := os.ReadFile(outside)
+	if err != nil {
+		t.Fatalf("file outside the root is gone: %v", err)
+	}
+	if string(data) != "secret" {
+		t.Errorf("file outside the root was overwritten: %q", data)
+	}
+}
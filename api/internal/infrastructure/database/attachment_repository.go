@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// attachmentColumns are the columns scanned by scanAttachment
+const attachmentColumns = `id, group_id, device_id, message_id, kind, mime_type, size_bytes,
+		       width, height, storage_key, created_at, updated_at`
+
+// AttachmentRepository handles attachment metadata; the files themselves live in a blob store
+type AttachmentRepository struct {
+	db Querier
+}
+
+// NewAttachmentRepository creates a new attachment repository
+func NewAttachmentRepository(pool *Pool) *AttachmentRepository {
+	return &AttachmentRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *AttachmentRepository) WithQuerier(q Querier) *AttachmentRepository {
+	return &AttachmentRepository{db: q}
+}
+
+// Create records an uploaded attachment that hasn't been sent with a message yet
+func (r *AttachmentRepository) Create(ctx context.Context, attachment *domain.Attachment) error {
+	query := `
+		INSERT INTO attachments (
+			id, group_id, device_id, kind, mime_type, size_bytes,
+			width, height, storage_key, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)
+	`
+	_, err := r.db.Exec(ctx, query,
+		attachment.ID,
+		attachment.GroupID,
+		attachment.DeviceID,
+		string(attachment.Kind),
+		attachment.MimeType,
+		attachment.SizeBytes,
+		attachment.Width,
+		attachment.Height,
+		attachment.StorageKey,
+		attachment.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	attachment.UpdatedAt = attachment.CreatedAt
+	return nil
+}
+
+// GetByID retrieves an attachment by ID. Deleted attachments are not found.
+func (r *AttachmentRepository) GetByID(ctx context.Context, id string) (*domain.Attachment, error) {
+	query := `SELECT ` + attachmentColumns + ` FROM attachments WHERE id = $1 AND deleted_at IS NULL`
+	attachment, err := scanAttachment(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("attachment not found")
+		}
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// GetAttachmentsAfter retrieves live attachments sent in the given groups positioned after the
+// cursor, ordered by (updated_at, id). Uploads not yet sent with a message are left out.
+func (r *AttachmentRepository) GetAttachmentsAfter(ctx context.Context, groupIDs []string, after Cursor, limit int) ([]*domain.Attachment, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM attachments
+		WHERE deleted_at IS NULL AND message_id IS NOT NULL AND group_id = ANY($1) AND (updated_at, id) > ($2, $3)
+		ORDER BY updated_at ASC, id ASC
+		LIMIT $4
+	`
+	return r.queryAttachments(ctx, query, groupIDs, after.Time, after.ID, limit)
+}
+
+// GetDeletionsAfter retrieves IDs and timestamps of attachments in the given groups deleted after the cursor, ordered by (deleted_at, id)
+func (r *AttachmentRepository) GetDeletionsAfter(ctx context.Context, groupIDs []string, after Cursor, limit int) ([]DeletionInfo, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT id, deleted_at
+		FROM attachments
+		WHERE group_id = ANY($1) AND deleted_at IS NOT NULL AND (deleted_at, id) > ($2, $3)
+		ORDER BY deleted_at ASC, id ASC
+		LIMIT $4
+	`
+	rows, err := r.db.Query(ctx, query, groupIDs, after.Time, after.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []DeletionInfo
+	for rows.Next() {
+		var del DeletionInfo
+		if err := rows.Scan(&del.ID, &del.DeletedAt); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, del)
+	}
+
+	return deletions, rows.Err()
+}
+
+// GetExpired returns attachments whose files can be removed: deleted before deletedBefore,
+// or uploaded before unsentBefore and never sent with a message
+func (r *AttachmentRepository) GetExpired(ctx context.Context, deletedBefore, unsentBefore time.Time, limit int) ([]*domain.Attachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM attachments
+		WHERE (deleted_at IS NOT NULL AND deleted_at < $1)
+		   OR (message_id IS NULL AND deleted_at IS NULL AND created_at < $2)
+		ORDER BY created_at ASC, id ASC
+		LIMIT $3
+	`
+	return r.queryAttachments(ctx, query, deletedBefore, unsentBefore, limit)
+}
+
+// Purge hard-deletes an attachment's row once its file is gone
+func (r *AttachmentRepository) Purge(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM attachments WHERE id = $1`, id)
+	return err
+}
+
+func (r *AttachmentRepository) queryAttachments(ctx context.Context, query string, args ...interface{}) ([]*domain.Attachment, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []*domain.Attachment
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, rows.Err()
+}
+
+// scanAttachment scans a row selected with attachmentColumns
+func scanAttachment(row pgx.Row) (*domain.Attachment, error) {
+	var attachment domain.Attachment
+	var kind string
+	if err := row.Scan(
+		&attachment.ID,
+		&attachment.GroupID,
+		&attachment.DeviceID,
+		&attachment.MessageID,
+		&kind,
+		&attachment.MimeType,
+		&attachment.SizeBytes,
+		&attachment.Width,
+		&attachment.Height,
+		&attachment.StorageKey,
+		&attachment.CreatedAt,
+		&attachment.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	attachment.Kind = domain.AttachmentKind(kind)
+	return &attachment, nil
+}
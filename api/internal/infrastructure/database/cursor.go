@@ -0,0 +1,121 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor is a keyset position in a replication stream: the sort timestamp and ID of the
+// last row a client has seen. Ordering by (timestamp, id) keeps pagination exact even when
+// many rows share one timestamp (e.g. a batch insert).
+//
+// Cursors are exchanged with clients as opaque strings. A plain RFC3339 timestamp is also
+// accepted for checkpoints issued before cursors existed; it has an empty ID, so rows at
+// exactly that timestamp are sent again rather than skipped.
+type Cursor struct {
+	Time time.Time
+	ID   string
+}
+
+// NewCursor creates a cursor positioned at the given row
+func NewCursor(t time.Time, id string) Cursor {
+	return Cursor{Time: t.UTC(), ID: id}
+}
+
+// IsZero reports whether the cursor is unset
+func (c Cursor) IsZero() bool {
+	return c.Time.IsZero() && c.ID == ""
+}
+
+// After reports whether c is positioned after other
+func (c Cursor) After(other Cursor) bool {
+	if c.Time.Equal(other.Time) {
+		return c.ID > other.ID
+	}
+	return c.Time.After(other.Time)
+}
+
+// Encode returns the opaque string form of the cursor
+func (c Cursor) Encode() string {
+	raw := c.Time.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor decodes an opaque cursor, or a legacy RFC3339 timestamp checkpoint
+func ParseCursor(s string) (Cursor, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return Cursor{Time: t.UTC()}, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor: %s", s)
+	}
+	timePart, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return Cursor{}, fmt.Errorf("invalid cursor: %s", s)
+	}
+	t, err := time.Parse(time.RFC3339Nano, timePart)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor: %s", s)
+	}
+	return Cursor{Time: t.UTC(), ID: id}, nil
+}
+
+// MarshalJSON encodes the cursor as an opaque string
+func (c Cursor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.Encode())
+}
+
+// UnmarshalJSON accepts an opaque cursor or a legacy timestamp string
+func (c *Cursor) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("cursor must be a string: %w", err)
+	}
+	cursor, err := ParseCursor(s)
+	if err != nil {
+		return err
+	}
+	*c = cursor
+	return nil
+}
+
+// SearchCursor is a keyset position in search results, which are ordered by
+// (rank DESC, created_at DESC, id DESC)
+type SearchCursor struct {
+	Rank float32
+	Time time.Time
+	ID   string
+}
+
+// Encode returns the opaque string form of the search cursor
+func (c SearchCursor) Encode() string {
+	raw := strconv.FormatFloat(float64(c.Rank), 'g', -1, 32) + "|" + c.Time.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseSearchCursor decodes an opaque search cursor
+func ParseSearchCursor(s string) (SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return SearchCursor{}, fmt.Errorf("invalid cursor: %s", s)
+	}
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 {
+		return SearchCursor{}, fmt.Errorf("invalid cursor: %s", s)
+	}
+	rank, err := strconv.ParseFloat(parts[0], 32)
+	if err != nil {
+		return SearchCursor{}, fmt.Errorf("invalid cursor: %s", s)
+	}
+	t, err := time.Parse(time.RFC3339Nano, parts[1])
+	if err != nil {
+		return SearchCursor{}, fmt.Errorf("invalid cursor: %s", s)
+	}
+	return SearchCursor{Rank: float32(rank), Time: t.UTC(), ID: parts[2]}, nil
+}
@@ -12,12 +12,17 @@ import (
 
 // DeviceRepository handles device database operations
 type DeviceRepository struct {
-	pool *Pool
+	db Querier
 }
 
 // NewDeviceRepository creates a new device repository
 func NewDeviceRepository(pool *Pool) *DeviceRepository {
-	return &DeviceRepository{pool: pool}
+	return &DeviceRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *DeviceRepository) WithQuerier(q Querier) *DeviceRepository {
+	return &DeviceRepository{db: q}
 }
 
 // Create creates a new device
@@ -27,7 +32,7 @@ func (r *DeviceRepository) Create(ctx context.Context, device *domain.Device) er
 		VALUES ($1, $2, $3, $4, $5)
 	`
 	now := time.Now()
-	_, err := r.pool.Exec(ctx, query,
+	_, err := r.db.Exec(ctx, query,
 		device.ID,
 		device.Nickname,
 		device.PublicKey,
@@ -51,7 +56,7 @@ func (r *DeviceRepository) GetByID(ctx context.Context, id string) (*domain.Devi
 	`
 	var device domain.Device
 	var publicKey *string
-	err := r.pool.QueryRow(ctx, query, id).Scan(
+	err := r.db.QueryRow(ctx, query, id).Scan(
 		&device.ID,
 		&device.Nickname,
 		&publicKey,
@@ -68,6 +73,29 @@ func (r *DeviceRepository) GetByID(ctx context.Context, id string) (*domain.Devi
 	return &device, nil
 }
 
+// GetNicknames returns device ID -> nickname for the given devices; unknown IDs are left out
+func (r *DeviceRepository) GetNicknames(ctx context.Context, ids []string) (map[string]string, error) {
+	nicknames := make(map[string]string, len(ids))
+	if len(ids) == 0 {
+		return nicknames, nil
+	}
+
+	rows, err := r.db.Query(ctx, `SELECT id, nickname FROM devices WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, nickname string
+		if err := rows.Scan(&id, &nickname); err != nil {
+			return nil, err
+		}
+		nicknames[id] = nickname
+	}
+	return nicknames, rows.Err()
+}
+
 // UpdateNickname updates a device's nickname
 func (r *DeviceRepository) UpdateNickname(ctx context.Context, id string, nickname string) error {
 	query := `
@@ -75,7 +103,7 @@ func (r *DeviceRepository) UpdateNickname(ctx context.Context, id string, nickna
 		SET nickname = $1, updated_at = NOW()
 		WHERE id = $2
 	`
-	result, err := r.pool.Exec(ctx, query, nickname, id)
+	result, err := r.db.Exec(ctx, query, nickname, id)
 	if err != nil {
 		return err
 	}
@@ -88,7 +116,7 @@ func (r *DeviceRepository) UpdateNickname(ctx context.Context, id string, nickna
 // Delete removes a device by ID (hard delete)
 func (r *DeviceRepository) Delete(ctx context.Context, id string) error {
 	query := `DELETE FROM devices WHERE id = $1`
-	result, err := r.pool.Exec(ctx, query, id)
+	result, err := r.db.Exec(ctx, query, id)
 	if err != nil {
 		return err
 	}
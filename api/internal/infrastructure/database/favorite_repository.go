@@ -13,12 +13,17 @@ import (
 
 // FavoriteRepository handles favorite group database operations
 type FavoriteRepository struct {
-	pool *Pool
+	db Querier
 }
 
 // NewFavoriteRepository creates a new favorite repository
 func NewFavoriteRepository(pool *Pool) *FavoriteRepository {
-	return &FavoriteRepository{pool: pool}
+	return &FavoriteRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *FavoriteRepository) WithQuerier(q Querier) *FavoriteRepository {
+	return &FavoriteRepository{db: q}
 }
 
 // Create creates a new favorite group record
@@ -28,7 +33,7 @@ func (r *FavoriteRepository) Create(ctx context.Context, favorite *domain.Favori
 		VALUES ($1, $2, $3, $4)
 	`
 	now := time.Now()
-	_, err := r.pool.Exec(ctx, query,
+	_, err := r.db.Exec(ctx, query,
 		favorite.ID,
 		favorite.DeviceID,
 		favorite.GroupID,
@@ -54,7 +59,7 @@ func (r *FavoriteRepository) Delete(ctx context.Context, deviceID, groupID strin
 		WHERE device_id = $2 AND group_id = $3 AND deleted_at IS NULL
 	`
 	now := time.Now()
-	result, err := r.pool.Exec(ctx, query, now, deviceID, groupID)
+	result, err := r.db.Exec(ctx, query, now, deviceID, groupID)
 	if err != nil {
 		return err
 	}
@@ -72,7 +77,7 @@ func (r *FavoriteRepository) GetByDeviceID(ctx context.Context, deviceID string)
 		WHERE device_id = $1
 		ORDER BY created_at DESC
 	`
-	rows, err := r.pool.Query(ctx, query, deviceID)
+	rows, err := r.db.Query(ctx, query, deviceID)
 	if err != nil {
 		return nil, err
 	}
@@ -95,16 +100,43 @@ func (r *FavoriteRepository) GetByDeviceID(ctx context.Context, deviceID string)
 	return favorites, rows.Err()
 }
 
-// GetDeletionsAfter retrieves IDs and timestamps of favorites deleted after a given timestamp for a device
-func (r *FavoriteRepository) GetDeletionsAfter(ctx context.Context, deviceID string, since time.Time, limit int) ([]DeletionInfo, error) {
+// GetActiveGroupIDs retrieves the IDs of the groups a device currently favorites
+// Excludes removed favorites (deleted_at IS NULL)
+func (r *FavoriteRepository) GetActiveGroupIDs(ctx context.Context, deviceID string) ([]string, error) {
+	query := `
+		SELECT group_id
+		FROM favorite_groups
+		WHERE device_id = $1 AND deleted_at IS NULL
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.Query(ctx, query, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groupIDs []string
+	for rows.Next() {
+		var groupID string
+		if err := rows.Scan(&groupID); err != nil {
+			return nil, err
+		}
+		groupIDs = append(groupIDs, groupID)
+	}
+
+	return groupIDs, rows.Err()
+}
+
+// GetDeletionsAfter retrieves IDs and timestamps of favorites deleted for a device after the cursor, ordered by (deleted_at, id)
+func (r *FavoriteRepository) GetDeletionsAfter(ctx context.Context, deviceID string, after Cursor, limit int) ([]DeletionInfo, error) {
 	query := `
 		SELECT id, deleted_at
 		FROM favorite_groups
-		WHERE deleted_at > $1 AND deleted_at IS NOT NULL AND device_id = $2
-		ORDER BY deleted_at ASC
-		LIMIT $3
+		WHERE device_id = $1 AND deleted_at IS NOT NULL AND (deleted_at, id) > ($2, $3)
+		ORDER BY deleted_at ASC, id ASC
+		LIMIT $4
 	`
-	rows, err := r.pool.Query(ctx, query, since, deviceID, limit)
+	rows, err := r.db.Query(ctx, query, deviceID, after.Time, after.ID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -131,7 +163,7 @@ func (r *FavoriteRepository) GetByDeviceAndGroup(ctx context.Context, deviceID,
 		LIMIT 1
 	`
 	var favorite domain.FavoriteGroup
-	err := r.pool.QueryRow(ctx, query, deviceID, groupID).Scan(
+	err := r.db.QueryRow(ctx, query, deviceID, groupID).Scan(
 		&favorite.ID,
 		&favorite.DeviceID,
 		&favorite.GroupID,
@@ -146,17 +178,17 @@ func (r *FavoriteRepository) GetByDeviceAndGroup(ctx context.Context, deviceID,
 	return &favorite, nil
 }
 
-// GetFavoritesAfter retrieves favorite groups created after a given timestamp for a device
+// GetFavoritesAfter retrieves favorite groups positioned after the cursor for a device, ordered by (created_at, id)
 // Excludes soft-deleted favorites (deleted_at IS NULL)
-func (r *FavoriteRepository) GetFavoritesAfter(ctx context.Context, deviceID string, since time.Time, limit int) ([]*domain.FavoriteGroup, error) {
+func (r *FavoriteRepository) GetFavoritesAfter(ctx context.Context, deviceID string, after Cursor, limit int) ([]*domain.FavoriteGroup, error) {
 	query := `
 		SELECT id, device_id, group_id, created_at
 		FROM favorite_groups
-		WHERE deleted_at IS NULL AND device_id = $1 AND created_at > $2
-		ORDER BY created_at ASC
-		LIMIT $3
+		WHERE deleted_at IS NULL AND device_id = $1 AND (created_at, id) > ($2, $3)
+		ORDER BY created_at ASC, id ASC
+		LIMIT $4
 	`
-	rows, err := r.pool.Query(ctx, query, deviceID, since, limit)
+	rows, err := r.db.Query(ctx, query, deviceID, after.Time, after.ID, limit)
 	if err != nil {
 		return nil, err
 	}
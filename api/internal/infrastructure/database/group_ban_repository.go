@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GroupBanRepository handles group ban database operations
+type GroupBanRepository struct {
+	db Querier
+}
+
+// NewGroupBanRepository creates a new group ban repository
+func NewGroupBanRepository(pool *Pool) *GroupBanRepository {
+	return &GroupBanRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *GroupBanRepository) WithQuerier(q Querier) *GroupBanRepository {
+	return &GroupBanRepository{db: q}
+}
+
+// Ban bans a device from a group, replacing any existing ban. The ban's created_at is set.
+// A nil ExpiresAt makes the ban permanent.
+func (r *GroupBanRepository) Ban(ctx context.Context, ban *domain.GroupBan) error {
+	query := `
+		INSERT INTO group_bans (group_id, device_id, reason, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (group_id, device_id)
+		DO UPDATE SET reason = EXCLUDED.reason, created_at = EXCLUDED.created_at, expires_at = EXCLUDED.expires_at
+	`
+	ban.CreatedAt = time.Now()
+	_, err := r.db.Exec(ctx, query, ban.GroupID, ban.DeviceID, ban.Reason, ban.CreatedAt, ban.ExpiresAt)
+	return err
+}
+
+// Unban lifts a device's ban from a group
+func (r *GroupBanRepository) Unban(ctx context.Context, groupID, deviceID string) error {
+	query := `
+		DELETE FROM group_bans
+		WHERE group_id = $1 AND device_id = $2
+	`
+	result, err := r.db.Exec(ctx, query, groupID, deviceID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return errors.New("ban not found")
+	}
+	return nil
+}
+
+// IsBanned checks if a device is currently banned from a group
+func (r *GroupBanRepository) IsBanned(ctx context.Context, groupID, deviceID string) (bool, error) {
+	query := `
+		SELECT 1
+		FROM group_bans
+		WHERE group_id = $1 AND device_id = $2
+		  AND (expires_at IS NULL OR expires_at > NOW())
+	`
+	var exists int
+	err := r.db.QueryRow(ctx, query, groupID, deviceID).Scan(&exists)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
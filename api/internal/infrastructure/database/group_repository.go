@@ -13,12 +13,17 @@ import (
 
 // GroupRepository handles group database operations
 type GroupRepository struct {
-	pool *Pool
+	db Querier
 }
 
 // NewGroupRepository creates a new group repository
 func NewGroupRepository(pool *Pool) *GroupRepository {
-	return &GroupRepository{pool: pool}
+	return &GroupRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *GroupRepository) WithQuerier(q Querier) *GroupRepository {
+	return &GroupRepository{db: q}
 }
 
 // Create creates a new group
@@ -28,7 +33,7 @@ func (r *GroupRepository) Create(ctx context.Context, group *domain.Group) error
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 	now := time.Now()
-	_, err := r.pool.Exec(ctx, query,
+	_, err := r.db.Exec(ctx, query,
 		group.ID,
 		group.Name,
 		string(group.Type),
@@ -44,20 +49,22 @@ func (r *GroupRepository) Create(ctx context.Context, group *domain.Group) error
 	}
 	group.CreatedAt = now
 	group.UpdatedAt = now
+	group.Revision = 1
 	return nil
 }
 
 // GetByID retrieves a group by ID
 func (r *GroupRepository) GetByID(ctx context.Context, id string) (*domain.Group, error) {
 	query := `
-		SELECT id, name, type, latitude, longitude, region_code, creator_device_id, created_at, updated_at
+		SELECT id, name, type, latitude, longitude, region_code, creator_device_id, created_at, updated_at,
+		       revision, field_revisions, client_updated_at
 		FROM groups
 		WHERE id = $1
 	`
 	var group domain.Group
 	var groupType string
 	var regionCode *string
-	err := r.pool.QueryRow(ctx, query, id).Scan(
+	err := r.db.QueryRow(ctx, query, id).Scan(
 		&group.ID,
 		&group.Name,
 		&groupType,
@@ -67,6 +74,9 @@ func (r *GroupRepository) GetByID(ctx context.Context, id string) (*domain.Group
 		&group.CreatorDeviceID,
 		&group.CreatedAt,
 		&group.UpdatedAt,
+		&group.Revision,
+		&group.FieldRevisions,
+		&group.ClientUpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -99,7 +109,8 @@ func (r *GroupRepository) FindNearby(
 	lonDelta := radiusMeters / (111000.0 * math.Cos(latitude*math.Pi/180.0))
 
 	query := `
-		SELECT id, name, type, latitude, longitude, region_code, creator_device_id, created_at, updated_at
+		SELECT id, name, type, latitude, longitude, region_code, creator_device_id, created_at, updated_at,
+		       revision, field_revisions, client_updated_at
 		FROM groups
 		WHERE latitude BETWEEN $1 AND $2
 		  AND longitude BETWEEN $3 AND $4
@@ -111,7 +122,7 @@ func (r *GroupRepository) FindNearby(
 	minLon := longitude - lonDelta
 	maxLon := longitude + lonDelta
 
-	rows, err := r.pool.Query(ctx, query, minLat, maxLat, minLon, maxLon)
+	rows, err := r.db.Query(ctx, query, minLat, maxLat, minLon, maxLon)
 	if err != nil {
 		return nil, err
 	}
@@ -132,6 +143,9 @@ func (r *GroupRepository) FindNearby(
 			&group.CreatorDeviceID,
 			&group.CreatedAt,
 			&group.UpdatedAt,
+			&group.Revision,
+			&group.FieldRevisions,
+			&group.ClientUpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -139,7 +153,7 @@ func (r *GroupRepository) FindNearby(
 		group.RegionCode = regionCode
 
 		// Calculate exact distance using Haversine formula
-		distance := calculateHaversineDistance(latitude, longitude, group.Latitude, group.Longitude)
+		distance := domain.DistanceMeters(latitude, longitude, group.Latitude, group.Longitude)
 
 		// Filter by exact radius
 		if distance <= radiusMeters {
@@ -153,22 +167,11 @@ func (r *GroupRepository) FindNearby(
 	return results, rows.Err()
 }
 
-// calculateHaversineDistance calculates distance between two points using Haversine formula
-func calculateHaversineDistance(lat1, lon1, lat2, lon2 float64) float64 {
-	const R = 6371000 // Earth's radius in meters
-	dLat := (lat2 - lat1) * math.Pi / 180.0
-	dLon := (lon2 - lon1) * math.Pi / 180.0
-	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
-		math.Cos(lat1*math.Pi/180.0)*math.Cos(lat2*math.Pi/180.0)*
-			math.Sin(dLon/2)*math.Sin(dLon/2)
-	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-	return R * c
-}
-
 // GetByCreatorDeviceID retrieves a group created by a device
 func (r *GroupRepository) GetByCreatorDeviceID(ctx context.Context, deviceID string) (*domain.Group, error) {
 	query := `
-		SELECT id, name, type, latitude, longitude, region_code, creator_device_id, created_at, updated_at
+		SELECT id, name, type, latitude, longitude, region_code, creator_device_id, created_at, updated_at,
+		       revision, field_revisions, client_updated_at
 		FROM groups
 		WHERE creator_device_id = $1
 		LIMIT 1
@@ -176,7 +179,7 @@ func (r *GroupRepository) GetByCreatorDeviceID(ctx context.Context, deviceID str
 	var group domain.Group
 	var groupType string
 	var regionCode *string
-	err := r.pool.QueryRow(ctx, query, deviceID).Scan(
+	err := r.db.QueryRow(ctx, query, deviceID).Scan(
 		&group.ID,
 		&group.Name,
 		&groupType,
@@ -186,6 +189,9 @@ func (r *GroupRepository) GetByCreatorDeviceID(ctx context.Context, deviceID str
 		&group.CreatorDeviceID,
 		&group.CreatedAt,
 		&group.UpdatedAt,
+		&group.Revision,
+		&group.FieldRevisions,
+		&group.ClientUpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -198,35 +204,38 @@ func (r *GroupRepository) GetByCreatorDeviceID(ctx context.Context, deviceID str
 	return &group, nil
 }
 
-// UpdateName updates the name of a group
-func (r *GroupRepository) UpdateName(ctx context.Context, id string, name string) error {
+// UpdateName updates the name of a group if it is still at expectedRevision, bumping its revision.
+// Returns false if the group changed concurrently (or doesn't exist).
+func (r *GroupRepository) UpdateName(ctx context.Context, id string, name string, expectedRevision int64, clientUpdatedAt *time.Time) (bool, error) {
 	query := `
 		UPDATE groups
-		SET name = $1, updated_at = $2
-		WHERE id = $3
+		SET name = $1,
+		    updated_at = $2,
+		    revision = revision + 1,
+		    field_revisions = field_revisions || jsonb_build_object('name', revision + 1),
+		    client_updated_at = $3
+		WHERE id = $4 AND revision = $5
 	`
 	now := time.Now()
-	result, err := r.pool.Exec(ctx, query, name, now, id)
+	result, err := r.db.Exec(ctx, query, name, now, clientUpdatedAt, id, expectedRevision)
 	if err != nil {
-		return err
-	}
-	if result.RowsAffected() == 0 {
-		return errors.New("group not found")
+		return false, err
 	}
-	return nil
+	return result.RowsAffected() == 1, nil
 }
 
-// GetGroupsAfter retrieves groups updated after a given timestamp
+// GetGroupsAfter retrieves groups positioned after the cursor, ordered by (updated_at, id)
 // Excludes soft-deleted groups (deleted_at IS NULL)
-func (r *GroupRepository) GetGroupsAfter(ctx context.Context, since time.Time, limit int) ([]*domain.Group, error) {
+func (r *GroupRepository) GetGroupsAfter(ctx context.Context, after Cursor, limit int) ([]*domain.Group, error) {
 	query := `
-		SELECT id, name, type, latitude, longitude, region_code, creator_device_id, created_at, updated_at
+		SELECT id, name, type, latitude, longitude, region_code, creator_device_id, created_at, updated_at,
+		       revision, field_revisions, client_updated_at
 		FROM groups
-		WHERE deleted_at IS NULL AND updated_at > $1
-		ORDER BY updated_at ASC
-		LIMIT $2
+		WHERE deleted_at IS NULL AND (updated_at, id) > ($1, $2)
+		ORDER BY updated_at ASC, id ASC
+		LIMIT $3
 	`
-	rows, err := r.pool.Query(ctx, query, since, limit)
+	rows, err := r.db.Query(ctx, query, after.Time, after.ID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -247,6 +256,9 @@ func (r *GroupRepository) GetGroupsAfter(ctx context.Context, since time.Time, l
 			&group.CreatorDeviceID,
 			&group.CreatedAt,
 			&group.UpdatedAt,
+			&group.Revision,
+			&group.FieldRevisions,
+			&group.ClientUpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -258,16 +270,16 @@ func (r *GroupRepository) GetGroupsAfter(ctx context.Context, since time.Time, l
 	return groups, rows.Err()
 }
 
-// GetDeletionsAfter retrieves IDs and timestamps of groups deleted after a given timestamp
-func (r *GroupRepository) GetDeletionsAfter(ctx context.Context, since time.Time, limit int) ([]DeletionInfo, error) {
+// GetDeletionsAfter retrieves IDs and timestamps of groups deleted after the cursor, ordered by (deleted_at, id)
+func (r *GroupRepository) GetDeletionsAfter(ctx context.Context, after Cursor, limit int) ([]DeletionInfo, error) {
 	query := `
 		SELECT id, deleted_at
 		FROM groups
-		WHERE deleted_at > $1 AND deleted_at IS NOT NULL
-		ORDER BY deleted_at ASC
-		LIMIT $2
+		WHERE deleted_at IS NOT NULL AND (deleted_at, id) > ($1, $2)
+		ORDER BY deleted_at ASC, id ASC
+		LIMIT $3
 	`
-	rows, err := r.pool.Query(ctx, query, since, limit)
+	rows, err := r.db.Query(ctx, query, after.Time, after.ID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -284,3 +296,63 @@ func (r *GroupRepository) GetDeletionsAfter(ctx context.Context, since time.Time
 
 	return deletions, rows.Err()
 }
+
+// GetDeletedAt reports whether a group exists and, if it was soft-deleted, when.
+// deletedAt is nil for a live group.
+func (r *GroupRepository) GetDeletedAt(ctx context.Context, id string) (exists bool, deletedAt *time.Time, err error) {
+	query := `
+		SELECT deleted_at
+		FROM groups
+		WHERE id = $1
+	`
+	err = r.db.QueryRow(ctx, query, id).Scan(&deletedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, deletedAt, nil
+}
+
+// GetRelevantGroupIDs returns the IDs of live groups a device takes part in: groups it has
+// favorited, created or posted in. Groups the device is currently banned from are excluded.
+func (r *GroupRepository) GetRelevantGroupIDs(ctx context.Context, deviceID string) ([]string, error) {
+	query := `
+		SELECT g.id
+		FROM groups g
+		WHERE g.deleted_at IS NULL
+		  AND (
+		    g.creator_device_id = $1
+		    OR EXISTS (
+		      SELECT 1 FROM favorite_groups f
+		      WHERE f.group_id = g.id AND f.device_id = $1 AND f.deleted_at IS NULL
+		    )
+		    OR EXISTS (
+		      SELECT 1 FROM messages m
+		      WHERE m.group_id = g.id AND m.device_id = $1
+		    )
+		  )
+		  AND NOT EXISTS (
+		    SELECT 1 FROM group_bans b
+		    WHERE b.group_id = g.id AND b.device_id = $1
+		      AND (b.expires_at IS NULL OR b.expires_at > NOW())
+		  )
+	`
+	rows, err := r.db.Query(ctx, query, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groupIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		groupIDs = append(groupIDs, id)
+	}
+
+	return groupIDs, rows.Err()
+}
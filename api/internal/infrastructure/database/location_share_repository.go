@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// locationShareColumns are the columns scanned by scanLocationShare
+const locationShareColumns = `id, device_id, group_id, message_id, latitude, longitude, accuracy,
+		       started_at, expires_at, updated_at`
+
+// LocationShareRepository handles live location shares
+type LocationShareRepository struct {
+	db Querier
+}
+
+// NewLocationShareRepository creates a new location share repository
+func NewLocationShareRepository(pool *Pool) *LocationShareRepository {
+	return &LocationShareRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *LocationShareRepository) WithQuerier(q Querier) *LocationShareRepository {
+	return &LocationShareRepository{db: q}
+}
+
+// Upsert stores a device's share in a group, replacing its previous one. The share's ID is
+// updated to the stored row's.
+func (r *LocationShareRepository) Upsert(ctx context.Context, share *domain.LocationShare) error {
+	query := `
+		INSERT INTO location_shares (
+			id, device_id, group_id, message_id, latitude, longitude, accuracy,
+			started_at, expires_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (device_id, group_id) DO UPDATE
+		SET message_id = EXCLUDED.message_id,
+		    latitude = EXCLUDED.latitude,
+		    longitude = EXCLUDED.longitude,
+		    accuracy = EXCLUDED.accuracy,
+		    started_at = EXCLUDED.started_at,
+		    expires_at = EXCLUDED.expires_at,
+		    updated_at = EXCLUDED.updated_at,
+		    end_announced = FALSE
+		RETURNING id
+	`
+	return r.db.QueryRow(ctx, query,
+		share.ID,
+		share.DeviceID,
+		share.GroupID,
+		share.MessageID,
+		share.Latitude,
+		share.Longitude,
+		share.Accuracy,
+		share.StartedAt,
+		share.ExpiresAt,
+		share.UpdatedAt,
+	).Scan(&share.ID)
+}
+
+// GetActive retrieves a device's share in a group if it is still active at the given time
+func (r *LocationShareRepository) GetActive(ctx context.Context, deviceID, groupID string, now time.Time) (*domain.LocationShare, error) {
+	query := `
+		SELECT ` + locationShareColumns + `
+		FROM location_shares
+		WHERE device_id = $1 AND group_id = $2 AND expires_at > $3
+	`
+	share, err := scanLocationShare(r.db.QueryRow(ctx, query, deviceID, groupID, now))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("location share not found")
+		}
+		return nil, err
+	}
+	return share, nil
+}
+
+// GetActiveByGroup retrieves the shares in a group still active at the given time
+func (r *LocationShareRepository) GetActiveByGroup(ctx context.Context, groupID string, now time.Time) ([]*domain.LocationShare, error) {
+	query := `
+		SELECT ` + locationShareColumns + `
+		FROM location_shares
+		WHERE group_id = $1 AND expires_at > $2
+		ORDER BY updated_at DESC, id ASC
+	`
+	rows, err := r.db.Query(ctx, query, groupID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []*domain.LocationShare
+	for rows.Next() {
+		share, err := scanLocationShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+// End expires a device's active share in a group at the given time, marking its end announced
+// since the caller broadcasts it. Returns false if there was none.
+func (r *LocationShareRepository) End(ctx context.Context, deviceID, groupID string, now time.Time) (bool, error) {
+	query := `
+		UPDATE location_shares
+		SET expires_at = $3, updated_at = $3, end_announced = TRUE
+		WHERE device_id = $1 AND group_id = $2 AND expires_at > $3
+	`
+	result, err := r.db.Exec(ctx, query, deviceID, groupID, now)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// ClaimExpired marks up to limit shares that expired by the given time as announced and returns
+// them, so each expiry is announced by exactly one instance
+func (r *LocationShareRepository) ClaimExpired(ctx context.Context, now time.Time, limit int) ([]*domain.LocationShare, error) {
+	query := `
+		UPDATE location_shares
+		SET end_announced = TRUE
+		WHERE id IN (
+			SELECT id FROM location_shares
+			WHERE NOT end_announced AND expires_at <= $1
+			ORDER BY expires_at ASC
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + locationShareColumns + `
+	`
+	rows, err := r.db.Query(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shares []*domain.LocationShare
+	for rows.Next() {
+		share, err := scanLocationShare(rows)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+// scanLocationShare scans a row selected with locationShareColumns
+func scanLocationShare(row pgx.Row) (*domain.LocationShare, error) {
+	var share domain.LocationShare
+	if err := row.Scan(
+		&share.ID,
+		&share.DeviceID,
+		&share.GroupID,
+		&share.MessageID,
+		&share.Latitude,
+		&share.Longitude,
+		&share.Accuracy,
+		&share.StartedAt,
+		&share.ExpiresAt,
+		&share.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
@@ -3,6 +3,9 @@ package database
 import (
 	"context"
 	"errors"
+	"fmt"
+	"html"
+	"strings"
 	"time"
 
 	"nearby-msg/api/internal/domain"
@@ -16,41 +19,92 @@ const (
 	checkpointCollection  = "messages"
 )
 
+// Search matches are delimited with these control characters in ts_headline's output, which
+// are stripped from the content beforehand so a message can't forge a match
+const (
+	searchMatchStart = "\x02"
+	searchMatchStop  = "\x03"
+)
+
+// searchHighlighter HTML-escapes a ts_headline excerpt and wraps its matches in <mark></mark>
+var searchHighlighter = strings.NewReplacer(searchMatchStart, "<mark>", searchMatchStop, "</mark>")
+
+// ErrAttachmentsUnavailable is returned when a message lists attachments that aren't the sender's
+// unsent uploads to the message's group
+var ErrAttachmentsUnavailable = errors.New("attachments not found or already sent")
+
 // MessageRepository handles persistence of chat messages and replication checkpoints.
 type MessageRepository struct {
-	pool *Pool
+	db Querier
 }
 
 // NewMessageRepository creates a new message repository.
 func NewMessageRepository(pool *Pool) *MessageRepository {
-	return &MessageRepository{pool: pool}
+	return &MessageRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *MessageRepository) WithQuerier(q Querier) *MessageRepository {
+	return &MessageRepository{db: q}
 }
 
-// InsertMessages inserts multiple messages in a single transaction.
+// InsertMessages inserts multiple messages in a single transaction, attaching each message's
+// uploads to it and opening an SOS incident for each SOS message. Returns
+// ErrAttachmentsUnavailable, storing nothing, if any can't be attached.
 func (r *MessageRepository) InsertMessages(ctx context.Context, messages []*domain.Message) error {
 	if len(messages) == 0 {
 		return nil
 	}
 
-	tx, err := r.pool.Begin(ctx)
+	tx, err := r.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
+	// A new reply changes its parent's reply count, so the parent is pulled again
 	query := `
-		INSERT INTO messages (
-			id, group_id, device_id, content, message_type, sos_type,
-			tags, pinned, created_at, device_sequence, synced_at
-		) VALUES (
-			$1, $2, $3, $4, $5, $6,
-			$7, $8, $9, $10, $11
+		WITH inserted AS (
+			INSERT INTO messages (
+				id, group_id, device_id, content, message_type, sos_type,
+				tags, pinned, created_at, device_sequence, synced_at, reply_to_id,
+				attachment_ids, latitude, longitude, accuracy
+			) VALUES (
+				$1, $2, $3, $4, $5, $6,
+				$7, $8, $9, $10, $11, $12,
+				$13, $14, $15, $16
+			)
+			ON CONFLICT (id) DO NOTHING
+			RETURNING reply_to_id
+		), parent AS (
+			UPDATE messages SET updated_at = NOW()
+			WHERE id IN (SELECT reply_to_id FROM inserted)
 		)
+		SELECT COUNT(*) FROM inserted
+	`
+
+	// Attachments must be the sender's own uploads to the same group, not yet sent with another message
+	claimQuery := `
+		UPDATE attachments
+		SET message_id = $1, updated_at = NOW()
+		WHERE id = ANY($2) AND device_id = $3 AND group_id = $4
+		  AND message_id IS NULL AND deleted_at IS NULL
+	`
+
+	// An SOS incident shares its message's ID
+	incidentQuery := `
+		INSERT INTO sos_incidents (id, group_id, device_id, state, created_at, updated_at)
+		VALUES ($1, $2, $3, 'open', NOW(), NOW())
 		ON CONFLICT (id) DO NOTHING
 	`
 
 	for _, msg := range messages {
-		_, err := tx.Exec(ctx, query,
+		attachmentIDs := msg.AttachmentIDs
+		if attachmentIDs == nil {
+			attachmentIDs = []string{}
+		}
+		var inserted int
+		err := tx.QueryRow(ctx, query,
 			msg.ID,
 			msg.GroupID,
 			msg.DeviceID,
@@ -62,31 +116,89 @@ func (r *MessageRepository) InsertMessages(ctx context.Context, messages []*doma
 			msg.CreatedAt,
 			msg.DeviceSequence,
 			msg.SyncedAt,
-		)
+			msg.ReplyToID,
+			attachmentIDs,
+			msg.Latitude,
+			msg.Longitude,
+			msg.Accuracy,
+		).Scan(&inserted)
 		if err != nil {
 			return err
 		}
+		// Already stored (a retried push): its attachments were claimed and its incident opened the first time
+		if inserted == 0 {
+			continue
+		}
+
+		if msg.MessageType == domain.MessageTypeSOS {
+			if _, err := tx.Exec(ctx, incidentQuery, msg.ID, msg.GroupID, msg.DeviceID); err != nil {
+				return err
+			}
+		}
+
+		if len(msg.AttachmentIDs) == 0 {
+			continue
+		}
+
+		claimed, err := tx.Exec(ctx, claimQuery, msg.ID, msg.AttachmentIDs, msg.DeviceID, msg.GroupID)
+		if err != nil {
+			return err
+		}
+		if claimed.RowsAffected() != int64(len(msg.AttachmentIDs)) {
+			return ErrAttachmentsUnavailable
+		}
 	}
 
 	return tx.Commit(ctx)
 }
 
-// GetByID retrieves a message by ID
+// replyColumns selects a message's reply reference, a quote of its parent and its reply count.
+// Queries using it alias the message as m and join replyJoin; the columns scan into a replyScan.
+const replyColumns = `m.reply_to_id, parent.device_id, parent.content, parent.deleted_at IS NOT NULL,
+		       (SELECT COUNT(*) FROM messages reply WHERE reply.reply_to_id = m.id AND reply.deleted_at IS NULL)`
+
+const replyJoin = `LEFT JOIN messages parent ON parent.id = m.reply_to_id`
+
+// reactionCountsColumn selects a message's live reaction counts by kind as a JSON object
+const reactionCountsColumn = `(SELECT COALESCE(jsonb_object_agg(kind, n), '{}'::jsonb)
+		        FROM (SELECT kind, COUNT(*) AS n FROM message_reactions
+		              WHERE message_id = m.id AND deleted_at IS NULL GROUP BY kind) counts)`
+
+// replyScan receives the parent columns selected by replyColumns
+type replyScan struct {
+	deviceID *string
+	content  *string
+	deleted  bool
+}
+
+// apply sets the message's quote of its parent, if it replies to one
+func (s *replyScan) apply(msg *domain.Message) {
+	if msg.ReplyToID != nil && s.deviceID != nil {
+		msg.ReplyTo = domain.NewMessageQuote(*msg.ReplyToID, *s.deviceID, *s.content, s.deleted)
+	}
+}
+
+// GetByID retrieves a message by ID. Deleted messages are not found.
 func (r *MessageRepository) GetByID(ctx context.Context, messageID string) (*domain.Message, error) {
 	query := `
-		SELECT id, group_id, device_id, content, message_type, sos_type,
-		       tags, pinned, created_at, device_sequence, synced_at
-		FROM messages
-		WHERE id = $1
+		SELECT m.id, m.group_id, m.device_id, m.content, m.message_type, m.sos_type,
+		       m.tags, m.pinned, m.created_at, m.device_sequence, m.synced_at, m.edited_at, m.updated_at, m.attachment_ids,
+		       m.latitude, m.longitude, m.accuracy,
+		       ` + replyColumns + `,
+		       ` + reactionCountsColumn + `
+		FROM messages m
+		` + replyJoin + `
+		WHERE m.id = $1 AND m.deleted_at IS NULL
 	`
 	var msg domain.Message
+	var reply replyScan
 	var messageType string
 	var tags []string
 	var deviceSequence *int
 	var syncedAt *time.Time
 	var sosType *domain.SOSType
 
-	err := r.pool.QueryRow(ctx, query, messageID).Scan(
+	err := r.db.QueryRow(ctx, query, messageID).Scan(
 		&msg.ID,
 		&msg.GroupID,
 		&msg.DeviceID,
@@ -98,6 +210,18 @@ func (r *MessageRepository) GetByID(ctx context.Context, messageID string) (*dom
 		&msg.CreatedAt,
 		&deviceSequence,
 		&syncedAt,
+		&msg.EditedAt,
+		&msg.UpdatedAt,
+		&msg.AttachmentIDs,
+		&msg.Latitude,
+		&msg.Longitude,
+		&msg.Accuracy,
+		&msg.ReplyToID,
+		&reply.deviceID,
+		&reply.content,
+		&reply.deleted,
+		&msg.ReplyCount,
+		&msg.Reactions,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -111,25 +235,34 @@ func (r *MessageRepository) GetByID(ctx context.Context, messageID string) (*dom
 	msg.DeviceSequence = deviceSequence
 	msg.SOSType = sosType
 	msg.SyncedAt = syncedAt
+	reply.apply(&msg)
 	return &msg, nil
 }
 
-// GetMessagesAfter returns messages created after the given timestamp.
-func (r *MessageRepository) GetMessagesAfter(ctx context.Context, since time.Time, limit int) ([]*domain.Message, error) {
+// GetMessagesAfter returns messages in the given groups positioned after the cursor, ordered by
+// (updated_at, id), so changed messages are returned again (see Message.ChangedAt).
+func (r *MessageRepository) GetMessagesAfter(ctx context.Context, groupIDs []string, after Cursor, limit int) ([]*domain.Message, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
 	if limit <= 0 || limit > 500 {
 		limit = defaultMessageLimit
 	}
 
 	query := `
-		SELECT id, group_id, device_id, content, message_type, sos_type,
-		       tags, pinned, created_at, device_sequence, synced_at
-		FROM messages
-		WHERE deleted_at IS NULL AND created_at > $1
-		ORDER BY created_at ASC, id ASC
-		LIMIT $2
+		SELECT m.id, m.group_id, m.device_id, m.content, m.message_type, m.sos_type,
+		       m.tags, m.pinned, m.created_at, m.device_sequence, m.synced_at, m.edited_at, m.updated_at, m.attachment_ids,
+		       m.latitude, m.longitude, m.accuracy,
+		       ` + replyColumns + `,
+		       ` + reactionCountsColumn + `
+		FROM messages m
+		` + replyJoin + `
+		WHERE m.deleted_at IS NULL AND m.group_id = ANY($1) AND (m.updated_at, m.id) > ($2, $3)
+		ORDER BY m.updated_at ASC, m.id ASC
+		LIMIT $4
 	`
 
-	rows, err := r.pool.Query(ctx, query, since, limit)
+	rows, err := r.db.Query(ctx, query, groupIDs, after.Time, after.ID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -143,6 +276,7 @@ func (r *MessageRepository) GetMessagesAfter(ctx context.Context, since time.Tim
 		var deviceSequence *int
 		var syncedAt *time.Time
 		var sosType *domain.SOSType
+		var reply replyScan
 
 		if err := rows.Scan(
 			&msg.ID,
@@ -156,6 +290,18 @@ func (r *MessageRepository) GetMessagesAfter(ctx context.Context, since time.Tim
 			&msg.CreatedAt,
 			&deviceSequence,
 			&syncedAt,
+			&msg.EditedAt,
+			&msg.UpdatedAt,
+			&msg.AttachmentIDs,
+			&msg.Latitude,
+			&msg.Longitude,
+			&msg.Accuracy,
+			&msg.ReplyToID,
+			&reply.deviceID,
+			&reply.content,
+			&reply.deleted,
+			&msg.ReplyCount,
+			&msg.Reactions,
 		); err != nil {
 			return nil, err
 		}
@@ -165,14 +311,18 @@ func (r *MessageRepository) GetMessagesAfter(ctx context.Context, since time.Tim
 		msg.DeviceSequence = deviceSequence
 		msg.SOSType = sosType
 		msg.SyncedAt = syncedAt
+		reply.apply(&msg)
 		messages = append(messages, &msg)
 	}
 
 	return messages, rows.Err()
 }
 
-// GetDeletionsAfter retrieves IDs and timestamps of messages deleted after a given timestamp
-func (r *MessageRepository) GetDeletionsAfter(ctx context.Context, since time.Time, limit int) ([]DeletionInfo, error) {
+// GetDeletionsAfter retrieves IDs and timestamps of messages in the given groups deleted after the cursor, ordered by (deleted_at, id)
+func (r *MessageRepository) GetDeletionsAfter(ctx context.Context, groupIDs []string, after Cursor, limit int) ([]DeletionInfo, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
 	if limit <= 0 || limit > 500 {
 		limit = defaultMessageLimit
 	}
@@ -180,11 +330,11 @@ func (r *MessageRepository) GetDeletionsAfter(ctx context.Context, since time.Ti
 	query := `
 		SELECT id, deleted_at
 		FROM messages
-		WHERE deleted_at > $1 AND deleted_at IS NOT NULL
+		WHERE group_id = ANY($1) AND deleted_at IS NOT NULL AND (deleted_at, id) > ($2, $3)
 		ORDER BY deleted_at ASC, id ASC
-		LIMIT $2
+		LIMIT $4
 	`
-	rows, err := r.pool.Query(ctx, query, since, limit)
+	rows, err := r.db.Query(ctx, query, groupIDs, after.Time, after.ID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -202,7 +352,8 @@ func (r *MessageRepository) GetDeletionsAfter(ctx context.Context, since time.Ti
 	return deletions, rows.Err()
 }
 
-// TrimOldMessages keeps the most recent maxMessages per group.
+// TrimOldMessages keeps the most recent maxMessages per group. SOS messages whose incident is
+// not resolved yet are kept past the limit, so their incidents don't vanish with them.
 func (r *MessageRepository) TrimOldMessages(ctx context.Context, groupID string, maxMessages int) error {
 	if maxMessages <= 0 {
 		maxMessages = defaultRetentionCount
@@ -216,23 +367,444 @@ func (r *MessageRepository) TrimOldMessages(ctx context.Context, groupID string,
 			ORDER BY created_at DESC, id DESC
 			OFFSET $2
 		)
+		AND NOT EXISTS (
+			SELECT 1 FROM sos_incidents i
+			WHERE i.id = messages.id AND i.state <> 'resolved'
+		)
 	`
-	_, err := r.pool.Exec(ctx, query, groupID, maxMessages)
+	_, err := r.db.Exec(ctx, query, groupID, maxMessages)
 	return err
 }
 
 // GetCheckpoint returns the last checkpoint for a device and collection.
 // This method is kept for backward compatibility but now uses ReplicationRepository internally.
-func (r *MessageRepository) GetCheckpoint(ctx context.Context, deviceID string) (time.Time, error) {
+func (r *MessageRepository) GetCheckpoint(ctx context.Context, deviceID string) (Cursor, error) {
 	// Create a temporary ReplicationRepository to use the generic method
-	replicationRepo := NewReplicationRepository(r.pool)
+	replicationRepo := &ReplicationRepository{db: r.db}
 	return replicationRepo.GetCheckpoint(ctx, deviceID, checkpointCollection)
 }
 
 // UpsertCheckpoint updates the last checkpoint for a device and collection.
 // This method is kept for backward compatibility but now uses ReplicationRepository internally.
-func (r *MessageRepository) UpsertCheckpoint(ctx context.Context, deviceID string, checkpoint time.Time) error {
+func (r *MessageRepository) UpsertCheckpoint(ctx context.Context, deviceID string, checkpoint Cursor) error {
 	// Create a temporary ReplicationRepository to use the generic method
-	replicationRepo := NewReplicationRepository(r.pool)
+	replicationRepo := &ReplicationRepository{db: r.db}
 	return replicationRepo.UpsertCheckpoint(ctx, deviceID, checkpointCollection, checkpoint)
 }
+
+// MessageSearchFilter narrows a message search. Zero-value fields don't filter.
+type MessageSearchFilter struct {
+	Query       string              // websearch syntax: words, "quoted phrases", OR, -excluded
+	MessageType *domain.MessageType // Only messages of this type
+	SOSType     *domain.SOSType     // Only SOS messages of this type
+	Tags        []string            // Only messages carrying all of these tags
+	From        *time.Time          // Only messages created at or after this time
+	To          *time.Time          // Only messages created before this time
+}
+
+// MessageSearchResult is a message matching a search, with its relevance and a highlighted excerpt
+type MessageSearchResult struct {
+	Message *domain.Message `json:"message"`
+	Rank    float32         `json:"rank"`
+	Snippet string          `json:"snippet"` // Matching fragments as HTML: the message text escaped, with matches wrapped in <mark></mark>
+}
+
+// SearchMessages runs a full-text search over a group's messages, most relevant first.
+// Accents are ignored on both sides (see migration 020). after continues from a previous page.
+func (r *MessageRepository) SearchMessages(ctx context.Context, groupID string, filter MessageSearchFilter, after *SearchCursor, limit int) ([]MessageSearchResult, error) {
+	headlineOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=20, MinWords=5", searchMatchStart, searchMatchStop)
+	args := []interface{}{groupID, filter.Query, headlineOptions, searchMatchStart + searchMatchStop}
+	conditions := []string{
+		"m.group_id = $1",
+		"m.deleted_at IS NULL",
+		"m.search_vector @@ q.query",
+	}
+	addCondition := func(format string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(format, len(args)))
+	}
+	if filter.MessageType != nil {
+		addCondition("m.message_type = $%d", string(*filter.MessageType))
+	}
+	if filter.SOSType != nil {
+		addCondition("m.sos_type = $%d", string(*filter.SOSType))
+	}
+	if len(filter.Tags) > 0 {
+		addCondition("m.tags @> $%d", filter.Tags)
+	}
+	if filter.From != nil {
+		addCondition("m.created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		addCondition("m.created_at < $%d", *filter.To)
+	}
+
+	pageCondition := ""
+	if after != nil {
+		args = append(args, after.Rank, after.Time, after.ID)
+		pageCondition = fmt.Sprintf("WHERE (rank, created_at, id) < ($%d::real, $%d, $%d)", len(args)-2, len(args)-1, len(args))
+	}
+	args = append(args, limit)
+
+	// Snippets are computed in the outer query so only the returned page pays for ts_headline
+	query := fmt.Sprintf(`
+		SELECT id, group_id, device_id, content, message_type, sos_type,
+		       tags, pinned, created_at, device_sequence, synced_at, edited_at, rank,
+		       ts_headline('vietnamese_unaccent', translate(content, $4, ''), query, $3)
+		FROM (
+			SELECT m.id, m.group_id, m.device_id, m.content, m.message_type, m.sos_type,
+			       m.tags, m.pinned, m.created_at, m.device_sequence, m.synced_at, m.edited_at,
+			       ts_rank_cd(m.search_vector, q.query) AS rank, q.query
+			FROM messages m, websearch_to_tsquery('vietnamese_unaccent', $2) AS q(query)
+			WHERE %s
+		) matches
+		%s
+		ORDER BY rank DESC, created_at DESC, id DESC
+		LIMIT $%d
+	`, strings.Join(conditions, " AND "), pageCondition, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []MessageSearchResult
+	for rows.Next() {
+		var msg domain.Message
+		var messageType string
+		var result MessageSearchResult
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.GroupID,
+			&msg.DeviceID,
+			&msg.Content,
+			&messageType,
+			&msg.SOSType,
+			&msg.Tags,
+			&msg.Pinned,
+			&msg.CreatedAt,
+			&msg.DeviceSequence,
+			&msg.SyncedAt,
+			&msg.EditedAt,
+			&result.Rank,
+			&result.Snippet,
+		); err != nil {
+			return nil, err
+		}
+		msg.MessageType = domain.MessageType(messageType)
+		result.Message = &msg
+		result.Snippet = searchHighlighter.Replace(html.EscapeString(result.Snippet))
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// GroupMessage is a message as shown in a group's history: with its sender's nickname, and
+// Pinned reflecting whether the viewing device pinned it
+type GroupMessage struct {
+	*domain.Message
+	SenderNickname string `json:"sender_nickname,omitempty"`
+}
+
+// GetGroupMessages returns a page of a group's history in chronological order.
+// With before set, it returns the newest messages older than the cursor; with after set, the
+// oldest messages newer than it; with neither, the latest messages. limit+1 rows are read so
+// hasMore can report whether the page was cut short.
+func (r *MessageRepository) GetGroupMessages(ctx context.Context, groupID, viewerDeviceID string, before, after *Cursor, limit int) (messages []*GroupMessage, hasMore bool, err error) {
+	if limit <= 0 || limit > 500 {
+		limit = defaultMessageLimit
+	}
+
+	// Keyset pagination over idx_messages_group_created
+	args := []interface{}{groupID, viewerDeviceID}
+	condition := ""
+	order := "DESC"
+	switch {
+	case before != nil:
+		args = append(args, before.Time, before.ID)
+		condition = "AND (m.created_at, m.id) < ($3, $4)"
+	case after != nil:
+		args = append(args, after.Time, after.ID)
+		condition = "AND (m.created_at, m.id) > ($3, $4)"
+		order = "ASC"
+	}
+	args = append(args, limit+1)
+
+	query := fmt.Sprintf(`
+		SELECT m.id, m.group_id, m.device_id, m.content, m.message_type, m.sos_type,
+		       m.tags, m.created_at, m.device_sequence, m.synced_at, m.edited_at, m.updated_at, m.attachment_ids,
+		       m.latitude, m.longitude, m.accuracy,
+		       `+replyColumns+`,
+		       `+reactionCountsColumn+`,
+		       COALESCE(d.nickname, ''),
+		       EXISTS (
+		         SELECT 1 FROM pinned_messages p
+		         WHERE p.message_id = m.id AND p.device_id = $2 AND p.deleted_at IS NULL
+		       )
+		FROM messages m
+		LEFT JOIN devices d ON d.id = m.device_id
+		`+replyJoin+`
+		WHERE m.group_id = $1 AND m.deleted_at IS NULL %s
+		ORDER BY m.created_at %s, m.id %s
+		LIMIT $%d
+	`, condition, order, order, len(args))
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var msg domain.Message
+		var messageType string
+		var reply replyScan
+		groupMessage := &GroupMessage{Message: &msg}
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.GroupID,
+			&msg.DeviceID,
+			&msg.Content,
+			&messageType,
+			&msg.SOSType,
+			&msg.Tags,
+			&msg.CreatedAt,
+			&msg.DeviceSequence,
+			&msg.SyncedAt,
+			&msg.EditedAt,
+			&msg.UpdatedAt,
+			&msg.AttachmentIDs,
+			&msg.Latitude,
+			&msg.Longitude,
+			&msg.Accuracy,
+			&msg.ReplyToID,
+			&reply.deviceID,
+			&reply.content,
+			&reply.deleted,
+			&msg.ReplyCount,
+			&msg.Reactions,
+			&groupMessage.SenderNickname,
+			&msg.Pinned,
+		); err != nil {
+			return nil, false, err
+		}
+		msg.MessageType = domain.MessageType(messageType)
+		reply.apply(&msg)
+		messages = append(messages, groupMessage)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	if len(messages) > limit {
+		messages = messages[:limit]
+		hasMore = true
+	}
+	if order == "DESC" {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, hasMore, nil
+}
+
+// EditMessage replaces a message's content and records the content it replaced, in one statement.
+// Replies quote the message, so they are marked changed too.
+func (r *MessageRepository) EditMessage(ctx context.Context, edit *domain.MessageEdit, content string) error {
+	query := `
+		WITH previous AS (
+			SELECT id, content FROM messages WHERE id = $1 AND deleted_at IS NULL FOR UPDATE
+		), history AS (
+			INSERT INTO message_edits (id, message_id, device_id, previous_content, edited_at)
+			SELECT $2, id, $3, content, $5 FROM previous
+			RETURNING previous_content
+		), replies AS (
+			UPDATE messages SET updated_at = NOW()
+			WHERE reply_to_id IN (SELECT id FROM previous) AND deleted_at IS NULL
+		)
+		UPDATE messages
+		SET content = $4, edited_at = $5, updated_at = NOW()
+		WHERE id IN (SELECT id FROM previous)
+		RETURNING (SELECT previous_content FROM history)
+	`
+	err := r.db.QueryRow(ctx, query, edit.MessageID, edit.ID, edit.DeviceID, content, edit.EditedAt).Scan(&edit.PreviousContent)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return errors.New("message not found")
+		}
+		return err
+	}
+	return nil
+}
+
+// SoftDelete marks a message deleted, leaving a tombstone for deletion sync, and removes every
+// pin of, reaction to and attachment of it in the same statement. Its parent's reply count and
+// its replies' quotes change, so they are marked changed too.
+func (r *MessageRepository) SoftDelete(ctx context.Context, messageID string, deletedAt time.Time) error {
+	query := `
+		WITH deleted AS (
+			UPDATE messages
+			SET deleted_at = $2, updated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING id, reply_to_id
+		), parent AS (
+			UPDATE messages SET updated_at = NOW()
+			WHERE id IN (SELECT reply_to_id FROM deleted) AND deleted_at IS NULL
+		), replies AS (
+			UPDATE messages SET updated_at = NOW()
+			WHERE reply_to_id IN (SELECT id FROM deleted) AND deleted_at IS NULL
+		), unpinned AS (
+			UPDATE pinned_messages
+			SET deleted_at = $2
+			WHERE message_id IN (SELECT id FROM deleted) AND deleted_at IS NULL
+		), unreacted AS (
+			UPDATE message_reactions
+			SET deleted_at = $2, updated_at = $2
+			WHERE message_id IN (SELECT id FROM deleted) AND deleted_at IS NULL
+		), detached AS (
+			UPDATE attachments
+			SET deleted_at = $2, updated_at = $2
+			WHERE message_id IN (SELECT id FROM deleted) AND deleted_at IS NULL
+		)
+		SELECT COUNT(*) FROM deleted
+	`
+	var deleted int
+	if err := r.db.QueryRow(ctx, query, messageID, deletedAt).Scan(&deleted); err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.New("message not found")
+	}
+	return nil
+}
+
+// GetEdits returns the edit history of a message, oldest first
+func (r *MessageRepository) GetEdits(ctx context.Context, messageID string) ([]*domain.MessageEdit, error) {
+	query := `
+		SELECT id, message_id, device_id, previous_content, edited_at
+		FROM message_edits
+		WHERE message_id = $1
+		ORDER BY edited_at ASC, id ASC
+	`
+	rows, err := r.db.Query(ctx, query, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edits []*domain.MessageEdit
+	for rows.Next() {
+		var edit domain.MessageEdit
+		if err := rows.Scan(&edit.ID, &edit.MessageID, &edit.DeviceID, &edit.PreviousContent, &edit.EditedAt); err != nil {
+			return nil, err
+		}
+		edits = append(edits, &edit)
+	}
+
+	return edits, rows.Err()
+}
+
+// GetReplies returns the live replies to a message positioned after the cursor, oldest first
+func (r *MessageRepository) GetReplies(ctx context.Context, parentID string, after Cursor, limit int) ([]*domain.Message, error) {
+	query := `
+		SELECT m.id, m.group_id, m.device_id, m.content, m.message_type, m.sos_type,
+		       m.tags, m.pinned, m.created_at, m.device_sequence, m.synced_at, m.edited_at, m.updated_at, m.attachment_ids,
+		       m.latitude, m.longitude, m.accuracy,
+		       ` + replyColumns + `,
+		       ` + reactionCountsColumn + `
+		FROM messages m
+		` + replyJoin + `
+		WHERE m.reply_to_id = $1 AND m.deleted_at IS NULL AND (m.created_at, m.id) > ($2, $3)
+		ORDER BY m.created_at ASC, m.id ASC
+		LIMIT $4
+	`
+	rows, err := r.db.Query(ctx, query, parentID, after.Time, after.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var replies []*domain.Message
+	for rows.Next() {
+		var msg domain.Message
+		var messageType string
+		var reply replyScan
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.GroupID,
+			&msg.DeviceID,
+			&msg.Content,
+			&messageType,
+			&msg.SOSType,
+			&msg.Tags,
+			&msg.Pinned,
+			&msg.CreatedAt,
+			&msg.DeviceSequence,
+			&msg.SyncedAt,
+			&msg.EditedAt,
+			&msg.UpdatedAt,
+			&msg.AttachmentIDs,
+			&msg.Latitude,
+			&msg.Longitude,
+			&msg.Accuracy,
+			&msg.ReplyToID,
+			&reply.deviceID,
+			&reply.content,
+			&reply.deleted,
+			&msg.ReplyCount,
+			&msg.Reactions,
+		); err != nil {
+			return nil, err
+		}
+		msg.MessageType = domain.MessageType(messageType)
+		reply.apply(&msg)
+		replies = append(replies, &msg)
+	}
+
+	return replies, rows.Err()
+}
+
+// GetSOSLocations returns a group's live SOS messages sent with a location since the given time, newest first
+func (r *MessageRepository) GetSOSLocations(ctx context.Context, groupID string, since time.Time, limit int) ([]*domain.Message, error) {
+	query := `
+		SELECT id, group_id, device_id, content, message_type, sos_type,
+		       tags, created_at, latitude, longitude, accuracy
+		FROM messages
+		WHERE group_id = $1 AND message_type = 'sos' AND latitude IS NOT NULL
+		  AND deleted_at IS NULL AND created_at >= $2
+		ORDER BY created_at DESC, id DESC
+		LIMIT $3
+	`
+	rows, err := r.db.Query(ctx, query, groupID, since, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*domain.Message
+	for rows.Next() {
+		var msg domain.Message
+		var messageType string
+		if err := rows.Scan(
+			&msg.ID,
+			&msg.GroupID,
+			&msg.DeviceID,
+			&msg.Content,
+			&messageType,
+			&msg.SOSType,
+			&msg.Tags,
+			&msg.CreatedAt,
+			&msg.Latitude,
+			&msg.Longitude,
+			&msg.Accuracy,
+		); err != nil {
+			return nil, err
+		}
+		msg.MessageType = domain.MessageType(messageType)
+		messages = append(messages, &msg)
+	}
+
+	return messages, rows.Err()
+}
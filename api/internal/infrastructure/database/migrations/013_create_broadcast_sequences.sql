@@ -0,0 +1,8 @@
+-- Migration: Per-group event sequence numbers for WebSocket broadcasts
+-- Shared by all API instances so every replica stamps the same sequence on an event
+
+CREATE TABLE IF NOT EXISTS broadcast_sequences (
+    group_id VARCHAR(32) PRIMARY KEY,
+    seq BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,14 @@
+-- Migration: Per-group device bans
+-- A banned device may not subscribe to, post in or pin messages of the group
+
+CREATE TABLE IF NOT EXISTS group_bans (
+    group_id VARCHAR(32) NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    device_id VARCHAR(32) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    reason VARCHAR(200),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE, -- NULL means the ban is permanent
+    PRIMARY KEY (group_id, device_id)
+);
+
+-- Create index on device_id for listing a device's bans
+CREATE INDEX IF NOT EXISTS idx_group_bans_device_id ON group_bans(device_id);
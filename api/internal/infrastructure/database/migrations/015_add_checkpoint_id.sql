@@ -0,0 +1,5 @@
+-- Migration: Composite (timestamp, id) replication checkpoints
+-- checkpoint_id is the ID of the last row a device received at the checkpoint timestamp.
+-- Existing checkpoints keep an empty ID, so rows at that exact timestamp are re-sent once.
+
+ALTER TABLE replication_checkpoints ADD COLUMN IF NOT EXISTS checkpoint_id VARCHAR(32) NOT NULL DEFAULT '';
@@ -0,0 +1,13 @@
+-- Migration: Client mutation IDs already applied by the replication push endpoint
+-- Lets clients retry a push batch safely: mutations seen before are reported as duplicates
+
+CREATE TABLE IF NOT EXISTS processed_mutations (
+    device_id VARCHAR(32) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    mutation_id VARCHAR(64) NOT NULL,
+    collection VARCHAR(50) NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (device_id, mutation_id)
+);
+
+-- Index for pruning old records
+CREATE INDEX IF NOT EXISTS idx_processed_mutations_processed_at ON processed_mutations(processed_at);
@@ -0,0 +1,4 @@
+-- Migration: Remember the server-side ID a processed mutation produced
+-- Lets a retried push report the same ID mapping (e.g. a remapped group ID) as the original
+
+ALTER TABLE processed_mutations ADD COLUMN IF NOT EXISTS result_id VARCHAR(32);
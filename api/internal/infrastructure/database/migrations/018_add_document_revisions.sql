@@ -0,0 +1,12 @@
+-- Migration: Revisions for conflict detection on groups and user_status
+-- revision increments on every write; field_revisions records the revision at which each
+-- field last changed (for field-level merges); client_updated_at is the writer's own clock,
+-- used by last-writer-wins resolution
+
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS field_revisions JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE groups ADD COLUMN IF NOT EXISTS client_updated_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE user_status ADD COLUMN IF NOT EXISTS revision BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE user_status ADD COLUMN IF NOT EXISTS field_revisions JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE user_status ADD COLUMN IF NOT EXISTS client_updated_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,9 @@
+-- Migration: Deletion sync for pinned messages and tombstone compaction
+-- Unpinning now leaves a tombstone (deleted_at) so clients learn about it on their next pull.
+-- synced_at records when a device last pulled a collection; a device that hasn't synced
+-- since before the tombstone horizon may have missed purged deletions and must resync.
+
+ALTER TABLE pinned_messages ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE;
+CREATE INDEX IF NOT EXISTS idx_pinned_messages_deleted_at ON pinned_messages(deleted_at) WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE replication_checkpoints ADD COLUMN IF NOT EXISTS synced_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW();
@@ -0,0 +1,22 @@
+-- Migration: Full-text message search
+-- vietnamese_unaccent is the "simple" configuration with diacritics stripped, so a query
+-- typed without accents ("lu lut") matches accented text ("lũ lụt"), and vice versa.
+-- Using a configuration (rather than calling unaccent() on the text) keeps to_tsvector
+-- immutable for the generated column and lets ts_headline highlight the original text.
+
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'vietnamese_unaccent') THEN
+        CREATE TEXT SEARCH CONFIGURATION vietnamese_unaccent (COPY = simple);
+        ALTER TEXT SEARCH CONFIGURATION vietnamese_unaccent
+            ALTER MAPPING FOR hword, hword_part, word WITH unaccent, simple;
+    END IF;
+END
+$$;
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector('vietnamese_unaccent'::regconfig, content)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_messages_search_vector ON messages USING GIN (search_vector);
@@ -0,0 +1,17 @@
+-- Migration: Message editing
+-- edited_at is set on every edit; replication orders messages by COALESCE(edited_at, created_at)
+-- so an edited message is pulled again. message_edits keeps the content each edit replaced.
+
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS edited_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_messages_group_changed ON messages(group_id, (COALESCE(edited_at, created_at)), id);
+
+CREATE TABLE IF NOT EXISTS message_edits (
+    id VARCHAR(32) PRIMARY KEY,
+    message_id VARCHAR(32) NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    device_id VARCHAR(32) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    previous_content TEXT NOT NULL,
+    edited_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_message_edits_message ON message_edits(message_id, edited_at);
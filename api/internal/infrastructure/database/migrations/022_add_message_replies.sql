@@ -0,0 +1,6 @@
+-- Replies reference the message they answer, in the same group. Trimming the parent away
+-- keeps the reply but drops the reference.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS reply_to_id VARCHAR(32) REFERENCES messages(id) ON DELETE SET NULL;
+
+-- Index for listing and counting the replies to a message
+CREATE INDEX IF NOT EXISTS idx_messages_reply_to ON messages(reply_to_id, created_at, id) WHERE reply_to_id IS NOT NULL;
@@ -0,0 +1,24 @@
+-- Reactions and SOS acknowledgements on messages, one row per (message, device, kind).
+-- Removing a reaction soft-deletes it for deletion sync; reacting again revives the row.
+CREATE TABLE IF NOT EXISTS message_reactions (
+    id VARCHAR(32) PRIMARY KEY,
+    message_id VARCHAR(32) NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    group_id VARCHAR(32) NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    device_id VARCHAR(32) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+-- One reaction of each kind per device and message
+CREATE UNIQUE INDEX IF NOT EXISTS idx_message_reactions_unique ON message_reactions(message_id, device_id, kind);
+
+-- Index for per-message reaction counts
+CREATE INDEX IF NOT EXISTS idx_message_reactions_message ON message_reactions(message_id, kind) WHERE deleted_at IS NULL;
+
+-- Index for replication pulls by group
+CREATE INDEX IF NOT EXISTS idx_message_reactions_group_updated ON message_reactions(group_id, updated_at, id);
+
+-- Index for deletion sync and tombstone compaction
+CREATE INDEX IF NOT EXISTS idx_message_reactions_deleted_at ON message_reactions(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,14 @@
+-- How far each device has read in each group: every message at or before
+-- (last_read_at, last_read_message_id) in (created_at, id) order counts as read
+CREATE TABLE IF NOT EXISTS group_read_markers (
+    id VARCHAR(32) PRIMARY KEY,
+    device_id VARCHAR(32) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    group_id VARCHAR(32) NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    last_read_message_id VARCHAR(32) NOT NULL DEFAULT '', -- No foreign key: the message may be trimmed later
+    last_read_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE(device_id, group_id)
+);
+
+-- Index for replication pulls of a device's markers
+CREATE INDEX IF NOT EXISTS idx_group_read_markers_device_updated ON group_read_markers(device_id, updated_at, id);
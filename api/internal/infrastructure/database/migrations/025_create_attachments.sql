@@ -0,0 +1,30 @@
+-- Photos and voice notes uploaded to a group. The file itself lives in the blob store under
+-- storage_key; message_id is set when a message is sent with the attachment.
+CREATE TABLE IF NOT EXISTS attachments (
+    id VARCHAR(32) PRIMARY KEY,
+    group_id VARCHAR(32) NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    device_id VARCHAR(32) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    message_id VARCHAR(32) REFERENCES messages(id) ON DELETE SET NULL,
+    kind VARCHAR(20) NOT NULL,
+    mime_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    storage_key TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Attachments a message was sent with, in order
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS attachment_ids TEXT[] NOT NULL DEFAULT '{}';
+
+-- Index for a message's attachments
+CREATE INDEX IF NOT EXISTS idx_attachments_message ON attachments(message_id);
+
+-- Index for replication pulls by group (sent attachments only)
+CREATE INDEX IF NOT EXISTS idx_attachments_group_updated ON attachments(group_id, updated_at, id) WHERE message_id IS NOT NULL;
+
+-- Index for cleanup of deleted attachments and abandoned uploads
+CREATE INDEX IF NOT EXISTS idx_attachments_deleted_at ON attachments(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_attachments_unsent ON attachments(created_at) WHERE message_id IS NULL;
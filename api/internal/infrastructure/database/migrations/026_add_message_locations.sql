@@ -0,0 +1,27 @@
+-- Optional position a message was sent from, e.g. where an SOS was raised
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS latitude DOUBLE PRECISION;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS accuracy DOUBLE PRECISION;
+
+-- Index for listing a group's recent SOS messages with a location
+CREATE INDEX IF NOT EXISTS idx_messages_group_sos_location ON messages(group_id, created_at DESC)
+    WHERE message_type = 'sos' AND latitude IS NOT NULL AND deleted_at IS NULL;
+
+-- Live location a device streams to a group for a bounded time. One row per device and group,
+-- reused by later shares; the share is active while expires_at is in the future.
+CREATE TABLE IF NOT EXISTS location_shares (
+    id VARCHAR(32) PRIMARY KEY,
+    device_id VARCHAR(32) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    group_id VARCHAR(32) NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    message_id VARCHAR(32) REFERENCES messages(id) ON DELETE SET NULL,
+    latitude DOUBLE PRECISION NOT NULL,
+    longitude DOUBLE PRECISION NOT NULL,
+    accuracy DOUBLE PRECISION,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (device_id, group_id)
+);
+
+-- Index for a group's active shares
+CREATE INDEX IF NOT EXISTS idx_location_shares_group_expires ON location_shares(group_id, expires_at);
@@ -0,0 +1,30 @@
+-- Lifecycle of an SOS: one incident per SOS message, sharing its ID
+CREATE TABLE IF NOT EXISTS sos_incidents (
+    id VARCHAR(32) PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    group_id VARCHAR(32) NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    device_id VARCHAR(32) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    state VARCHAR(20) NOT NULL DEFAULT 'open',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    acknowledged_at TIMESTAMP WITH TIME ZONE,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolved_by VARCHAR(32) REFERENCES devices(id) ON DELETE SET NULL
+);
+
+-- Devices that claimed an incident as responders
+CREATE TABLE IF NOT EXISTS sos_responders (
+    incident_id VARCHAR(32) NOT NULL REFERENCES sos_incidents(id) ON DELETE CASCADE,
+    device_id VARCHAR(32) NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    claimed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (incident_id, device_id)
+);
+
+-- Index for listing a group's incidents by state
+CREATE INDEX IF NOT EXISTS idx_sos_incidents_group_state ON sos_incidents(group_id, state, created_at DESC);
+
+-- SOS messages sent before incidents existed start out open
+INSERT INTO sos_incidents (id, group_id, device_id, state, created_at, updated_at)
+SELECT id, group_id, device_id, 'open', created_at, created_at
+FROM messages
+WHERE message_type = 'sos' AND deleted_at IS NULL
+ON CONFLICT (id) DO NOTHING;
@@ -0,0 +1,18 @@
+-- Set once an incident left open too long has been escalated to nearby groups
+ALTER TABLE sos_incidents ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMP WITH TIME ZONE;
+
+-- Groups each incident was escalated to. An incident reaches a group at most once, and a group
+-- hears from the same origin group at most once per cooldown.
+CREATE TABLE IF NOT EXISTS sos_escalations (
+    incident_id VARCHAR(32) NOT NULL REFERENCES sos_incidents(id) ON DELETE CASCADE,
+    origin_group_id VARCHAR(32) NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    group_id VARCHAR(32) NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    escalated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (incident_id, group_id)
+);
+
+-- Index for the per origin and target group cooldown
+CREATE INDEX IF NOT EXISTS idx_sos_escalations_cooldown ON sos_escalations(origin_group_id, group_id, escalated_at DESC);
+
+-- Index for finding open incidents due for escalation
+CREATE INDEX IF NOT EXISTS idx_sos_incidents_unescalated ON sos_incidents(created_at) WHERE state = 'open' AND escalated_at IS NULL;
@@ -0,0 +1,12 @@
+-- Token buckets shared by every API instance. A bucket is stored as the time it will be full
+-- again: each action pushes full_at further out, and the bucket is empty once full_at is a
+-- whole window away. Rows whose full_at has passed carry no state and may be deleted.
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    rule VARCHAR(64) NOT NULL,
+    key VARCHAR(128) NOT NULL,
+    full_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (rule, key)
+);
+
+-- Index for deleting buckets that have refilled
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_full_at ON rate_limit_buckets(full_at);
@@ -0,0 +1,12 @@
+-- Server time a message or anything shown with it last changed: its content, its replies, its
+-- reactions or the quote of the message it replies to. Replication pages messages by it, so
+-- devices pull a message again whenever any of these change. Existing messages start at the
+-- time replication used to order them by.
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE;
+UPDATE messages SET updated_at = COALESCE(edited_at, created_at) WHERE updated_at IS NULL;
+ALTER TABLE messages ALTER COLUMN updated_at SET DEFAULT NOW();
+ALTER TABLE messages ALTER COLUMN updated_at SET NOT NULL;
+
+-- Index for replication pulls
+CREATE INDEX IF NOT EXISTS idx_messages_group_updated ON messages(group_id, updated_at, id) WHERE deleted_at IS NULL;
+DROP INDEX IF EXISTS idx_messages_group_changed;
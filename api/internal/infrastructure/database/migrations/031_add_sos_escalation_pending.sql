@@ -0,0 +1,6 @@
+-- Set while an escalated incident still has nearby groups held back by their cooldown, so
+-- the incident is escalated to them once the cooldown ends
+ALTER TABLE sos_incidents ADD COLUMN IF NOT EXISTS escalation_pending BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Index for finding open incidents with escalations left to send
+CREATE INDEX IF NOT EXISTS idx_sos_incidents_escalation_pending ON sos_incidents(created_at) WHERE state = 'open' AND escalation_pending;
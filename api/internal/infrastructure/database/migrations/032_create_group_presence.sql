@@ -0,0 +1,19 @@
+-- WebSocket connections subscribed to groups, across all API instances. Each instance
+-- refreshes seen_at for its connections; rows of an instance that stopped doing so are stale.
+CREATE TABLE IF NOT EXISTS group_presence (
+    connection_id VARCHAR(32) NOT NULL,
+    group_id VARCHAR(32) NOT NULL,
+    device_id VARCHAR(32) NOT NULL,
+    instance_id VARCHAR(32) NOT NULL,
+    seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (connection_id, group_id)
+);
+
+-- Index for listing and counting a device's connections in a group
+CREATE INDEX IF NOT EXISTS idx_group_presence_group_device ON group_presence(group_id, device_id);
+
+-- Index for heartbeats
+CREATE INDEX IF NOT EXISTS idx_group_presence_instance ON group_presence(instance_id);
+
+-- Index for finding connections of instances that stopped heartbeating
+CREATE INDEX IF NOT EXISTS idx_group_presence_seen ON group_presence(seen_at);
@@ -0,0 +1,10 @@
+-- Payloads too large for NOTIFY. The notification carries the row's ID instead, and listeners
+-- load the payload from here. Rows are kept briefly so every listener can read them.
+CREATE TABLE IF NOT EXISTS notify_payloads (
+    id BIGSERIAL PRIMARY KEY,
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Index for deleting expired payloads
+CREATE INDEX IF NOT EXISTS idx_notify_payloads_created ON notify_payloads(created_at);
@@ -0,0 +1,7 @@
+-- Set once location_share_ended was broadcast for the share, so its expiry is announced once.
+-- Shares that existed before this column are treated as announced; later rows default to FALSE.
+ALTER TABLE location_shares ADD COLUMN IF NOT EXISTS end_announced BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE location_shares ALTER COLUMN end_announced SET DEFAULT FALSE;
+
+-- Index for finding expired shares whose end was not announced yet
+CREATE INDEX IF NOT EXISTS idx_location_shares_end_pending ON location_shares(expires_at) WHERE NOT end_announced;
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MutationRepository records client mutation IDs that have been applied, per device
+type MutationRepository struct {
+	db Querier
+}
+
+// NewMutationRepository creates a new mutation repository
+func NewMutationRepository(pool *Pool) *MutationRepository {
+	return &MutationRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *MutationRepository) WithQuerier(q Querier) *MutationRepository {
+	return &MutationRepository{db: q}
+}
+
+// GetProcessed returns which of the given mutation IDs were already applied for a device,
+// mapped to the ID of the entity each one produced ("" if none was recorded)
+func (r *MutationRepository) GetProcessed(ctx context.Context, deviceID string, mutationIDs []string) (map[string]string, error) {
+	processed := make(map[string]string)
+	if len(mutationIDs) == 0 {
+		return processed, nil
+	}
+
+	query := `
+		SELECT mutation_id, COALESCE(result_id, '')
+		FROM processed_mutations
+		WHERE device_id = $1 AND mutation_id = ANY($2)
+	`
+	rows, err := r.db.Query(ctx, query, deviceID, mutationIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mutationID, resultID string
+		if err := rows.Scan(&mutationID, &resultID); err != nil {
+			return nil, err
+		}
+		processed[mutationID] = resultID
+	}
+
+	return processed, rows.Err()
+}
+
+// Claim marks a mutation ID as being applied for a device. Returns false if it was already
+// claimed; a claim still uncommitted in another transaction is waited for. Run it in the same
+// transaction as the mutation, so a rolled back mutation releases its claim.
+func (r *MutationRepository) Claim(ctx context.Context, deviceID, mutationID, collection string) (bool, error) {
+	query := `
+		INSERT INTO processed_mutations (device_id, mutation_id, collection, processed_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (device_id, mutation_id) DO NOTHING
+		RETURNING mutation_id
+	`
+	var claimed string
+	err := r.db.QueryRow(ctx, query, deviceID, mutationID, collection, time.Now()).Scan(&claimed)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// SetResult records the ID of the entity a claimed mutation produced (if any)
+func (r *MutationRepository) SetResult(ctx context.Context, deviceID, mutationID, resultID string) error {
+	query := `
+		UPDATE processed_mutations
+		SET result_id = NULLIF($3, '')
+		WHERE device_id = $1 AND mutation_id = $2
+	`
+	result, err := r.db.Exec(ctx, query, deviceID, mutationID, resultID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return errors.New("processed mutation not found")
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// maxNotifyPayloadBytes is the largest payload PostgreSQL accepts for NOTIFY (8000 bytes minus headroom)
+	maxNotifyPayloadBytes = 7900
+	// spilledPayloadPrefix marks a notification whose payload was stored in notify_payloads;
+	// the rest is the row's ID
+	spilledPayloadPrefix = "spilled:"
+	// spilledPayloadTTL is how long stored payloads are kept for listeners to read
+	spilledPayloadTTL = 10 * time.Minute
+)
+
+// Notifier publishes and receives PostgreSQL LISTEN/NOTIFY messages
+type Notifier struct {
+	pool *Pool
+}
+
+// NewNotifier creates a new notifier backed by the connection pool
+func NewNotifier(pool *Pool) *Notifier {
+	return &Notifier{pool: pool}
+}
+
+// Notify sends a payload on the given channel. Payloads too large for NOTIFY are stored in
+// notify_payloads and delivered to listeners from there.
+func (n *Notifier) Notify(ctx context.Context, channel string, payload string) error {
+	if len(payload) <= maxNotifyPayloadBytes {
+		_, err := n.pool.Exec(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+		return err
+	}
+
+	tx, err := n.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := notify(ctx, tx, channel, payload); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// notify sends a payload on the given channel within tx, storing it in notify_payloads if it
+// is too large for NOTIFY. Listeners receive it once tx commits.
+func notify(ctx context.Context, tx pgx.Tx, channel string, payload string) error {
+	if len(payload) > maxNotifyPayloadBytes {
+		if _, err := tx.Exec(ctx, `DELETE FROM notify_payloads WHERE created_at < NOW() - $1::interval`, spilledPayloadTTL); err != nil {
+			return fmt.Errorf("failed to delete expired notification payloads: %w", err)
+		}
+		var id int64
+		if err := tx.QueryRow(ctx, `INSERT INTO notify_payloads (payload) VALUES ($1) RETURNING id`, payload).Scan(&id); err != nil {
+			return fmt.Errorf("failed to store notification payload: %w", err)
+		}
+		payload = spilledPayloadPrefix + strconv.FormatInt(id, 10)
+	}
+	_, err := tx.Exec(ctx, "SELECT pg_notify($1, $2)", channel, payload)
+	return err
+}
+
+// NotifySequenced increments the sequence for key and sends the payload built for that
+// sequence in a single transaction. The row lock on the sequence serialises concurrent
+// publishers, so notifications are delivered to listeners in sequence order.
+func (n *Notifier) NotifySequenced(ctx context.Context, channel string, key string, build func(seq int64) (string, error)) (int64, error) {
+	tx, err := n.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO broadcast_sequences (group_id, seq, updated_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (group_id)
+		DO UPDATE SET seq = broadcast_sequences.seq + 1, updated_at = NOW()
+		RETURNING seq
+	`
+	var seq int64
+	if err := tx.QueryRow(ctx, query, key).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("failed to allocate sequence: %w", err)
+	}
+
+	payload, err := build(seq)
+	if err != nil {
+		return 0, err
+	}
+	if err := notify(ctx, tx, channel, payload); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// Listen holds a dedicated connection subscribed to channel and calls handler for every
+// notification received; pass payloads through LoadPayload. It blocks until ctx is cancelled
+// or the connection fails.
+func (n *Notifier) Listen(ctx context.Context, channel string, handler func(payload string)) error {
+	pooled, err := n.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire listen connection: %w", err)
+	}
+	// Take the connection out of the pool so its LISTEN state never leaks to other queries
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", channel, err)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		handler(notification.Payload)
+	}
+}
+
+// LoadPayload returns a notification's payload, reading it from notify_payloads if it was stored there
+func (n *Notifier) LoadPayload(ctx context.Context, payload string) (string, error) {
+	idStr, ok := strings.CutPrefix(payload, spilledPayloadPrefix)
+	if !ok {
+		return payload, nil
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid stored notification ID %q: %w", idStr, err)
+	}
+	if err := n.pool.QueryRow(ctx, `SELECT payload FROM notify_payloads WHERE id = $1`, id).Scan(&payload); err != nil {
+		return "", fmt.Errorf("failed to load notification payload %d: %w", id, err)
+	}
+	return payload, nil
+}
@@ -12,12 +12,17 @@ import (
 
 // PinRepository handles pinned message database operations
 type PinRepository struct {
-	pool *Pool
+	db Querier
 }
 
 // NewPinRepository creates a new pin repository
 func NewPinRepository(pool *Pool) *PinRepository {
-	return &PinRepository{pool: pool}
+	return &PinRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *PinRepository) WithQuerier(q Querier) *PinRepository {
+	return &PinRepository{db: q}
 }
 
 // Create creates a new pinned message record
@@ -27,7 +32,7 @@ func (r *PinRepository) Create(ctx context.Context, pin *domain.PinnedMessage) e
 		VALUES ($1, $2, $3, $4, $5, $6)
 	`
 	now := time.Now()
-	_, err := r.pool.Exec(ctx, query,
+	_, err := r.db.Exec(ctx, query,
 		pin.ID,
 		pin.MessageID,
 		pin.GroupID,
@@ -42,13 +47,14 @@ func (r *PinRepository) Create(ctx context.Context, pin *domain.PinnedMessage) e
 	return nil
 }
 
-// Delete removes a pinned message record
+// Delete soft-deletes a pinned message record, leaving a tombstone for deletion sync
 func (r *PinRepository) Delete(ctx context.Context, deviceID, messageID string) error {
 	query := `
-		DELETE FROM pinned_messages
-		WHERE device_id = $1 AND message_id = $2
+		UPDATE pinned_messages
+		SET deleted_at = $3
+		WHERE device_id = $1 AND message_id = $2 AND deleted_at IS NULL
 	`
-	result, err := r.pool.Exec(ctx, query, deviceID, messageID)
+	result, err := r.db.Exec(ctx, query, deviceID, messageID, time.Now())
 	if err != nil {
 		return err
 	}
@@ -63,10 +69,10 @@ func (r *PinRepository) GetByGroupID(ctx context.Context, groupID string) ([]*do
 	query := `
 		SELECT id, message_id, group_id, device_id, pinned_at, tag
 		FROM pinned_messages
-		WHERE group_id = $1
+		WHERE group_id = $1 AND deleted_at IS NULL
 		ORDER BY pinned_at DESC
 	`
-	rows, err := r.pool.Query(ctx, query, groupID)
+	rows, err := r.db.Query(ctx, query, groupID)
 	if err != nil {
 		return nil, err
 	}
@@ -98,12 +104,12 @@ func (r *PinRepository) GetByDeviceAndMessage(ctx context.Context, deviceID, mes
 	query := `
 		SELECT id, message_id, group_id, device_id, pinned_at, tag
 		FROM pinned_messages
-		WHERE device_id = $1 AND message_id = $2
+		WHERE device_id = $1 AND message_id = $2 AND deleted_at IS NULL
 		LIMIT 1
 	`
 	var pin domain.PinnedMessage
 	var tag *string
-	err := r.pool.QueryRow(ctx, query, deviceID, messageID).Scan(
+	err := r.db.QueryRow(ctx, query, deviceID, messageID).Scan(
 		&pin.ID,
 		&pin.MessageID,
 		&pin.GroupID,
@@ -121,16 +127,17 @@ func (r *PinRepository) GetByDeviceAndMessage(ctx context.Context, deviceID, mes
 	return &pin, nil
 }
 
-// GetPinsAfter retrieves pinned messages pinned after a given timestamp for a device
-func (r *PinRepository) GetPinsAfter(ctx context.Context, deviceID string, since time.Time, limit int) ([]*domain.PinnedMessage, error) {
+// GetPinsAfter retrieves pinned messages positioned after the cursor for a device, ordered by (pinned_at, id)
+// Excludes unpinned messages (deleted_at IS NULL)
+func (r *PinRepository) GetPinsAfter(ctx context.Context, deviceID string, after Cursor, limit int) ([]*domain.PinnedMessage, error) {
 	query := `
 		SELECT id, message_id, group_id, device_id, pinned_at, tag
 		FROM pinned_messages
-		WHERE device_id = $1 AND pinned_at > $2
-		ORDER BY pinned_at ASC
-		LIMIT $3
+		WHERE deleted_at IS NULL AND device_id = $1 AND (pinned_at, id) > ($2, $3)
+		ORDER BY pinned_at ASC, id ASC
+		LIMIT $4
 	`
-	rows, err := r.pool.Query(ctx, query, deviceID, since, limit)
+	rows, err := r.db.Query(ctx, query, deviceID, after.Time, after.ID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -156,3 +163,30 @@ func (r *PinRepository) GetPinsAfter(ctx context.Context, deviceID string, since
 
 	return pins, rows.Err()
 }
+
+// GetDeletionsAfter retrieves IDs and timestamps of pins removed for a device after the cursor, ordered by (deleted_at, id)
+func (r *PinRepository) GetDeletionsAfter(ctx context.Context, deviceID string, after Cursor, limit int) ([]DeletionInfo, error) {
+	query := `
+		SELECT id, deleted_at
+		FROM pinned_messages
+		WHERE device_id = $1 AND deleted_at IS NOT NULL AND (deleted_at, id) > ($2, $3)
+		ORDER BY deleted_at ASC, id ASC
+		LIMIT $4
+	`
+	rows, err := r.db.Query(ctx, query, deviceID, after.Time, after.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []DeletionInfo
+	for rows.Next() {
+		var del DeletionInfo
+		if err := rows.Scan(&del.ID, &del.DeletedAt); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, del)
+	}
+
+	return deletions, rows.Err()
+}
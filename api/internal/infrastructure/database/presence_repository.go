@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// PresenceRepository tracks WebSocket connections subscribed to groups across instances.
+// Changes to a device's connections in a group are serialized with an advisory lock, so
+// exactly one of them sees the device's first connection arrive or its last one leave.
+type PresenceRepository struct {
+	db Querier
+}
+
+// NewPresenceRepository creates a new presence repository
+func NewPresenceRepository(pool *Pool) *PresenceRepository {
+	return &PresenceRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *PresenceRepository) WithQuerier(q Querier) *PresenceRepository {
+	return &PresenceRepository{db: q}
+}
+
+// PresenceKey is a device in a group
+type PresenceKey struct {
+	GroupID  string
+	DeviceID string
+}
+
+// lockDeviceQuery serializes changes to a device's connections in a group until the transaction ends
+const lockDeviceQuery = `SELECT pg_advisory_xact_lock(hashtext($1), hashtext($2))`
+
+// otherConnectionsQuery reports whether a device has other live connections in a group
+const otherConnectionsQuery = `
+	SELECT EXISTS (
+		SELECT 1 FROM group_presence
+		WHERE group_id = $1 AND device_id = $2 AND connection_id <> $3 AND seen_at > NOW() - $4::interval
+	)
+`
+
+// Join records a connection of a device subscribed to a group. Returns true if the device had
+// no other live connection to the group on any instance.
+func (r *PresenceRepository) Join(ctx context.Context, groupID, deviceID, connectionID, instanceID string, ttl time.Duration) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, lockDeviceQuery, groupID, deviceID); err != nil {
+		return false, err
+	}
+	var present bool
+	if err := tx.QueryRow(ctx, otherConnectionsQuery, groupID, deviceID, connectionID, ttl).Scan(&present); err != nil {
+		return false, err
+	}
+	query := `
+		INSERT INTO group_presence (connection_id, group_id, device_id, instance_id, seen_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (connection_id, group_id) DO UPDATE SET seen_at = NOW()
+	`
+	if _, err := tx.Exec(ctx, query, connectionID, groupID, deviceID, instanceID); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return !present, nil
+}
+
+// Leave removes a connection of a device from a group. Returns true if it was the device's last
+// live connection to the group on any instance.
+func (r *PresenceRepository) Leave(ctx context.Context, groupID, deviceID, connectionID string, ttl time.Duration) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, lockDeviceQuery, groupID, deviceID); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(ctx, `DELETE FROM group_presence WHERE connection_id = $1 AND group_id = $2`, connectionID, groupID)
+	if err != nil {
+		return false, err
+	}
+	var present bool
+	if err := tx.QueryRow(ctx, otherConnectionsQuery, groupID, deviceID, connectionID, ttl).Scan(&present); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0 && !present, nil
+}
+
+// GetDevices lists the distinct devices with a live connection to a group, ordered by ID
+func (r *PresenceRepository) GetDevices(ctx context.Context, groupID string, ttl time.Duration) ([]string, error) {
+	query := `
+		SELECT DISTINCT device_id
+		FROM group_presence
+		WHERE group_id = $1 AND seen_at > NOW() - $2::interval
+		ORDER BY device_id
+	`
+	rows, err := r.db.Query(ctx, query, groupID, ttl)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deviceIDs := make([]string, 0)
+	for rows.Next() {
+		var deviceID string
+		if err := rows.Scan(&deviceID); err != nil {
+			return nil, err
+		}
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	return deviceIDs, rows.Err()
+}
+
+// Touch marks every connection of an instance as live
+func (r *PresenceRepository) Touch(ctx context.Context, instanceID string) error {
+	_, err := r.db.Exec(ctx, `UPDATE group_presence SET seen_at = NOW() WHERE instance_id = $1`, instanceID)
+	return err
+}
+
+// GetStale lists the devices in groups with connections not seen within ttl
+func (r *PresenceRepository) GetStale(ctx context.Context, ttl time.Duration) ([]PresenceKey, error) {
+	query := `
+		SELECT DISTINCT group_id, device_id
+		FROM group_presence
+		WHERE seen_at <= NOW() - $1::interval
+	`
+	rows, err := r.db.Query(ctx, query, ttl)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []PresenceKey
+	for rows.Next() {
+		var key PresenceKey
+		if err := rows.Scan(&key.GroupID, &key.DeviceID); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RemoveStale deletes a device's connections to a group not seen within ttl. Returns true if
+// any were deleted and the device has no live connection to the group left.
+func (r *PresenceRepository) RemoveStale(ctx context.Context, key PresenceKey, ttl time.Duration) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, lockDeviceQuery, key.GroupID, key.DeviceID); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(ctx, `
+		DELETE FROM group_presence
+		WHERE group_id = $1 AND device_id = $2 AND seen_at <= NOW() - $3::interval
+	`, key.GroupID, key.DeviceID, ttl)
+	if err != nil {
+		return false, err
+	}
+	var present bool
+	if err := tx.QueryRow(ctx, otherConnectionsQuery, key.GroupID, key.DeviceID, "", ttl).Scan(&present); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0 && !present, nil
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Querier is the query interface shared by *Pool and pgx.Tx.
+// Repositories run their queries through a Querier so the same code paths work
+// both on the pool (autocommit) and inside a caller-managed transaction.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error) // Starts a transaction, or a savepoint inside one
+}
+
+var (
+	_ Querier = (*Pool)(nil)
+	_ Querier = (pgx.Tx)(nil)
+)
+
+// WithTx runs fn in a transaction, committing if fn returns nil and rolling back otherwise
+func (p *Pool) WithTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	tx, err := p.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RateLimitRepository stores token buckets for rate limiting. A bucket is kept as the time it
+// will be full again, measured by the database clock so every instance agrees on it.
+type RateLimitRepository struct {
+	db Querier
+}
+
+// NewRateLimitRepository creates a new rate limit repository
+func NewRateLimitRepository(pool *Pool) *RateLimitRepository {
+	return &RateLimitRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *RateLimitRepository) WithQuerier(q Querier) *RateLimitRepository {
+	return &RateLimitRepository{db: q}
+}
+
+// Take atomically spends cost from a bucket that refills completely over window; cost is the
+// refill time of the tokens taken and must not exceed window. A missing bucket is full. If the
+// bucket can't cover cost, nothing is spent and it returns false with how long until it can.
+func (r *RateLimitRepository) Take(ctx context.Context, rule, key string, cost, window time.Duration) (bool, time.Duration, error) {
+	// The conflicting row is locked by the upsert, so concurrent takes on a bucket queue up
+	query := `
+		INSERT INTO rate_limit_buckets (rule, key, full_at)
+		VALUES ($1, $2, NOW() + $3::interval)
+		ON CONFLICT (rule, key) DO UPDATE
+		SET full_at = GREATEST(rate_limit_buckets.full_at, NOW()) + $3::interval
+		WHERE GREATEST(rate_limit_buckets.full_at, NOW()) + $3::interval <= NOW() + $4::interval
+	`
+	result, err := r.db.Exec(ctx, query, rule, key, cost, window)
+	if err != nil {
+		return false, 0, err
+	}
+	if result.RowsAffected() > 0 {
+		return true, 0, nil
+	}
+
+	var retryAfter time.Duration
+	err = r.db.QueryRow(ctx, `
+		SELECT GREATEST(full_at, NOW()) + $3::interval - NOW() - $4::interval
+		FROM rate_limit_buckets
+		WHERE rule = $1 AND key = $2
+	`, rule, key, cost, window).Scan(&retryAfter)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Deleted as refilled in between
+			return false, 0, nil
+		}
+		return false, 0, err
+	}
+	return false, retryAfter, nil
+}
+
+// DeleteRefilled deletes buckets that have refilled, since a missing bucket counts as full.
+// Returns how many were deleted.
+func (r *RateLimitRepository) DeleteRefilled(ctx context.Context) (int64, error) {
+	result, err := r.db.Exec(ctx, `DELETE FROM rate_limit_buckets WHERE full_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ReactionRepository handles message reaction database operations
+type ReactionRepository struct {
+	db Querier
+}
+
+// NewReactionRepository creates a new reaction repository
+func NewReactionRepository(pool *Pool) *ReactionRepository {
+	return &ReactionRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *ReactionRepository) WithQuerier(q Querier) *ReactionRepository {
+	return &ReactionRepository{db: q}
+}
+
+// Add records a reaction, reviving the device's earlier reaction of the same kind if it was removed.
+// The reaction's ID and timestamps are set from the stored row. Returns false if the device
+// already had this reaction, in which case nothing changed. The message's reaction counts
+// change, so it is marked changed in the same statement.
+func (r *ReactionRepository) Add(ctx context.Context, reaction *domain.MessageReaction) (bool, error) {
+	query := `
+		WITH reacted AS (
+			INSERT INTO message_reactions (id, message_id, group_id, device_id, kind, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $6)
+			ON CONFLICT (message_id, device_id, kind) DO UPDATE
+			SET deleted_at = NULL, created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at
+			WHERE message_reactions.deleted_at IS NOT NULL
+			RETURNING id, message_id, created_at, updated_at
+		), touched AS (
+			UPDATE messages SET updated_at = NOW()
+			WHERE id IN (SELECT message_id FROM reacted)
+		)
+		SELECT id, created_at, updated_at FROM reacted
+	`
+	err := r.db.QueryRow(ctx, query,
+		reaction.ID,
+		reaction.MessageID,
+		reaction.GroupID,
+		reaction.DeviceID,
+		string(reaction.Kind),
+		time.Now(),
+	).Scan(&reaction.ID, &reaction.CreatedAt, &reaction.UpdatedAt)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return false, err
+	}
+
+	// The reaction is already live
+	query = `
+		SELECT id, created_at, updated_at
+		FROM message_reactions
+		WHERE message_id = $1 AND device_id = $2 AND kind = $3
+	`
+	err = r.db.QueryRow(ctx, query, reaction.MessageID, reaction.DeviceID, string(reaction.Kind)).
+		Scan(&reaction.ID, &reaction.CreatedAt, &reaction.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// Remove soft-deletes a device's reaction, leaving a tombstone for deletion sync, and marks the
+// message changed in the same statement
+func (r *ReactionRepository) Remove(ctx context.Context, deviceID, messageID string, kind domain.ReactionKind) (*domain.MessageReaction, error) {
+	query := `
+		WITH removed AS (
+			UPDATE message_reactions
+			SET deleted_at = $4, updated_at = $4
+			WHERE device_id = $1 AND message_id = $2 AND kind = $3 AND deleted_at IS NULL
+			RETURNING id, message_id, group_id, created_at, updated_at
+		), touched AS (
+			UPDATE messages SET updated_at = NOW()
+			WHERE id IN (SELECT message_id FROM removed)
+		)
+		SELECT id, group_id, created_at, updated_at FROM removed
+	`
+	reaction := domain.MessageReaction{MessageID: messageID, DeviceID: deviceID, Kind: kind}
+	err := r.db.QueryRow(ctx, query, deviceID, messageID, string(kind), time.Now()).
+		Scan(&reaction.ID, &reaction.GroupID, &reaction.CreatedAt, &reaction.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("reaction not found")
+		}
+		return nil, err
+	}
+	return &reaction, nil
+}
+
+// CountKind returns how many devices currently have a reaction of the given kind on a message
+func (r *ReactionRepository) CountKind(ctx context.Context, messageID string, kind domain.ReactionKind) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM message_reactions
+		WHERE message_id = $1 AND kind = $2 AND deleted_at IS NULL
+	`
+	var count int
+	err := r.db.QueryRow(ctx, query, messageID, string(kind)).Scan(&count)
+	return count, err
+}
+
+// GetReactionsAfter retrieves live reactions in the given groups positioned after the cursor, ordered by (updated_at, id)
+func (r *ReactionRepository) GetReactionsAfter(ctx context.Context, groupIDs []string, after Cursor, limit int) ([]*domain.MessageReaction, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT id, message_id, group_id, device_id, kind, created_at, updated_at
+		FROM message_reactions
+		WHERE deleted_at IS NULL AND group_id = ANY($1) AND (updated_at, id) > ($2, $3)
+		ORDER BY updated_at ASC, id ASC
+		LIMIT $4
+	`
+	rows, err := r.db.Query(ctx, query, groupIDs, after.Time, after.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []*domain.MessageReaction
+	for rows.Next() {
+		var reaction domain.MessageReaction
+		var kind string
+		if err := rows.Scan(
+			&reaction.ID,
+			&reaction.MessageID,
+			&reaction.GroupID,
+			&reaction.DeviceID,
+			&kind,
+			&reaction.CreatedAt,
+			&reaction.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		reaction.Kind = domain.ReactionKind(kind)
+		reactions = append(reactions, &reaction)
+	}
+
+	return reactions, rows.Err()
+}
+
+// GetDeletionsAfter retrieves IDs and timestamps of reactions in the given groups removed after the cursor, ordered by (deleted_at, id)
+func (r *ReactionRepository) GetDeletionsAfter(ctx context.Context, groupIDs []string, after Cursor, limit int) ([]DeletionInfo, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT id, deleted_at
+		FROM message_reactions
+		WHERE group_id = ANY($1) AND deleted_at IS NOT NULL AND (deleted_at, id) > ($2, $3)
+		ORDER BY deleted_at ASC, id ASC
+		LIMIT $4
+	`
+	rows, err := r.db.Query(ctx, query, groupIDs, after.Time, after.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []DeletionInfo
+	for rows.Next() {
+		var del DeletionInfo
+		if err := rows.Scan(&del.ID, &del.DeletedAt); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, del)
+	}
+
+	return deletions, rows.Err()
+}
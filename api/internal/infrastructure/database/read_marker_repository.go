@@ -0,0 +1,160 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ReadMarkerRepository handles group read marker database operations
+type ReadMarkerRepository struct {
+	db Querier
+}
+
+// NewReadMarkerRepository creates a new read marker repository
+func NewReadMarkerRepository(pool *Pool) *ReadMarkerRepository {
+	return &ReadMarkerRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *ReadMarkerRepository) WithQuerier(q Querier) *ReadMarkerRepository {
+	return &ReadMarkerRepository{db: q}
+}
+
+// Advance moves a device's read marker for a group forward to the marker's position, creating it
+// if needed. A marker is never moved backwards: if the stored one is already at or past the
+// position, it is left alone. Either way the marker is updated to the stored row, and the
+// returned bool reports whether it moved.
+func (r *ReadMarkerRepository) Advance(ctx context.Context, marker *domain.ReadMarker) (bool, error) {
+	query := `
+		INSERT INTO group_read_markers (id, device_id, group_id, last_read_message_id, last_read_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (device_id, group_id) DO UPDATE
+		SET last_read_message_id = EXCLUDED.last_read_message_id,
+		    last_read_at = EXCLUDED.last_read_at,
+		    updated_at = EXCLUDED.updated_at
+		WHERE (group_read_markers.last_read_at, group_read_markers.last_read_message_id)
+		    < (EXCLUDED.last_read_at, EXCLUDED.last_read_message_id)
+		RETURNING id, last_read_message_id, last_read_at, updated_at
+	`
+	err := r.db.QueryRow(ctx, query,
+		marker.ID,
+		marker.DeviceID,
+		marker.GroupID,
+		marker.LastReadMessageID,
+		marker.LastReadAt,
+		time.Now(),
+	).Scan(&marker.ID, &marker.LastReadMessageID, &marker.LastReadAt, &marker.UpdatedAt)
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return false, err
+	}
+
+	// The stored marker is already further along
+	query = `
+		SELECT id, last_read_message_id, last_read_at, updated_at
+		FROM group_read_markers
+		WHERE device_id = $1 AND group_id = $2
+	`
+	err = r.db.QueryRow(ctx, query, marker.DeviceID, marker.GroupID).
+		Scan(&marker.ID, &marker.LastReadMessageID, &marker.LastReadAt, &marker.UpdatedAt)
+	if err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// UnreadCount is a device's unread message counts in a group. Its own messages are never unread.
+type UnreadCount struct {
+	GroupID           string     `json:"group_id"`
+	Unread            int        `json:"unread"`
+	UnreadSOS         int        `json:"unread_sos"`
+	LastReadMessageID *string    `json:"last_read_message_id,omitempty"`
+	LastReadAt        *time.Time `json:"last_read_at,omitempty"` // Nil if the device never marked the group read
+}
+
+// CountUnread counts a device's unread messages in each of the given groups, in the groups' order.
+// Without a read marker, every live message in the group is unread.
+func (r *ReadMarkerRepository) CountUnread(ctx context.Context, deviceID string, groupIDs []string) ([]UnreadCount, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+
+	query := `
+		SELECT g.group_id,
+		       COUNT(m.id),
+		       COUNT(m.id) FILTER (WHERE m.message_type = 'sos'),
+		       rm.last_read_message_id,
+		       rm.last_read_at
+		FROM unnest($2::varchar[]) WITH ORDINALITY AS g(group_id, position)
+		LEFT JOIN group_read_markers rm ON rm.group_id = g.group_id AND rm.device_id = $1
+		LEFT JOIN messages m ON m.group_id = g.group_id
+		  AND m.deleted_at IS NULL
+		  AND m.device_id <> $1
+		  AND (rm.id IS NULL OR (m.created_at, m.id) > (rm.last_read_at, rm.last_read_message_id))
+		GROUP BY g.group_id, g.position, rm.last_read_message_id, rm.last_read_at
+		ORDER BY g.position
+	`
+	rows, err := r.db.Query(ctx, query, deviceID, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []UnreadCount
+	for rows.Next() {
+		var count UnreadCount
+		if err := rows.Scan(
+			&count.GroupID,
+			&count.Unread,
+			&count.UnreadSOS,
+			&count.LastReadMessageID,
+			&count.LastReadAt,
+		); err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
+
+// GetMarkersAfter retrieves a device's read markers positioned after the cursor, ordered by (updated_at, id)
+func (r *ReadMarkerRepository) GetMarkersAfter(ctx context.Context, deviceID string, after Cursor, limit int) ([]*domain.ReadMarker, error) {
+	query := `
+		SELECT id, device_id, group_id, last_read_message_id, last_read_at, updated_at
+		FROM group_read_markers
+		WHERE device_id = $1 AND (updated_at, id) > ($2, $3)
+		ORDER BY updated_at ASC, id ASC
+		LIMIT $4
+	`
+	rows, err := r.db.Query(ctx, query, deviceID, after.Time, after.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var markers []*domain.ReadMarker
+	for rows.Next() {
+		var marker domain.ReadMarker
+		if err := rows.Scan(
+			&marker.ID,
+			&marker.DeviceID,
+			&marker.GroupID,
+			&marker.LastReadMessageID,
+			&marker.LastReadAt,
+			&marker.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		markers = append(markers, &marker)
+	}
+
+	return markers, rows.Err()
+}
@@ -10,40 +10,77 @@ import (
 
 // ReplicationRepository handles replication checkpoint operations for all collections
 type ReplicationRepository struct {
-	pool *Pool
+	db Querier
 }
 
 // NewReplicationRepository creates a new replication repository
 func NewReplicationRepository(pool *Pool) *ReplicationRepository {
-	return &ReplicationRepository{pool: pool}
+	return &ReplicationRepository{db: pool}
 }
 
-// GetCheckpoint returns the last checkpoint for a device and collection
-func (r *ReplicationRepository) GetCheckpoint(ctx context.Context, deviceID string, collection string) (time.Time, error) {
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *ReplicationRepository) WithQuerier(q Querier) *ReplicationRepository {
+	return &ReplicationRepository{db: q}
+}
+
+// GetCheckpoint returns the last checkpoint cursor for a device and collection
+func (r *ReplicationRepository) GetCheckpoint(ctx context.Context, deviceID string, collection string) (Cursor, error) {
 	query := `
-		SELECT checkpoint
+		SELECT checkpoint, checkpoint_id
 		FROM replication_checkpoints
 		WHERE device_id = $1 AND collection = $2
 	`
 	var checkpoint time.Time
-	err := r.pool.QueryRow(ctx, query, deviceID, collection).Scan(&checkpoint)
+	var checkpointID string
+	err := r.db.QueryRow(ctx, query, deviceID, collection).Scan(&checkpoint, &checkpointID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Cursor{}, errors.New("checkpoint not found")
+		}
+		return Cursor{}, err
+	}
+	return NewCursor(checkpoint, checkpointID), nil
+}
+
+// UpsertCheckpoint updates the last checkpoint cursor for a device and collection, and marks it synced now
+func (r *ReplicationRepository) UpsertCheckpoint(ctx context.Context, deviceID string, collection string, checkpoint Cursor) error {
+	query := `
+		INSERT INTO replication_checkpoints (device_id, collection, checkpoint, checkpoint_id, synced_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (device_id, collection)
+		DO UPDATE SET checkpoint = EXCLUDED.checkpoint, checkpoint_id = EXCLUDED.checkpoint_id, synced_at = NOW()
+	`
+	_, err := r.db.Exec(ctx, query, deviceID, collection, checkpoint.Time, checkpoint.ID)
+	return err
+}
+
+// GetSyncedAt returns when a device last pulled a collection, or nil if it never has
+func (r *ReplicationRepository) GetSyncedAt(ctx context.Context, deviceID string, collection string) (*time.Time, error) {
+	query := `
+		SELECT synced_at
+		FROM replication_checkpoints
+		WHERE device_id = $1 AND collection = $2
+	`
+	var syncedAt time.Time
+	err := r.db.QueryRow(ctx, query, deviceID, collection).Scan(&syncedAt)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return time.Time{}, errors.New("checkpoint not found")
+			return nil, nil // Never synced, not an error
 		}
-		return time.Time{}, err
+		return nil, err
 	}
-	return checkpoint, nil
+	return &syncedAt, nil
 }
 
-// UpsertCheckpoint updates the last checkpoint for a device and collection
-func (r *ReplicationRepository) UpsertCheckpoint(ctx context.Context, deviceID string, collection string, checkpoint time.Time) error {
+// MarkSynced records that a device pulled a collection without moving its checkpoint.
+// If the device has no checkpoint for the collection yet, checkpoint is stored as its first one.
+func (r *ReplicationRepository) MarkSynced(ctx context.Context, deviceID string, collection string, checkpoint Cursor) error {
 	query := `
-		INSERT INTO replication_checkpoints (device_id, collection, checkpoint)
-		VALUES ($1, $2, $3)
+		INSERT INTO replication_checkpoints (device_id, collection, checkpoint, checkpoint_id, synced_at)
+		VALUES ($1, $2, $3, $4, NOW())
 		ON CONFLICT (device_id, collection)
-		DO UPDATE SET checkpoint = EXCLUDED.checkpoint
+		DO UPDATE SET synced_at = NOW()
 	`
-	_, err := r.pool.Exec(ctx, query, deviceID, collection, checkpoint)
+	_, err := r.db.Exec(ctx, query, deviceID, collection, checkpoint.Time, checkpoint.ID)
 	return err
 }
@@ -0,0 +1,324 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// sosIncidentColumns are the columns scanned by scanSOSIncident. Queries using it alias the
+// incident as i and join its message as m.
+const sosIncidentColumns = `i.id, i.group_id, i.device_id, m.sos_type, i.state, i.created_at, i.updated_at,
+		       i.acknowledged_at, i.resolved_at, i.resolved_by, i.escalated_at`
+
+// sosIncidentJoin joins an incident's SOS message; incidents of deleted messages are left out
+const sosIncidentJoin = `JOIN messages m ON m.id = i.id AND m.deleted_at IS NULL`
+
+// SOSIncidentRepository handles SOS incidents and their responders. Incidents are created
+// with their SOS message by MessageRepository.InsertMessages.
+type SOSIncidentRepository struct {
+	db Querier
+}
+
+// NewSOSIncidentRepository creates a new SOS incident repository
+func NewSOSIncidentRepository(pool *Pool) *SOSIncidentRepository {
+	return &SOSIncidentRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *SOSIncidentRepository) WithQuerier(q Querier) *SOSIncidentRepository {
+	return &SOSIncidentRepository{db: q}
+}
+
+// GetByID retrieves an incident and its responders. Incidents of deleted messages are not found.
+func (r *SOSIncidentRepository) GetByID(ctx context.Context, id string) (*domain.SOSIncident, error) {
+	query := `SELECT ` + sosIncidentColumns + ` FROM sos_incidents i ` + sosIncidentJoin + ` WHERE i.id = $1`
+	incident, err := scanSOSIncident(r.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errors.New("SOS incident not found")
+		}
+		return nil, err
+	}
+	if err := r.loadResponders(ctx, []*domain.SOSIncident{incident}); err != nil {
+		return nil, err
+	}
+	return incident, nil
+}
+
+// GetByGroup retrieves a group's incidents in any of the given states (all if none), newest first
+func (r *SOSIncidentRepository) GetByGroup(ctx context.Context, groupID string, states []domain.SOSState, limit int) ([]*domain.SOSIncident, error) {
+	stateFilter := make([]string, 0, len(states))
+	for _, state := range states {
+		stateFilter = append(stateFilter, string(state))
+	}
+
+	query := `
+		SELECT ` + sosIncidentColumns + `
+		FROM sos_incidents i
+		` + sosIncidentJoin + `
+		WHERE i.group_id = $1 AND (cardinality($2::text[]) = 0 OR i.state = ANY($2))
+		ORDER BY i.created_at DESC, i.id DESC
+		LIMIT $3
+	`
+	rows, err := r.db.Query(ctx, query, groupID, stateFilter, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := make([]*domain.SOSIncident, 0)
+	for rows.Next() {
+		incident, err := scanSOSIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, incident)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := r.loadResponders(ctx, incidents); err != nil {
+		return nil, err
+	}
+	return incidents, nil
+}
+
+// Transition moves an incident to a state, provided it is currently in one of the states it
+// may move from. Returns false if the incident wasn't in such a state.
+func (r *SOSIncidentRepository) Transition(ctx context.Context, id string, to domain.SOSState, deviceID string, at time.Time) (bool, error) {
+	from := make([]string, 0)
+	for _, state := range to.StatesBefore() {
+		from = append(from, string(state))
+	}
+
+	query := `
+		UPDATE sos_incidents
+		SET state = $2,
+		    updated_at = $4,
+		    acknowledged_at = COALESCE(acknowledged_at, $4),
+		    resolved_at = CASE WHEN $2 = 'resolved' THEN $4 ELSE resolved_at END,
+		    resolved_by = CASE WHEN $2 = 'resolved' THEN $3 ELSE resolved_by END
+		WHERE id = $1 AND state = ANY($5)
+	`
+	result, err := r.db.Exec(ctx, query, id, string(to), deviceID, at, from)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// AddResponder records a device claiming an unresolved incident. Returns false if it already had.
+func (r *SOSIncidentRepository) AddResponder(ctx context.Context, id, deviceID string, at time.Time) (bool, error) {
+	query := `
+		WITH claimed AS (
+			INSERT INTO sos_responders (incident_id, device_id, claimed_at)
+			SELECT id, $2, $3 FROM sos_incidents WHERE id = $1 AND state <> 'resolved'
+			ON CONFLICT (incident_id, device_id) DO NOTHING
+			RETURNING incident_id
+		)
+		UPDATE sos_incidents SET updated_at = $3
+		WHERE id IN (SELECT incident_id FROM claimed)
+	`
+	result, err := r.db.Exec(ctx, query, id, deviceID, at)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// RemoveResponder removes a device's claim on an incident. Returns false if it had none.
+func (r *SOSIncidentRepository) RemoveResponder(ctx context.Context, id, deviceID string, at time.Time) (bool, error) {
+	query := `
+		WITH released AS (
+			DELETE FROM sos_responders WHERE incident_id = $1 AND device_id = $2
+			RETURNING incident_id
+		)
+		UPDATE sos_incidents SET updated_at = $3
+		WHERE id IN (SELECT incident_id FROM released)
+	`
+	result, err := r.db.Exec(ctx, query, id, deviceID, at)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// GetDueForEscalation retrieves open incidents opened after the cursor and before createdBefore
+// that were never escalated or still have escalations deferred by a cooldown, ordered by
+// (created_at, id). An incident whose SOS has a live ack or responding reaction was handled by
+// a neighbour and is never due. Incidents are stamped with server time when opened, so an SOS
+// queued offline is due a delay after it reached the server. Responders are not loaded.
+func (r *SOSIncidentRepository) GetDueForEscalation(ctx context.Context, after Cursor, createdBefore time.Time, limit int) ([]*domain.SOSIncident, error) {
+	query := `
+		SELECT ` + sosIncidentColumns + `
+		FROM sos_incidents i
+		` + sosIncidentJoin + `
+		WHERE i.state = 'open' AND (i.escalated_at IS NULL OR i.escalation_pending)
+		  AND (i.created_at, i.id) > ($1, $2) AND i.created_at < $3
+		  AND NOT EXISTS (
+			SELECT 1 FROM message_reactions r
+			WHERE r.message_id = i.id AND r.kind IN ('ack', 'responding') AND r.deleted_at IS NULL
+		  )
+		ORDER BY i.created_at ASC, i.id ASC
+		LIMIT $4
+	`
+	rows, err := r.db.Query(ctx, query, after.Time, after.ID, createdBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var incidents []*domain.SOSIncident
+	for rows.Next() {
+		incident, err := scanSOSIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, incident)
+	}
+
+	return incidents, rows.Err()
+}
+
+// ClaimForEscalation locks an incident for escalation until the end of the caller's transaction,
+// if it is still open, unanswered by reactions and due, and refreshes its escalated_at. Returns false if it isn't, or
+// another instance holds the lock.
+func (r *SOSIncidentRepository) ClaimForEscalation(ctx context.Context, incident *domain.SOSIncident) (bool, error) {
+	query := `
+		SELECT i.escalated_at FROM sos_incidents i
+		WHERE i.id = $1 AND i.state = 'open' AND (i.escalated_at IS NULL OR i.escalation_pending)
+		  AND NOT EXISTS (
+			SELECT 1 FROM message_reactions r
+			WHERE r.message_id = i.id AND r.kind IN ('ack', 'responding') AND r.deleted_at IS NULL
+		  )
+		FOR UPDATE OF i SKIP LOCKED
+	`
+	err := r.db.QueryRow(ctx, query, incident.ID).Scan(&incident.EscalatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// MarkEscalated records an escalation pass over an incident. The first pass sets escalated_at;
+// pending keeps the incident due while some groups' escalations are deferred.
+func (r *SOSIncidentRepository) MarkEscalated(ctx context.Context, id string, at time.Time, pending bool) error {
+	query := `
+		UPDATE sos_incidents
+		SET escalated_at = COALESCE(escalated_at, $2),
+		    updated_at = CASE WHEN escalated_at IS NULL THEN $2 ELSE updated_at END,
+		    escalation_pending = $3
+		WHERE id = $1
+	`
+	_, err := r.db.Exec(ctx, query, id, at, pending)
+	return err
+}
+
+// GetEscalatedGroupIDs returns the groups an incident was already escalated to
+func (r *SOSIncidentRepository) GetEscalatedGroupIDs(ctx context.Context, incidentID string) (map[string]bool, error) {
+	rows, err := r.db.Query(ctx, `SELECT group_id FROM sos_escalations WHERE incident_id = $1`, incidentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groupIDs := make(map[string]bool)
+	for rows.Next() {
+		var groupID string
+		if err := rows.Scan(&groupID); err != nil {
+			return nil, err
+		}
+		groupIDs[groupID] = true
+	}
+	return groupIDs, rows.Err()
+}
+
+// RecordEscalation records an incident being escalated to a group, unless the group had an
+// escalation from the same origin group since cooldownSince. Returns false if the escalation
+// should be deferred until the cooldown ends.
+func (r *SOSIncidentRepository) RecordEscalation(ctx context.Context, incidentID, originGroupID, groupID string, at, cooldownSince time.Time) (bool, error) {
+	query := `
+		INSERT INTO sos_escalations (incident_id, origin_group_id, group_id, escalated_at)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (
+			SELECT 1 FROM sos_escalations
+			WHERE origin_group_id = $2 AND group_id = $3 AND escalated_at > $5
+		)
+		ON CONFLICT (incident_id, group_id) DO NOTHING
+	`
+	result, err := r.db.Exec(ctx, query, incidentID, originGroupID, groupID, at, cooldownSince)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// loadResponders fills in the responders of each incident, earliest claim first
+func (r *SOSIncidentRepository) loadResponders(ctx context.Context, incidents []*domain.SOSIncident) error {
+	if len(incidents) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*domain.SOSIncident, len(incidents))
+	ids := make([]string, 0, len(incidents))
+	for _, incident := range incidents {
+		incident.Responders = []domain.SOSResponder{}
+		byID[incident.ID] = incident
+		ids = append(ids, incident.ID)
+	}
+
+	query := `
+		SELECT incident_id, device_id, claimed_at
+		FROM sos_responders
+		WHERE incident_id = ANY($1)
+		ORDER BY claimed_at ASC, device_id ASC
+	`
+	rows, err := r.db.Query(ctx, query, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var incidentID string
+		var responder domain.SOSResponder
+		if err := rows.Scan(&incidentID, &responder.DeviceID, &responder.ClaimedAt); err != nil {
+			return err
+		}
+		byID[incidentID].Responders = append(byID[incidentID].Responders, responder)
+	}
+
+	return rows.Err()
+}
+
+// scanSOSIncident scans a row selected with sosIncidentColumns
+func scanSOSIncident(row pgx.Row) (*domain.SOSIncident, error) {
+	var incident domain.SOSIncident
+	var state string
+	if err := row.Scan(
+		&incident.ID,
+		&incident.GroupID,
+		&incident.DeviceID,
+		&incident.SOSType,
+		&state,
+		&incident.CreatedAt,
+		&incident.UpdatedAt,
+		&incident.AcknowledgedAt,
+		&incident.ResolvedAt,
+		&incident.ResolvedBy,
+		&incident.EscalatedAt,
+	); err != nil {
+		return nil, err
+	}
+	incident.State = domain.SOSState(state)
+	return &incident, nil
+}
@@ -12,24 +12,36 @@ import (
 
 // StatusRepository handles user status database operations
 type StatusRepository struct {
-	pool *Pool
+	db Querier
 }
 
 // NewStatusRepository creates a new status repository
 func NewStatusRepository(pool *Pool) *StatusRepository {
-	return &StatusRepository{pool: pool}
+	return &StatusRepository{db: pool}
+}
+
+// WithQuerier returns a copy of the repository that runs its queries on q (e.g. a transaction)
+func (r *StatusRepository) WithQuerier(q Querier) *StatusRepository {
+	return &StatusRepository{db: q}
 }
 
 // Upsert creates or updates a user status
 func (r *StatusRepository) Upsert(ctx context.Context, status *domain.UserStatus) error {
 	query := `
-		INSERT INTO user_status (id, device_id, status_type, description, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO user_status (id, device_id, status_type, description, created_at, updated_at, client_updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 		ON CONFLICT (device_id) 
 		DO UPDATE SET 
 			status_type = EXCLUDED.status_type,
 			description = EXCLUDED.description,
-			updated_at = EXCLUDED.updated_at
+			updated_at = EXCLUDED.updated_at,
+			revision = user_status.revision + 1,
+			field_revisions = user_status.field_revisions || jsonb_build_object(
+				'status_type', user_status.revision + 1,
+				'description', user_status.revision + 1
+			),
+			client_updated_at = EXCLUDED.client_updated_at
+		RETURNING revision
 	`
 	now := time.Now()
 	if status.CreatedAt.IsZero() {
@@ -37,24 +49,66 @@ func (r *StatusRepository) Upsert(ctx context.Context, status *domain.UserStatus
 	}
 	status.UpdatedAt = now
 
-	_, err := r.pool.Exec(ctx, query,
+	err := r.db.QueryRow(ctx, query,
 		status.ID,
 		status.DeviceID,
 		string(status.StatusType),
 		status.Description,
 		status.CreatedAt,
 		status.UpdatedAt,
-	)
+		status.ClientUpdatedAt,
+	).Scan(&status.Revision)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// UpdateFields writes the given fields of a status if it is still at expectedRevision,
+// bumping its revision and recording which fields changed.
+// Returns false if the status changed concurrently.
+func (r *StatusRepository) UpdateFields(ctx context.Context, status *domain.UserStatus, fields []string, expectedRevision int64) (bool, error) {
+	changed := make(map[string]int64, len(fields))
+	for _, field := range fields {
+		changed[field] = expectedRevision + 1
+	}
+
+	query := `
+		UPDATE user_status
+		SET status_type = $1,
+		    description = $2,
+		    updated_at = $3,
+		    revision = revision + 1,
+		    field_revisions = field_revisions || $4::jsonb,
+		    client_updated_at = $5
+		WHERE id = $6 AND revision = $7
+	`
+	now := time.Now()
+	result, err := r.db.Exec(ctx, query,
+		string(status.StatusType),
+		status.Description,
+		now,
+		changed,
+		status.ClientUpdatedAt,
+		status.ID,
+		expectedRevision,
+	)
+	if err != nil {
+		return false, err
+	}
+	if result.RowsAffected() == 0 {
+		return false, nil
+	}
+	status.UpdatedAt = now
+	status.Revision = expectedRevision + 1
+	return true, nil
+}
+
 // GetByDeviceID retrieves a user status by device ID
 func (r *StatusRepository) GetByDeviceID(ctx context.Context, deviceID string) (*domain.UserStatus, error) {
 	query := `
-		SELECT id, device_id, status_type, description, created_at, updated_at
+		SELECT id, device_id, status_type, description, created_at, updated_at,
+		       revision, field_revisions, client_updated_at
 		FROM user_status
 		WHERE device_id = $1
 		LIMIT 1
@@ -62,13 +116,16 @@ func (r *StatusRepository) GetByDeviceID(ctx context.Context, deviceID string) (
 	var status domain.UserStatus
 	var statusType string
 	var description *string
-	err := r.pool.QueryRow(ctx, query, deviceID).Scan(
+	err := r.db.QueryRow(ctx, query, deviceID).Scan(
 		&status.ID,
 		&status.DeviceID,
 		&statusType,
 		&description,
 		&status.CreatedAt,
 		&status.UpdatedAt,
+		&status.Revision,
+		&status.FieldRevisions,
+		&status.ClientUpdatedAt,
 	)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -110,7 +167,7 @@ func (r *StatusRepository) GetGroupStatusSummary(ctx context.Context, groupID st
 		LEFT JOIN user_status us ON gd.device_id = us.device_id
 	`
 	var summary StatusSummary
-	err := r.pool.QueryRow(ctx, query, groupID).Scan(
+	err := r.db.QueryRow(ctx, query, groupID).Scan(
 		&summary.SafeCount,
 		&summary.NeedHelpCount,
 		&summary.CannotContactCount,
@@ -122,17 +179,18 @@ func (r *StatusRepository) GetGroupStatusSummary(ctx context.Context, groupID st
 	return &summary, nil
 }
 
-// GetStatusesAfter retrieves user statuses updated after a given timestamp for a device
+// GetStatusesAfter retrieves user statuses positioned after the cursor for a device, ordered by (updated_at, id)
 // Excludes soft-deleted statuses (deleted_at IS NULL)
-func (r *StatusRepository) GetStatusesAfter(ctx context.Context, deviceID string, since time.Time, limit int) ([]*domain.UserStatus, error) {
+func (r *StatusRepository) GetStatusesAfter(ctx context.Context, deviceID string, after Cursor, limit int) ([]*domain.UserStatus, error) {
 	query := `
-		SELECT id, device_id, status_type, description, created_at, updated_at
+		SELECT id, device_id, status_type, description, created_at, updated_at,
+		       revision, field_revisions, client_updated_at
 		FROM user_status
-		WHERE deleted_at IS NULL AND device_id = $1 AND updated_at > $2
-		ORDER BY updated_at ASC
-		LIMIT $3
+		WHERE deleted_at IS NULL AND device_id = $1 AND (updated_at, id) > ($2, $3)
+		ORDER BY updated_at ASC, id ASC
+		LIMIT $4
 	`
-	rows, err := r.pool.Query(ctx, query, deviceID, since, limit)
+	rows, err := r.db.Query(ctx, query, deviceID, after.Time, after.ID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -150,6 +208,9 @@ func (r *StatusRepository) GetStatusesAfter(ctx context.Context, deviceID string
 			&description,
 			&status.CreatedAt,
 			&status.UpdatedAt,
+			&status.Revision,
+			&status.FieldRevisions,
+			&status.ClientUpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -161,16 +222,16 @@ func (r *StatusRepository) GetStatusesAfter(ctx context.Context, deviceID string
 	return statuses, rows.Err()
 }
 
-// GetDeletionsAfter retrieves IDs and timestamps of statuses deleted after a given timestamp for a device
-func (r *StatusRepository) GetDeletionsAfter(ctx context.Context, deviceID string, since time.Time, limit int) ([]DeletionInfo, error) {
+// GetDeletionsAfter retrieves IDs and timestamps of statuses deleted for a device after the cursor, ordered by (deleted_at, id)
+func (r *StatusRepository) GetDeletionsAfter(ctx context.Context, deviceID string, after Cursor, limit int) ([]DeletionInfo, error) {
 	query := `
 		SELECT id, deleted_at
 		FROM user_status
-		WHERE deleted_at > $1 AND deleted_at IS NOT NULL AND device_id = $2
-		ORDER BY deleted_at ASC
-		LIMIT $3
+		WHERE device_id = $1 AND deleted_at IS NOT NULL AND (deleted_at, id) > ($2, $3)
+		ORDER BY deleted_at ASC, id ASC
+		LIMIT $4
 	`
-	rows, err := r.pool.Query(ctx, query, since, deviceID, limit)
+	rows, err := r.db.Query(ctx, query, deviceID, after.Time, after.ID, limit)
 	if err != nil {
 		return nil, err
 	}
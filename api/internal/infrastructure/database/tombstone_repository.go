@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TombstoneTables lists the soft-deleted tables, children before parents so that purging a
+// parent doesn't cascade into tombstones that haven't been counted yet
+var TombstoneTables = []string{
+	"pinned_messages",
+	"message_reactions",
+	"favorite_groups",
+	"messages",
+	"user_status",
+	"groups",
+}
+
+// tombstonePurgeBatchSize bounds how many rows a single purge statement deletes, to keep locks short
+const tombstonePurgeBatchSize = 1000
+
+// TombstoneRepository removes soft-deleted rows once clients no longer need their deletion signals
+type TombstoneRepository struct {
+	db Querier
+}
+
+// NewTombstoneRepository creates a new tombstone repository
+func NewTombstoneRepository(pool *Pool) *TombstoneRepository {
+	return &TombstoneRepository{db: pool}
+}
+
+// Purge hard-deletes the rows of table that were soft-deleted before the given time.
+// table must be one of TombstoneTables. Returns the number of rows removed.
+func (r *TombstoneRepository) Purge(ctx context.Context, table string, before time.Time) (int64, error) {
+	if !isTombstoneTable(table) {
+		return 0, fmt.Errorf("not a soft-deleted table: %s", table)
+	}
+
+	// Table names can't be parameters; table is checked against TombstoneTables above
+	query := `
+		DELETE FROM ` + table + `
+		WHERE ctid IN (
+			SELECT ctid FROM ` + table + `
+			WHERE deleted_at IS NOT NULL AND deleted_at < $1
+			LIMIT $2
+		)
+	`
+	var purged int64
+	for {
+		result, err := r.db.Exec(ctx, query, before, tombstonePurgeBatchSize)
+		if err != nil {
+			return purged, err
+		}
+		purged += result.RowsAffected()
+		if result.RowsAffected() < tombstonePurgeBatchSize {
+			return purged, nil
+		}
+	}
+}
+
+func isTombstoneTable(table string) bool {
+	for _, t := range TombstoneTables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
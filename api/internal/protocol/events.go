@@ -0,0 +1,193 @@
+package protocol
+
+// ConnectedEvent is sent once after the connection is registered
+type ConnectedEvent struct {
+	ClientID          string `json:"clientId"`
+	ProtocolVersion   int    `json:"protocolVersion"`   // Version negotiated for this connection
+	SupportedVersions []int  `json:"supportedVersions"` // Every version the server accepts
+}
+
+// SubscribedEvent confirms a subscription
+type SubscribedEvent struct {
+	GroupIDs []string             `json:"groupIds"`
+	Seq      map[string]int64     `json:"seq"`              // group ID -> current sequence
+	Denied   map[string]ErrorCode `json:"denied,omitempty"` // group ID -> reason, for requested groups that were not subscribed
+}
+
+// UnsubscribedEvent confirms an unsubscription
+type UnsubscribedEvent struct {
+	GroupIDs []string `json:"groupIds"`
+}
+
+// ResyncRequiredEvent tells the client missed events can't be replayed and it must pull instead
+type ResyncRequiredEvent struct {
+	GroupID    string `json:"groupId"`
+	LastSeq    int64  `json:"lastSeq"`
+	CurrentSeq int64  `json:"currentSeq"`
+}
+
+// NewMessageEvent is broadcast when a message is stored
+type NewMessageEvent struct {
+	ID             string         `json:"id"`
+	GroupID        string         `json:"groupId"`
+	DeviceID       string         `json:"deviceId"`
+	Content        string         `json:"content"`
+	MessageType    string         `json:"messageType"`
+	SOSType        *string        `json:"sosType"`
+	Tags           []string       `json:"tags"`
+	Pinned         bool           `json:"pinned"`
+	CreatedAt      string         `json:"createdAt"`
+	DeviceSequence *int           `json:"deviceSequence"`
+	ReplyToID      *string        `json:"replyToId,omitempty"`
+	ReplyTo        *QuotedMessage `json:"replyTo,omitempty"` // Quote of the message replied to
+	AttachmentIDs  []string       `json:"attachmentIds,omitempty"`
+	Latitude       *float64       `json:"latitude,omitempty"`
+	Longitude      *float64       `json:"longitude,omitempty"`
+	Accuracy       *float64       `json:"accuracy,omitempty"`
+}
+
+// QuotedMessage is the start of a replied-to message, embedded in its replies
+type QuotedMessage struct {
+	ID       string `json:"id"`
+	DeviceID string `json:"deviceId"`
+	Snippet  string `json:"snippet"`
+	Deleted  bool   `json:"deleted"`
+}
+
+// MessageSentEvent acknowledges a send_message request to its sender
+type MessageSentEvent struct {
+	MessageID string `json:"messageId"`
+}
+
+// MessagePinnedEvent is broadcast when a device pins a message
+type MessagePinnedEvent struct {
+	MessageID string  `json:"messageId"`
+	GroupID   string  `json:"groupId"`
+	DeviceID  string  `json:"deviceId"`
+	PinnedAt  string  `json:"pinnedAt"`
+	Tag       *string `json:"tag"`
+}
+
+// MessageUnpinnedEvent is broadcast when a device unpins a message
+type MessageUnpinnedEvent struct {
+	MessageID string `json:"messageId"`
+	GroupID   string `json:"groupId"`
+	DeviceID  string `json:"deviceId"`
+}
+
+// MessageEditedEvent is broadcast when the author edits a message
+type MessageEditedEvent struct {
+	MessageID string `json:"messageId"`
+	GroupID   string `json:"groupId"`
+	DeviceID  string `json:"deviceId"`
+	Content   string `json:"content"`
+	EditedAt  string `json:"editedAt"`
+}
+
+// MessageDeletedEvent is broadcast when the author deletes a message; its pins are gone too
+type MessageDeletedEvent struct {
+	MessageID string `json:"messageId"`
+	GroupID   string `json:"groupId"`
+	DeviceID  string `json:"deviceId"`
+	DeletedAt string `json:"deletedAt"`
+}
+
+// ReactionEvent is broadcast as reaction_added or reaction_removed when a device reacts to a
+// message or takes its reaction back
+type ReactionEvent struct {
+	ReactionID string `json:"reactionId"`
+	MessageID  string `json:"messageId"`
+	GroupID    string `json:"groupId"`
+	DeviceID   string `json:"deviceId"`
+	Kind       string `json:"kind"`
+	Count      int    `json:"count"` // Reactions of this kind on the message after the change
+	UpdatedAt  string `json:"updatedAt"`
+}
+
+// ReadMarkerEvent tells a device's connections how far it has read in a group
+type ReadMarkerEvent struct {
+	GroupID           string `json:"groupId"`
+	LastReadMessageID string `json:"lastReadMessageId,omitempty"`
+	LastReadAt        string `json:"lastReadAt"`
+	UpdatedAt         string `json:"updatedAt"`
+}
+
+// TypingEvent is broadcast as typing_started or typing_stopped. Typing expires on the
+// server unless the client repeats typing_start before ExpiresAt.
+type TypingEvent struct {
+	GroupID   string `json:"groupId"`
+	DeviceID  string `json:"deviceId"`
+	ExpiresAt string `json:"expiresAt,omitempty"` // Set on typing_started
+}
+
+// PresenceEvent is broadcast as presence_join when a device's first connection subscribes
+// to a group, and as presence_leave when its last one goes
+type PresenceEvent struct {
+	GroupID  string `json:"groupId"`
+	DeviceID string `json:"deviceId"`
+}
+
+// LocationEvent is broadcast as location_shared with each position of a live location share,
+// and as location_share_ended when it is stopped or, shortly after ExpiresAt, when it expires.
+type LocationEvent struct {
+	GroupID   string   `json:"groupId"`
+	DeviceID  string   `json:"deviceId"`
+	MessageID *string  `json:"messageId,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"` // Set on location_shared
+	Longitude *float64 `json:"longitude,omitempty"`
+	Accuracy  *float64 `json:"accuracy,omitempty"`
+	UpdatedAt string   `json:"updatedAt,omitempty"`
+	ExpiresAt string   `json:"expiresAt,omitempty"` // Set on location_shared
+}
+
+// SOSIncidentEvent is broadcast as sos_updated whenever an SOS incident changes state or
+// gains or loses a responder. New incidents arrive as an SOS new_message, in the open state.
+type SOSIncidentEvent struct {
+	IncidentID     string         `json:"incidentId"` // The SOS message's ID
+	GroupID        string         `json:"groupId"`
+	DeviceID       string         `json:"deviceId"`
+	State          string         `json:"state"`
+	Responders     []SOSResponder `json:"responders"`
+	UpdatedBy      string         `json:"updatedBy,omitempty"` // Device that made the change; empty for escalation
+	UpdatedAt      string         `json:"updatedAt"`
+	AcknowledgedAt string         `json:"acknowledgedAt,omitempty"`
+	ResolvedAt     string         `json:"resolvedAt,omitempty"`
+	ResolvedBy     *string        `json:"resolvedBy,omitempty"`
+	EscalatedAt    string         `json:"escalatedAt,omitempty"`
+}
+
+// SOSEscalatedEvent is broadcast as sos_escalated to the groups near an SOS incident's group
+// once it has stayed open too long. GroupID is the group receiving the event.
+type SOSEscalatedEvent struct {
+	IncidentID      string   `json:"incidentId"`
+	GroupID         string   `json:"groupId"`
+	OriginGroupID   string   `json:"originGroupId"`
+	OriginGroupName string   `json:"originGroupName"`
+	DeviceID        string   `json:"deviceId"`
+	SOSType         *string  `json:"sosType"`
+	Content         string   `json:"content"`
+	Latitude        float64  `json:"latitude"` // Where the SOS was sent from, or else its group's location
+	Longitude       float64  `json:"longitude"`
+	Accuracy        *float64 `json:"accuracy,omitempty"`
+	DistanceMeters  float64  `json:"distanceMeters"` // From the receiving group's location
+	CreatedAt       string   `json:"createdAt"`      // When the SOS was sent
+	EscalatedAt     string   `json:"escalatedAt"`
+}
+
+// SOSResponder is a device that claimed an SOS incident
+type SOSResponder struct {
+	DeviceID  string `json:"deviceId"`
+	ClaimedAt string `json:"claimedAt"`
+}
+
+// PongEvent answers an application-level ping
+type PongEvent struct{}
+
+// ErrorEvent describes a failed request
+type ErrorEvent struct {
+	Code        ErrorCode `json:"code"`
+	Error       string    `json:"error"`
+	RequestType string    `json:"requestType,omitempty"`
+	RequestID   string    `json:"requestId,omitempty"`
+	RetryAfter  int       `json:"retryAfter,omitempty"` // Seconds until a rate-limited request may be retried
+}
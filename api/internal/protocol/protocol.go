@@ -0,0 +1,213 @@
+// Package protocol defines the versioned WebSocket wire format shared by the API,
+// the web client and bots: frame envelopes, typed request/event payloads and error codes.
+// It has no dependencies on the rest of the API so other programs can import it directly.
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// Version is the newest protocol version this server speaks
+	Version = 1
+	// MinVersion is the oldest protocol version this server still accepts
+	MinVersion = 1
+)
+
+// Client -> server frame types
+const (
+	TypeSubscribe      = "subscribe"
+	TypeUnsubscribe    = "unsubscribe"
+	TypeSendMessage    = "send_message"
+	TypePinMessage     = "pin_message"
+	TypeUnpinMessage   = "unpin_message"
+	TypeEditMessage    = "edit_message"
+	TypeDeleteMessage  = "delete_message"
+	TypeAddReaction    = "add_reaction"
+	TypeRemoveReaction = "remove_reaction"
+	TypeMarkRead       = "mark_read"
+	TypeTypingStart    = "typing_start"
+	TypeTypingStop     = "typing_stop"
+	TypeShareLocation  = "share_location"
+	TypeUpdateSOS      = "update_sos"
+	TypeClaimSOS       = "claim_sos"
+	TypeReleaseSOS     = "release_sos"
+	TypePing           = "ping"
+)
+
+// Server -> client frame types
+const (
+	TypeConnected       = "connected"
+	TypeSubscribed      = "subscribed"
+	TypeUnsubscribed    = "unsubscribed"
+	TypeResyncRequired  = "resync_required"
+	TypeNewMessage      = "new_message"
+	TypeMessageSent     = "message_sent"
+	TypeMessagePinned   = "message_pinned"
+	TypeMessageUnpinned = "message_unpinned"
+	TypeMessageEdited   = "message_edited"
+	TypeMessageDeleted  = "message_deleted"
+	TypeReactionAdded   = "reaction_added"
+	TypeReactionRemoved = "reaction_removed"
+	TypeReadMarker      = "read_marker" // sent to the device's own connections when it marks a group read
+	TypeTypingStarted   = "typing_started"
+	TypeTypingStopped   = "typing_stopped"
+	TypePresenceJoin    = "presence_join"
+	TypePresenceLeave   = "presence_leave"
+	TypeLocationShared  = "location_shared"
+	TypeLocationEnded   = "location_share_ended"
+	TypeSOSUpdated      = "sos_updated"
+	TypeSOSEscalated    = "sos_escalated" // an SOS left open in a nearby group
+	TypePong            = "pong"
+	TypeError           = "error"
+	TypeMessageError    = "message_error" // error answering a send_message request
+)
+
+// Frame is the envelope for every WebSocket message in both directions
+type Frame struct {
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Timestamp string          `json:"timestamp,omitempty"`
+	MessageID string          `json:"messageId,omitempty"` // Optional client-supplied request ID, echoed in errors
+	Seq       int64           `json:"seq,omitempty"`       // Per-group sequence number, set on broadcast events
+}
+
+// NewFrame builds a frame with the given payload, stamped with the current time
+func NewFrame(frameType string, payload interface{}) Frame {
+	frame := Frame{
+		Type:      frameType,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		// Payloads are plain structs defined in this package; this only happens on programmer error
+		return ErrorFrame(frameType, "", NewError(CodeInternal, "failed to encode payload: %v", err))
+	}
+	frame.Payload = data
+	return frame
+}
+
+// Request is implemented by every client request payload
+type Request interface {
+	Validate() error
+}
+
+// DecodePayload strictly decodes a frame payload into req and validates it.
+// Unknown fields, wrong JSON types and failed validation all return an *Error.
+func DecodePayload(frame Frame, req Request) error {
+	payload := frame.Payload
+	if len(payload) == 0 || bytes.Equal(payload, []byte("null")) {
+		payload = []byte("{}")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(req); err != nil {
+		return NewError(CodeInvalidPayload, "invalid %s payload: %v", frame.Type, err)
+	}
+	if decoder.More() {
+		return NewError(CodeInvalidPayload, "invalid %s payload: unexpected trailing data", frame.Type)
+	}
+
+	if err := req.Validate(); err != nil {
+		var protoErr *Error
+		if errors.As(err, &protoErr) {
+			return protoErr
+		}
+		return NewError(CodeValidationFailed, "%v", err)
+	}
+	return nil
+}
+
+// Negotiate picks the protocol version for a connection. A requested version of 0 means
+// the client didn't ask for one. Clients newer than the server are answered with Version,
+// and it is up to them to downgrade.
+func Negotiate(requested int) (int, error) {
+	if requested == 0 {
+		return Version, nil
+	}
+	if requested < MinVersion {
+		return 0, NewError(CodeUnsupportedVersion, "protocol version %d is no longer supported (min %d)", requested, MinVersion)
+	}
+	if requested > Version {
+		return Version, nil
+	}
+	return requested, nil
+}
+
+// SupportedVersions lists every protocol version this server accepts
+func SupportedVersions() []int {
+	versions := make([]int, 0, Version-MinVersion+1)
+	for v := MinVersion; v <= Version; v++ {
+		versions = append(versions, v)
+	}
+	return versions
+}
+
+// ErrorFrame builds the error frame answering a failed request.
+// send_message failures use message_error for compatibility with existing clients.
+func ErrorFrame(requestType string, requestID string, err error) Frame {
+	var protoErr *Error
+	if !errors.As(err, &protoErr) {
+		protoErr = &Error{Code: CodeInternal, Message: err.Error()}
+	}
+
+	frameType := TypeError
+	if requestType == TypeSendMessage {
+		frameType = TypeMessageError
+	}
+
+	data, _ := json.Marshal(ErrorEvent{
+		Code:        protoErr.Code,
+		Error:       protoErr.Message,
+		RequestType: requestType,
+		RequestID:   requestID,
+		RetryAfter:  protoErr.RetryAfter,
+	})
+	return Frame{
+		Type:      frameType,
+		Payload:   data,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// ErrorCode identifies the class of a protocol error
+type ErrorCode string
+
+const (
+	CodeInvalidFrame       ErrorCode = "invalid_frame"
+	CodeInvalidPayload     ErrorCode = "invalid_payload"
+	CodeValidationFailed   ErrorCode = "validation_failed"
+	CodeUnknownType        ErrorCode = "unknown_type"
+	CodeUnsupportedVersion ErrorCode = "unsupported_version"
+	CodeNotFound           ErrorCode = "not_found"
+	CodeRejected           ErrorCode = "rejected"
+	CodeForbidden          ErrorCode = "forbidden"
+	CodeRateLimited        ErrorCode = "rate_limited"
+	CodeInternal           ErrorCode = "internal_error"
+
+	// Group access denials, matching the service access policy
+	CodeGroupNotFound ErrorCode = "group_not_found"
+	CodeGroupDeleted  ErrorCode = "group_deleted"
+	CodeDeviceBanned  ErrorCode = "device_banned"
+)
+
+// Error is a protocol-level error reported to the client in an error frame
+type Error struct {
+	Code       ErrorCode
+	Message    string
+	RetryAfter int // Seconds until the request may be retried, for CodeRateLimited
+}
+
+// NewError creates a protocol error with a formatted message
+func NewError(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
@@ -0,0 +1,252 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+)
+
+// maxSubscribeGroups caps how many groups a single subscribe frame may name
+const maxSubscribeGroups = 100
+
+// SubscribeRequest is the payload of a subscribe frame
+type SubscribeRequest struct {
+	GroupIDs []string         `json:"groupIds"`
+	LastSeq  map[string]int64 `json:"lastSeq,omitempty"` // group ID -> last sequence seen, to replay missed events
+}
+
+// Validate checks the subscribe payload
+func (r *SubscribeRequest) Validate() error {
+	if err := validateGroupIDs(r.GroupIDs); err != nil {
+		return err
+	}
+	for groupID, seq := range r.LastSeq {
+		if seq < 0 {
+			return fmt.Errorf("lastSeq for group %s must not be negative", groupID)
+		}
+	}
+	return nil
+}
+
+// UnsubscribeRequest is the payload of an unsubscribe frame
+type UnsubscribeRequest struct {
+	GroupIDs []string `json:"groupIds"`
+}
+
+// Validate checks the unsubscribe payload
+func (r *UnsubscribeRequest) Validate() error {
+	return validateGroupIDs(r.GroupIDs)
+}
+
+// SendMessageRequest is the payload of a send_message frame
+type SendMessageRequest struct {
+	GroupID        string   `json:"groupId"`
+	Content        string   `json:"content"`
+	MessageType    string   `json:"messageType,omitempty"` // "text" (default), "sos" or "status_update"
+	SOSType        *string  `json:"sosType,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	DeviceSequence *int     `json:"deviceSequence,omitempty"`
+	ReplyToID      *string  `json:"replyToId,omitempty"`     // Message in the same group this one replies to
+	AttachmentIDs  []string `json:"attachmentIds,omitempty"` // Uploaded via POST /v1/attachments; content may then be empty
+	Latitude       *float64 `json:"latitude,omitempty"`      // Where the message was sent from, e.g. for an SOS
+	Longitude      *float64 `json:"longitude,omitempty"`
+	Accuracy       *float64 `json:"accuracy,omitempty"` // Meters
+}
+
+// Validate checks the send_message payload; content rules are enforced by the domain model
+func (r *SendMessageRequest) Validate() error {
+	if r.GroupID == "" {
+		return errors.New("groupId is required")
+	}
+	switch r.MessageType {
+	case "", "text", "sos", "status_update":
+	default:
+		return fmt.Errorf("unknown messageType: %s", r.MessageType)
+	}
+	return nil
+}
+
+// PinMessageRequest is the payload of a pin_message frame
+type PinMessageRequest struct {
+	MessageID string  `json:"messageId"`
+	GroupID   string  `json:"groupId,omitempty"` // Informational; the server uses the message's group
+	Tag       *string `json:"tag,omitempty"`
+	PinnedAt  string  `json:"pinnedAt,omitempty"` // Informational; the server sets the pin time
+}
+
+// Validate checks the pin_message payload
+func (r *PinMessageRequest) Validate() error {
+	if r.MessageID == "" {
+		return errors.New("messageId is required")
+	}
+	return nil
+}
+
+// UnpinMessageRequest is the payload of an unpin_message frame
+type UnpinMessageRequest struct {
+	MessageID string `json:"messageId"`
+	GroupID   string `json:"groupId,omitempty"` // Informational; the server uses the message's group
+}
+
+// Validate checks the unpin_message payload
+func (r *UnpinMessageRequest) Validate() error {
+	if r.MessageID == "" {
+		return errors.New("messageId is required")
+	}
+	return nil
+}
+
+// EditMessageRequest is the payload of an edit_message frame
+type EditMessageRequest struct {
+	MessageID string `json:"messageId"`
+	Content   string `json:"content"`
+}
+
+// Validate checks the edit_message payload; content rules are enforced by the domain model
+func (r *EditMessageRequest) Validate() error {
+	if r.MessageID == "" {
+		return errors.New("messageId is required")
+	}
+	return nil
+}
+
+// DeleteMessageRequest is the payload of a delete_message frame
+type DeleteMessageRequest struct {
+	MessageID string `json:"messageId"`
+}
+
+// Validate checks the delete_message payload
+func (r *DeleteMessageRequest) Validate() error {
+	if r.MessageID == "" {
+		return errors.New("messageId is required")
+	}
+	return nil
+}
+
+// ReactionRequest is the payload of add_reaction and remove_reaction frames
+type ReactionRequest struct {
+	MessageID string `json:"messageId"`
+	Kind      string `json:"kind"` // e.g. "like", or "ack"/"responding" on SOS messages, which also acknowledge/claim the incident
+}
+
+// Validate checks the reaction payload; kinds are checked by the domain model
+func (r *ReactionRequest) Validate() error {
+	if r.MessageID == "" {
+		return errors.New("messageId is required")
+	}
+	if r.Kind == "" {
+		return errors.New("kind is required")
+	}
+	return nil
+}
+
+// MarkReadRequest is the payload of a mark_read frame
+type MarkReadRequest struct {
+	GroupID   string `json:"groupId"`
+	MessageID string `json:"messageId,omitempty"` // Last message read; omitted marks everything up to now read
+}
+
+// Validate checks the mark_read payload
+func (r *MarkReadRequest) Validate() error {
+	if r.GroupID == "" {
+		return errors.New("groupId is required")
+	}
+	return nil
+}
+
+// TypingRequest is the payload of typing_start and typing_stop frames
+type TypingRequest struct {
+	GroupID string `json:"groupId"`
+}
+
+// Validate checks the typing payload
+func (r *TypingRequest) Validate() error {
+	if r.GroupID == "" {
+		return errors.New("groupId is required")
+	}
+	return nil
+}
+
+// ShareLocationRequest is the payload of a share_location frame. The first frame starts a share
+// for durationSeconds; later frames update the position until it expires, and stop ends it early.
+// A share streams at most an hour from its first frame, however often durationSeconds moves its expiry.
+type ShareLocationRequest struct {
+	GroupID         string   `json:"groupId"`
+	Latitude        *float64 `json:"latitude,omitempty"`
+	Longitude       *float64 `json:"longitude,omitempty"`
+	Accuracy        *float64 `json:"accuracy,omitempty"`        // Meters
+	DurationSeconds int      `json:"durationSeconds,omitempty"` // Moves the expiry to this far from now; omitted keeps an active share's expiry
+	MessageID       *string  `json:"messageId,omitempty"`       // SOS message the share follows up
+	Stop            bool     `json:"stop,omitempty"`
+}
+
+// Validate checks the share_location payload; coordinates are checked by the domain model
+func (r *ShareLocationRequest) Validate() error {
+	if r.GroupID == "" {
+		return errors.New("groupId is required")
+	}
+	if r.Stop {
+		return nil
+	}
+	if r.Latitude == nil || r.Longitude == nil {
+		return errors.New("latitude and longitude are required")
+	}
+	if r.DurationSeconds < 0 {
+		return errors.New("durationSeconds must not be negative")
+	}
+	return nil
+}
+
+// UpdateSOSRequest is the payload of an update_sos frame
+type UpdateSOSRequest struct {
+	IncidentID string `json:"incidentId"` // The SOS message's ID
+	State      string `json:"state"`      // "acknowledged", "in_progress" or "resolved"
+}
+
+// Validate checks the update_sos payload; states are checked by the domain model
+func (r *UpdateSOSRequest) Validate() error {
+	if r.IncidentID == "" {
+		return errors.New("incidentId is required")
+	}
+	if r.State == "" {
+		return errors.New("state is required")
+	}
+	return nil
+}
+
+// SOSResponderRequest is the payload of claim_sos and release_sos frames
+type SOSResponderRequest struct {
+	IncidentID string `json:"incidentId"`
+}
+
+// Validate checks the claim_sos and release_sos payload
+func (r *SOSResponderRequest) Validate() error {
+	if r.IncidentID == "" {
+		return errors.New("incidentId is required")
+	}
+	return nil
+}
+
+// PingRequest is the payload of an application-level ping frame
+type PingRequest struct {
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+// Validate accepts any ping
+func (r *PingRequest) Validate() error {
+	return nil
+}
+
+func validateGroupIDs(groupIDs []string) error {
+	if len(groupIDs) == 0 {
+		return errors.New("groupIds must not be empty")
+	}
+	if len(groupIDs) > maxSubscribeGroups {
+		return fmt.Errorf("too many groupIds (max %d)", maxSubscribeGroups)
+	}
+	for _, groupID := range groupIDs {
+		if groupID == "" {
+			return errors.New("groupIds must not contain empty IDs")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"nearby-msg/api/internal/infrastructure/database"
+)
+
+// AccessErrorCode identifies why a device was denied access to a group
+type AccessErrorCode string
+
+const (
+	AccessGroupNotFound AccessErrorCode = "group_not_found"
+	AccessGroupDeleted  AccessErrorCode = "group_deleted"
+	AccessDeviceBanned  AccessErrorCode = "device_banned"
+)
+
+// AccessError is returned when the access policy denies a device access to a group
+type AccessError struct {
+	Code    AccessErrorCode
+	GroupID string
+}
+
+func (e *AccessError) Error() string {
+	switch e.Code {
+	case AccessGroupNotFound:
+		return fmt.Sprintf("group not found: %s", e.GroupID)
+	case AccessGroupDeleted:
+		return fmt.Sprintf("group has been deleted: %s", e.GroupID)
+	case AccessDeviceBanned:
+		return fmt.Sprintf("device is banned from group: %s", e.GroupID)
+	default:
+		return fmt.Sprintf("access denied to group: %s", e.GroupID)
+	}
+}
+
+// AsAccessError extracts an *AccessError from err's chain
+func AsAccessError(err error) (*AccessError, bool) {
+	var accessErr *AccessError
+	if errors.As(err, &accessErr) {
+		return accessErr, true
+	}
+	return nil, false
+}
+
+// AccessPolicy decides whether a device may read from or write to a group.
+// Groups are public, so any device may take part unless the group is gone or the device is banned.
+type AccessPolicy struct {
+	groupRepo *database.GroupRepository
+	banRepo   *database.GroupBanRepository
+}
+
+// NewAccessPolicy creates a new access policy
+func NewAccessPolicy(groupRepo *database.GroupRepository, banRepo *database.GroupBanRepository) *AccessPolicy {
+	return &AccessPolicy{
+		groupRepo: groupRepo,
+		banRepo:   banRepo,
+	}
+}
+
+// WithQuerier returns a copy of the policy whose lookups run on q (e.g. a transaction),
+// so it sees groups created earlier in the same transaction
+func (p *AccessPolicy) WithQuerier(q database.Querier) *AccessPolicy {
+	return &AccessPolicy{
+		groupRepo: p.groupRepo.WithQuerier(q),
+		banRepo:   p.banRepo.WithQuerier(q),
+	}
+}
+
+// CanSubscribe checks that a device may receive a group's events
+func (p *AccessPolicy) CanSubscribe(ctx context.Context, deviceID, groupID string) error {
+	return p.check(ctx, deviceID, groupID)
+}
+
+// CanPost checks that a device may send messages to, or pin messages in, a group
+func (p *AccessPolicy) CanPost(ctx context.Context, deviceID, groupID string) error {
+	return p.check(ctx, deviceID, groupID)
+}
+
+// check returns an *AccessError when access is denied, or a plain error if the lookup failed
+func (p *AccessPolicy) check(ctx context.Context, deviceID, groupID string) error {
+	exists, deletedAt, err := p.groupRepo.GetDeletedAt(ctx, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to get group: %w", err)
+	}
+	if !exists {
+		return &AccessError{Code: AccessGroupNotFound, GroupID: groupID}
+	}
+	if deletedAt != nil {
+		return &AccessError{Code: AccessGroupDeleted, GroupID: groupID}
+	}
+
+	banned, err := p.banRepo.IsBanned(ctx, groupID, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to check group ban: %w", err)
+	}
+	if banned {
+		return &AccessError{Code: AccessDeviceBanned, GroupID: groupID}
+	}
+
+	return nil
+}
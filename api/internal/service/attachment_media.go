@@ -0,0 +1,205 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/jpeg" // Registers JPEG for image.DecodeConfig
+	_ "image/png"  // Registers PNG for image.DecodeConfig
+	"net/http"
+
+	"nearby-msg/api/internal/domain"
+)
+
+// ErrInvalidImage is returned when an image's structure can't be parsed for metadata stripping
+var ErrInvalidImage = errors.New("invalid image file")
+
+// attachmentType is how an accepted upload is stored
+type attachmentType struct {
+	kind     domain.AttachmentKind
+	mimeType string
+}
+
+// acceptedAttachmentTypes maps content types sniffed by http.DetectContentType to the stored type.
+// Browsers record voice notes as WebM (Chrome, Firefox) or MP4 (Safari), which sniff as video.
+var acceptedAttachmentTypes = map[string]attachmentType{
+	"image/jpeg":      {domain.AttachmentKindImage, "image/jpeg"},
+	"image/png":       {domain.AttachmentKindImage, "image/png"},
+	"image/webp":      {domain.AttachmentKindImage, "image/webp"},
+	"audio/mpeg":      {domain.AttachmentKindAudio, "audio/mpeg"},
+	"application/ogg": {domain.AttachmentKindAudio, "audio/ogg"},
+	"audio/wave":      {domain.AttachmentKindAudio, "audio/wav"},
+	"video/webm":      {domain.AttachmentKindAudio, "audio/webm"},
+	"video/mp4":       {domain.AttachmentKindAudio, "audio/mp4"},
+}
+
+// detectAttachmentType sniffs an upload's type from its content; the client's claimed type is ignored
+func detectAttachmentType(data []byte) (attachmentType, error) {
+	attachmentType, ok := acceptedAttachmentTypes[http.DetectContentType(data)]
+	if !ok {
+		return attachmentType, domain.ErrUnsupportedContentType
+	}
+	return attachmentType, nil
+}
+
+// stripImageMetadata removes EXIF (including GPS position), XMP, IPTC and text metadata from
+// an image without re-encoding it. Colour profiles are kept. Since the EXIF orientation goes
+// too, clients should upload images already rotated upright.
+func stripImageMetadata(mimeType string, data []byte) ([]byte, error) {
+	switch mimeType {
+	case "image/jpeg":
+		return stripJPEGMetadata(data)
+	case "image/png":
+		return stripPNGMetadata(data)
+	case "image/webp":
+		return stripWebPMetadata(data)
+	}
+	return data, nil
+}
+
+// imageDimensions returns an image's width and height, or nil if its format can't be decoded (WebP)
+func imageDimensions(data []byte) (*int, *int) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil
+	}
+	return &config.Width, &config.Height
+}
+
+// stripJPEGMetadata drops APP1 (EXIF, XMP), APP13 (IPTC) and comment segments
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrInvalidImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8)
+
+	pos := 2
+	for pos < len(data) {
+		if data[pos] != 0xFF {
+			return nil, ErrInvalidImage
+		}
+		// Skip fill bytes before the marker code
+		for pos < len(data) && data[pos] == 0xFF {
+			pos++
+		}
+		if pos >= len(data) {
+			return nil, ErrInvalidImage
+		}
+		marker := data[pos]
+		pos++
+
+		// Markers without a length
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			out = append(out, 0xFF, marker)
+			continue
+		}
+		if marker == 0xD9 {
+			out = append(out, 0xFF, marker)
+			return out, nil
+		}
+
+		if pos+2 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		length := int(binary.BigEndian.Uint16(data[pos:]))
+		if length < 2 || pos+length > len(data) {
+			return nil, ErrInvalidImage
+		}
+		segment := data[pos : pos+length]
+		pos += length
+
+		switch marker {
+		case 0xE1, 0xED, 0xFE:
+			continue
+		}
+		out = append(out, 0xFF, marker)
+		out = append(out, segment...)
+
+		// Start of scan: the rest is entropy-coded image data, up to and including EOI
+		if marker == 0xDA {
+			out = append(out, data[pos:]...)
+			return out, nil
+		}
+	}
+	return nil, ErrInvalidImage
+}
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNGMetadata drops eXIf, text and timestamp chunks
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrInvalidImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunkType := string(data[pos+4 : pos+8])
+		end := pos + 12 + length // length, type, data, CRC
+		if length < 0 || end > len(data) {
+			return nil, ErrInvalidImage
+		}
+
+		switch chunkType {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+
+		if chunkType == "IEND" {
+			return out, nil
+		}
+	}
+	return nil, ErrInvalidImage
+}
+
+// stripWebPMetadata drops EXIF and XMP chunks and clears their flags in the VP8X header
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrInvalidImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + size + size%2 // Chunks are padded to an even size
+		if end == len(data)+1 {
+			end = len(data) // Some encoders leave out the final padding byte
+		}
+		if size < 0 || end > len(data) {
+			return nil, ErrInvalidImage
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if size > 0 {
+				chunk[8] &^= 0x08 | 0x04 // EXIF and XMP present flags
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// gpsEXIF builds an APP1 EXIF payload whose IFD0 points to a GPS IFD placing the photo at
+// 21°1'30" N, 105°51'15" E
+func gpsEXIF() []byte {
+	var tiff bytes.Buffer
+	be := binary.BigEndian
+	write := func(v interface{}) { _ = binary.Write(&tiff, be, v) }
+
+	// TIFF header, IFD0 at offset 8
+	tiff.WriteString("MM")
+	write(uint16(42))
+	write(uint32(8))
+
+	// IFD0: one entry, GPSInfo (0x8825) pointing to the GPS IFD at offset 26
+	write(uint16(1))
+	write([]uint16{0x8825, 4})
+	write([]uint32{1, 26})
+	write(uint32(0))
+
+	// GPS IFD at 26: latitude ref/value and longitude ref/value, rationals after it at 80
+	const rationals = 26 + 2 + 4*12 + 4
+	write(uint16(4))
+	write([]uint16{0x0001, 2})
+	write(uint32(2))
+	tiff.WriteString("N\x00\x00\x00")
+	write([]uint16{0x0002, 5})
+	write([]uint32{3, rationals})
+	write([]uint16{0x0003, 2})
+	write(uint32(2))
+	tiff.WriteString("E\x00\x00\x00")
+	write([]uint16{0x0004, 5})
+	write([]uint32{3, rationals + 24})
+	write(uint32(0))
+	write([]uint32{21, 1, 1, 1, 30, 1})
+	write([]uint32{105, 1, 51, 1, 15, 1})
+
+	return append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+}
+
+// jpegSegment encodes a marker segment with its length
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// TestStripJPEGMetadataRemovesGPS checks an uploaded photo loses its EXIF GPS position, XMP and
+// comments, keeps its colour profile and still decodes to the same image
+func TestStripJPEGMetadataRemovesGPS(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 8))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 8; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 16), uint8(y * 32), 128, 255})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 90}); err != nil {
+		t.Fatal(err)
+	}
+	plain := encoded.Bytes()
+
+	exif := gpsEXIF()
+	xmp := []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta><exif:GPSLatitude>21,1.5N</exif:GPSLatitude></x:xmpmeta>")
+	icc := []byte("ICC_PROFILE\x00\x01\x01not a real profile")
+	var photo []byte
+	photo = append(photo, plain[:2]...) // SOI
+	photo = append(photo, jpegSegment(0xE1, exif)...)
+	photo = append(photo, jpegSegment(0xE1, xmp)...)
+	photo = append(photo, jpegSegment(0xE2, icc)...)
+	photo = append(photo, jpegSegment(0xFE, []byte("taken at home"))...)
+	photo = append(photo, plain[2:]...)
+
+	attachmentType, err := detectAttachmentType(photo)
+	if err != nil || attachmentType.mimeType != "image/jpeg" {
+		t.Fatalf("detectAttachmentType = %v, %v; want image/jpeg", attachmentType, err)
+	}
+
+	stripped, err := stripImageMetadata(attachmentType.mimeType, photo)
+	if err != nil {
+		t.Fatalf("stripImageMetadata: %v", err)
+	}
+
+	for _, leak := range [][]byte{[]byte("Exif\x00\x00"), exif[6:], []byte("xmpmeta"), []byte("GPSLatitude"), []byte("taken at home")} {
+		if bytes.Contains(stripped, leak) {
+			t.Errorf("stripped JPEG still contains %q", leak)
+		}
+	}
+	if !bytes.Contains(stripped, icc) {
+		t.Error("stripped JPEG lost its ICC profile")
+	}
+
+	want, err := jpeg.Decode(bytes.NewReader(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := jpeg.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		t.Fatalf("stripped JPEG doesn't decode: %v", err)
+	}
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("stripped JPEG is %v, want %v", got.Bounds(), want.Bounds())
+	}
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 8; y++ {
+			if got.At(x, y) != want.At(x, y) {
+				t.Fatalf("pixel (%d, %d) changed: %v, want %v", x, y, got.At(x, y), want.At(x, y))
+			}
+		}
+	}
+}
+
+// TestStripJPEGMetadataRejectsTruncated checks a JPEG cut off inside a segment is refused
+// rather than stored with its metadata
+func TestStripJPEGMetadataRejectsTruncated(t *testing.T) {
+	photo := append([]byte{0xFF, 0xD8}, jpegSegment(0xE1, gpsEXIF())...)
+	if _, err := stripImageMetadata("image/jpeg", photo[:len(photo)-10]); err != ErrInvalidImage {
+		t.Errorf("err = %v, want ErrInvalidImage", err)
+	}
+}
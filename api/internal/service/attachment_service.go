@@ -0,0 +1,211 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+	"nearby-msg/api/internal/infrastructure/blobstore"
+	"nearby-msg/api/internal/infrastructure/database"
+	"nearby-msg/api/internal/infrastructure/logging"
+	"nearby-msg/api/internal/utils"
+)
+
+const (
+	// unsentAttachmentTTL is how long an upload may wait to be sent with a message before it is removed
+	unsentAttachmentTTL = 24 * time.Hour
+	// attachmentCleanupBatch bounds how many attachments a cleanup pass removes
+	attachmentCleanupBatch = 100
+)
+
+var (
+	ErrAttachmentTooLarge = errors.New("attachment is too large")
+	ErrEmptyAttachment    = errors.New("attachment is empty")
+)
+
+// AttachmentService handles photo and voice note uploads. Files go to the blob store and
+// their metadata to the database; messages reference attachments by ID.
+type AttachmentService struct {
+	attachmentRepo *database.AttachmentRepository
+	blobStore      blobstore.BlobStore
+	accessPolicy   *AccessPolicy
+	maxBytes       int64 // Largest accepted upload, after which Upload returns ErrAttachmentTooLarge
+}
+
+// NewAttachmentService creates a new attachment service
+func NewAttachmentService(attachmentRepo *database.AttachmentRepository, blobStore blobstore.BlobStore, accessPolicy *AccessPolicy, maxBytes int64) *AttachmentService {
+	return &AttachmentService{
+		attachmentRepo: attachmentRepo,
+		blobStore:      blobStore,
+		accessPolicy:   accessPolicy,
+		maxBytes:       maxBytes,
+	}
+}
+
+// MaxBytes returns the largest accepted upload size
+func (s *AttachmentService) MaxBytes() int64 {
+	return s.maxBytes
+}
+
+// Upload stores a photo or voice note for a device to send to a group. The type is sniffed
+// from the content, and images are stripped of EXIF/GPS and other metadata before storing.
+// Uploading follows the same rules as posting to the group.
+func (s *AttachmentService) Upload(ctx context.Context, deviceID, groupID string, file io.Reader) (*domain.Attachment, error) {
+	if groupID == "" {
+		return nil, fmt.Errorf("group ID is required")
+	}
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanPost(ctx, deviceID, groupID); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, s.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	if int64(len(data)) > s.maxBytes {
+		return nil, ErrAttachmentTooLarge
+	}
+	if len(data) == 0 {
+		return nil, ErrEmptyAttachment
+	}
+
+	attachmentType, err := detectAttachmentType(data)
+	if err != nil {
+		return nil, err
+	}
+
+	attachmentID, err := utils.GenerateID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate attachment ID: %w", err)
+	}
+	attachment := &domain.Attachment{
+		ID:         attachmentID,
+		GroupID:    groupID,
+		DeviceID:   deviceID,
+		Kind:       attachmentType.kind,
+		MimeType:   attachmentType.mimeType,
+		StorageKey: "attachments/" + groupID + "/" + attachmentID,
+		CreatedAt:  time.Now(),
+	}
+
+	if attachment.Kind == domain.AttachmentKindImage {
+		data, err = stripImageMetadata(attachment.MimeType, data)
+		if err != nil {
+			return nil, err
+		}
+		attachment.Width, attachment.Height = imageDimensions(data)
+	}
+	attachment.SizeBytes = int64(len(data))
+
+	if err := s.blobStore.Put(ctx, attachment.StorageKey, bytes.NewReader(data), attachment.SizeBytes, attachment.MimeType); err != nil {
+		return nil, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	if err := s.attachmentRepo.Create(ctx, attachment); err != nil {
+		if delErr := s.blobStore.Delete(ctx, attachment.StorageKey); delErr != nil {
+			logging.GetLogger().Warn("Failed to remove stored attachment file", "attachmentID", attachment.ID, "error", delErr)
+		}
+		return nil, fmt.Errorf("failed to save attachment: %w", err)
+	}
+	return attachment, nil
+}
+
+// GetAttachment returns an attachment's metadata. Until it is sent with a message only its
+// uploader can see it; after that, reading it follows the same rules as subscribing to its group.
+func (s *AttachmentService) GetAttachment(ctx context.Context, deviceID, attachmentID string) (*domain.Attachment, error) {
+	attachment, err := s.attachmentRepo.GetByID(ctx, attachmentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+
+	if attachment.MessageID == nil {
+		if attachment.DeviceID != deviceID {
+			return nil, fmt.Errorf("failed to get attachment: attachment not found")
+		}
+		return attachment, nil
+	}
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanSubscribe(ctx, deviceID, attachment.GroupID); err != nil {
+			return nil, err
+		}
+	}
+	return attachment, nil
+}
+
+// OpenAttachment returns an attachment's metadata and its file, which the caller must close
+func (s *AttachmentService) OpenAttachment(ctx context.Context, deviceID, attachmentID string) (*domain.Attachment, io.ReadCloser, error) {
+	attachment, err := s.GetAttachment(ctx, deviceID, attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := s.blobStore.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return nil, nil, fmt.Errorf("failed to open attachment: attachment file not found")
+		}
+		return nil, nil, fmt.Errorf("failed to open attachment: %w", err)
+	}
+	return attachment, file, nil
+}
+
+// RunCleanup removes expired attachments immediately and then every interval until ctx is cancelled
+// (see Cleanup)
+func (s *AttachmentService) RunCleanup(ctx context.Context, interval, deletedHorizon time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.Cleanup(ctx, deletedHorizon)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Cleanup removes the files and rows of attachments deleted longer than deletedHorizon ago,
+// once their deletion has been synced like other tombstones, and of uploads never sent within
+// unsentAttachmentTTL. A horizon of 0 keeps deleted attachments forever.
+func (s *AttachmentService) Cleanup(ctx context.Context, deletedHorizon time.Duration) {
+	logger := logging.GetLogger()
+	now := time.Now()
+	deletedBefore := now.Add(-deletedHorizon)
+	if deletedHorizon <= 0 {
+		deletedBefore = time.Time{}
+	}
+
+	for {
+		expired, err := s.attachmentRepo.GetExpired(ctx, deletedBefore, now.Add(-unsentAttachmentTTL), attachmentCleanupBatch)
+		if err != nil {
+			logger.Warn("Failed to list expired attachments", "error", err)
+			return
+		}
+
+		removed := 0
+		for _, attachment := range expired {
+			if err := s.blobStore.Delete(ctx, attachment.StorageKey); err != nil {
+				logger.Warn("Failed to delete attachment file", "attachmentID", attachment.ID, "error", err)
+				continue
+			}
+			if err := s.attachmentRepo.Purge(ctx, attachment.ID); err != nil {
+				logger.Warn("Failed to purge attachment", "attachmentID", attachment.ID, "error", err)
+				continue
+			}
+			removed++
+		}
+		if removed > 0 {
+			logger.Info("Removed expired attachments", "removed", removed)
+		}
+
+		// Stop on a short batch, or if nothing in a full batch could be removed
+		if len(expired) < attachmentCleanupBatch || removed == 0 {
+			return
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"nearby-msg/api/internal/infrastructure/database"
+	"nearby-msg/api/internal/infrastructure/logging"
+)
+
+// broadcastChannel is the PostgreSQL NOTIFY channel shared by all API instances
+const broadcastChannel = "ws_broadcast"
+
+// listenRetryDelay is how long the Postgres broadcaster waits before re-establishing LISTEN
+const listenRetryDelay = 2 * time.Second
+
+// Broadcaster fans out group events to every API instance.
+// Publish delivers to all nodes, including the publishing one, so the hub
+// only ever sends to its local sockets from messages received via Subscribe.
+// Publish also stamps each event with the next per-group sequence number, and
+// subscribers receive a group's events in sequence order. Ephemeral messages
+// (typing, presence) are delivered without a sequence number.
+type Broadcaster interface {
+	// Publish sequences a message and sends it to subscribers on every node
+	Publish(ctx context.Context, msg BroadcastMessage) error
+	// Subscribe calls handler for every published message until ctx is cancelled
+	Subscribe(ctx context.Context, handler func(BroadcastMessage)) error
+}
+
+// InMemoryBroadcaster delivers messages within a single process (single-node deployments)
+type InMemoryBroadcaster struct {
+	mu        sync.Mutex
+	handlers  map[int]func(BroadcastMessage)
+	nextID    int
+	sequences map[string]int64 // group ID -> last sequence
+}
+
+// NewInMemoryBroadcaster creates a new in-process broadcaster
+func NewInMemoryBroadcaster() *InMemoryBroadcaster {
+	return &InMemoryBroadcaster{
+		handlers:  make(map[int]func(BroadcastMessage)),
+		sequences: make(map[string]int64),
+	}
+}
+
+// Publish sequences the message and delivers it to all local subscribers.
+// The lock is held during delivery so subscribers observe sequence order.
+func (b *InMemoryBroadcaster) Publish(ctx context.Context, msg BroadcastMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !msg.Ephemeral {
+		b.sequences[msg.GroupID]++
+		msg.Message.Seq = b.sequences[msg.GroupID]
+	}
+
+	for _, handler := range b.handlers {
+		handler(msg)
+	}
+	return nil
+}
+
+// Subscribe registers handler and blocks until ctx is cancelled
+func (b *InMemoryBroadcaster) Subscribe(ctx context.Context, handler func(BroadcastMessage)) error {
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = handler
+	b.mu.Unlock()
+
+	<-ctx.Done()
+
+	b.mu.Lock()
+	delete(b.handlers, id)
+	b.mu.Unlock()
+	return nil
+}
+
+// PostgresBroadcaster fans out messages across API instances using LISTEN/NOTIFY
+type PostgresBroadcaster struct {
+	notifier *database.Notifier
+}
+
+// NewPostgresBroadcaster creates a broadcaster backed by PostgreSQL LISTEN/NOTIFY
+func NewPostgresBroadcaster(notifier *database.Notifier) *PostgresBroadcaster {
+	return &PostgresBroadcaster{notifier: notifier}
+}
+
+// Publish allocates the group's next sequence and sends the message through NOTIFY;
+// every listening node (this one included) receives it. Ephemeral messages skip the sequence.
+func (b *PostgresBroadcaster) Publish(ctx context.Context, msg BroadcastMessage) error {
+	if msg.Ephemeral {
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to encode broadcast: %w", err)
+		}
+		if err := b.notifier.Notify(ctx, broadcastChannel, string(payload)); err != nil {
+			return fmt.Errorf("failed to publish broadcast: %w", err)
+		}
+		return nil
+	}
+
+	_, err := b.notifier.NotifySequenced(ctx, broadcastChannel, msg.GroupID, func(seq int64) (string, error) {
+		msg.Message.Seq = seq
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode broadcast: %w", err)
+		}
+		return string(payload), nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish broadcast: %w", err)
+	}
+	return nil
+}
+
+// Subscribe listens for notifications and re-establishes LISTEN after connection failures
+func (b *PostgresBroadcaster) Subscribe(ctx context.Context, handler func(BroadcastMessage)) error {
+	logger := logging.GetLogger()
+	for {
+		err := b.notifier.Listen(ctx, broadcastChannel, func(payload string) {
+			payload, err := b.notifier.LoadPayload(ctx, payload)
+			if err != nil {
+				logger.Warn("Failed to load broadcast notification", "error", err)
+				return
+			}
+			var msg BroadcastMessage
+			if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+				logger.Warn("Failed to decode broadcast notification", "error", err)
+				return
+			}
+			handler(msg)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		logger.Warn("Broadcast listener disconnected, retrying", "error", err, "retryIn", listenRetryDelay)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import "sync"
+
+// ChangeFeed tells local listeners that replicated data may have changed.
+// Signals carry no payload and coalesce: a listener that is busy when several changes
+// happen receives a single signal, after which it re-reads whatever it needs.
+type ChangeFeed struct {
+	mu        sync.Mutex
+	listeners map[chan struct{}]struct{}
+}
+
+// NewChangeFeed creates a new change feed
+func NewChangeFeed() *ChangeFeed {
+	return &ChangeFeed{listeners: make(map[chan struct{}]struct{})}
+}
+
+// Subscribe returns a channel that receives a signal after changes, and a function that
+// stops the subscription
+func (f *ChangeFeed) Subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	f.mu.Lock()
+	f.listeners[ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		delete(f.listeners, ch)
+		f.mu.Unlock()
+	}
+}
+
+// Notify signals every listener without blocking
+func (f *ChangeFeed) Notify() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for ch := range f.listeners {
+		select {
+		case ch <- struct{}{}:
+		default: // A signal is already pending
+		}
+	}
+}
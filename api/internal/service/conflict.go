@@ -0,0 +1,106 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConflictStrategy decides what happens when a mutation was based on a stale revision
+type ConflictStrategy string
+
+const (
+	// ConflictReject refuses stale mutations; the client gets the current document to reconcile
+	ConflictReject ConflictStrategy = "reject"
+	// ConflictLastWriterWins applies a stale mutation only if its client timestamp is newer
+	// than that of the last write
+	ConflictLastWriterWins ConflictStrategy = "lww"
+	// ConflictMerge applies the fields of a stale mutation that nobody else changed since its
+	// base revision, and keeps the server's value for the rest
+	ConflictMerge ConflictStrategy = "merge"
+)
+
+// ParseConflictStrategy parses a strategy name; an empty name selects ConflictReject
+func ParseConflictStrategy(name string) (ConflictStrategy, error) {
+	switch ConflictStrategy(name) {
+	case "":
+		return ConflictReject, nil
+	case ConflictReject, ConflictLastWriterWins, ConflictMerge:
+		return ConflictStrategy(name), nil
+	default:
+		return "", fmt.Errorf("unknown conflict strategy: %s (expected reject, lww or merge)", name)
+	}
+}
+
+// Conflict resolutions
+const (
+	ConflictResolutionRejected = "rejected" // Nothing from the mutation was applied
+	ConflictResolutionMerged   = "merged"   // Some fields were applied, the server kept the rest
+)
+
+// Conflict describes a mutation that was based on a stale revision and was not fully applied
+type Conflict struct {
+	Collection   string           `json:"collection"`
+	ID           string           `json:"id"`
+	BaseRevision int64            `json:"base_revision"`
+	Strategy     ConflictStrategy `json:"strategy"`
+	Resolution   string           `json:"resolution"`       // ConflictResolutionRejected or ConflictResolutionMerged
+	Fields       []string         `json:"fields,omitempty"` // Fields whose server value was kept
+	Document     interface{}      `json:"document"`         // Server document after resolution
+}
+
+// Error implements error so a rejected mutation can be reported like any other failure
+func (c *Conflict) Error() string {
+	return fmt.Sprintf("%s %s changed since revision %d", c.Collection, c.ID, c.BaseRevision)
+}
+
+// revisionedDocument is the server-side state conflict resolution looks at
+type revisionedDocument struct {
+	Revision        int64
+	FieldRevisions  map[string]int64
+	UpdatedAt       time.Time
+	ClientUpdatedAt *time.Time
+}
+
+// resolveFields splits the fields a mutation writes into those to apply and those where the
+// server's value is kept. A mutation without a base revision, or based on the current revision,
+// applies every field.
+func resolveFields(
+	strategy ConflictStrategy,
+	current revisionedDocument,
+	baseRevision *int64,
+	clientUpdatedAt *time.Time,
+	fields []string,
+) (apply []string, kept []string) {
+	if baseRevision == nil || *baseRevision >= current.Revision {
+		return fields, nil
+	}
+
+	switch strategy {
+	case ConflictLastWriterWins:
+		// Compare client clocks; writes that didn't send one count as happening at the server time
+		lastWrite := current.UpdatedAt
+		if current.ClientUpdatedAt != nil {
+			lastWrite = *current.ClientUpdatedAt
+		}
+		if clientUpdatedAt != nil && clientUpdatedAt.After(lastWrite) {
+			return fields, nil
+		}
+		return nil, fields
+
+	case ConflictMerge:
+		for _, field := range fields {
+			if current.FieldRevisions[field] > *baseRevision {
+				kept = append(kept, field)
+			} else {
+				apply = append(apply, field)
+			}
+		}
+		return apply, kept
+
+	default:
+		return nil, fields
+	}
+}
+
+// maxConflictRetries bounds how often an update is re-resolved after losing a race with a concurrent write
+const maxConflictRetries = 3
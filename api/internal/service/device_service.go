@@ -20,6 +20,11 @@ func NewDeviceService(repo *database.DeviceRepository) *DeviceService {
 	return &DeviceService{repo: repo}
 }
 
+// WithQuerier returns a copy of the service whose repository runs on q (e.g. a transaction)
+func (s *DeviceService) WithQuerier(q database.Querier) *DeviceService {
+	return &DeviceService{repo: s.repo.WithQuerier(q)}
+}
+
 // RegisterDeviceRequest represents a device registration request
 type RegisterDeviceRequest struct {
 	ID       *string `json:"id,omitempty"`       // Optional, will be generated if not provided
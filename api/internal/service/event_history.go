@@ -0,0 +1,75 @@
+package service
+
+import (
+	"time"
+
+	"nearby-msg/api/internal/protocol"
+)
+
+const (
+	// eventHistorySize is the number of recent sequenced events kept per group for replay
+	eventHistorySize = 128
+	// eventHistoryTTL is how long a group's history is kept once it has no events and no
+	// subscribers on this instance; clients resuming it afterwards are told to resync
+	eventHistoryTTL = 10 * time.Minute
+	// eventHistorySweepInterval is how often idle histories are evicted
+	eventHistorySweepInterval = time.Minute
+)
+
+// groupHistory is a bounded ring buffer of a group's most recent sequenced events
+type groupHistory struct {
+	events     []protocol.Frame
+	start      int       // index of the oldest event
+	count      int       // number of buffered events
+	lastSeq    int64     // sequence of the newest event seen
+	lastActive time.Time // last event, or last sweep that found subscribers
+}
+
+func newGroupHistory() *groupHistory {
+	return &groupHistory{events: make([]protocol.Frame, eventHistorySize), lastActive: time.Now()}
+}
+
+// append records a sequenced event. A gap in sequence numbers (e.g. events missed while the
+// broadcast listener was reconnecting) clears the buffer, since those events can't be replayed.
+func (h *groupHistory) append(msg protocol.Frame) {
+	if msg.Seq <= h.lastSeq {
+		return
+	}
+	if h.lastSeq != 0 && msg.Seq != h.lastSeq+1 {
+		h.start, h.count = 0, 0
+	}
+
+	if h.count < len(h.events) {
+		h.events[(h.start+h.count)%len(h.events)] = msg
+		h.count++
+	} else {
+		h.events[h.start] = msg
+		h.start = (h.start + 1) % len(h.events)
+	}
+	h.lastSeq = msg.Seq
+	h.lastActive = time.Now()
+}
+
+// since returns the events newer than lastSeq. ok is false when the buffer no longer
+// holds every missed event and the client must resynchronise instead.
+func (h *groupHistory) since(lastSeq int64) (events []protocol.Frame, ok bool) {
+	if lastSeq == h.lastSeq {
+		return nil, true
+	}
+	if lastSeq > h.lastSeq || h.count == 0 {
+		return nil, false
+	}
+
+	oldest := h.events[h.start].Seq
+	if lastSeq+1 < oldest {
+		return nil, false
+	}
+
+	for i := 0; i < h.count; i++ {
+		event := h.events[(h.start+i)%len(h.events)]
+		if event.Seq > lastSeq {
+			events = append(events, event)
+		}
+	}
+	return events, true
+}
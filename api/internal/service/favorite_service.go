@@ -19,6 +19,11 @@ func NewFavoriteService(repo *database.FavoriteRepository) *FavoriteService {
 	return &FavoriteService{repo: repo}
 }
 
+// WithQuerier returns a copy of the service whose repository runs on q (e.g. a transaction)
+func (s *FavoriteService) WithQuerier(q database.Querier) *FavoriteService {
+	return &FavoriteService{repo: s.repo.WithQuerier(q)}
+}
+
 // AddFavorite adds a group to device's favorites
 func (s *FavoriteService) AddFavorite(ctx context.Context, deviceID, groupID string) (*domain.FavoriteGroup, error) {
 	// Check if already favorited
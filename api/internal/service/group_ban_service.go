@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+	"nearby-msg/api/internal/infrastructure/database"
+)
+
+var (
+	// ErrNotGroupModerator is returned when a device other than the group's creator bans or unbans a device
+	ErrNotGroupModerator = errors.New("only the group creator can ban or unban devices")
+	// ErrCannotBanSelf is returned when the group's creator tries to ban their own device
+	ErrCannotBanSelf = errors.New("cannot ban your own device")
+)
+
+// GroupBanService lets a group's creator ban devices from the group and lift bans
+type GroupBanService struct {
+	groupRepo *database.GroupRepository
+	banRepo   *database.GroupBanRepository
+}
+
+// NewGroupBanService creates a new group ban service
+func NewGroupBanService(groupRepo *database.GroupRepository, banRepo *database.GroupBanRepository) *GroupBanService {
+	return &GroupBanService{
+		groupRepo: groupRepo,
+		banRepo:   banRepo,
+	}
+}
+
+// BanDeviceRequest represents a request to ban a device from a group
+type BanDeviceRequest struct {
+	DeviceID        string  `json:"device_id"`
+	Reason          *string `json:"reason,omitempty"`
+	DurationSeconds int     `json:"duration_seconds,omitempty"` // Unset or 0 for a permanent ban
+}
+
+// BanDevice bans a device from a group on behalf of the group's creator, replacing any earlier ban
+func (s *GroupBanService) BanDevice(ctx context.Context, deviceID, groupID string, req BanDeviceRequest) (*domain.GroupBan, error) {
+	if req.DeviceID == "" {
+		return nil, domain.ErrBanDeviceRequired
+	}
+	if req.DurationSeconds < 0 {
+		return nil, domain.ErrInvalidBanDuration
+	}
+	if req.Reason != nil && len([]rune(*req.Reason)) > domain.MaxBanReasonLength {
+		return nil, domain.ErrBanReasonTooLong
+	}
+	if req.DeviceID == deviceID {
+		return nil, ErrCannotBanSelf
+	}
+	if err := s.checkModerator(ctx, deviceID, groupID); err != nil {
+		return nil, err
+	}
+
+	ban := &domain.GroupBan{GroupID: groupID, DeviceID: req.DeviceID, Reason: req.Reason}
+	if req.DurationSeconds > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.DurationSeconds) * time.Second)
+		ban.ExpiresAt = &expiresAt
+	}
+	if err := s.banRepo.Ban(ctx, ban); err != nil {
+		return nil, fmt.Errorf("failed to ban device: %w", err)
+	}
+	return ban, nil
+}
+
+// UnbanDevice lifts a device's ban from a group on behalf of the group's creator
+func (s *GroupBanService) UnbanDevice(ctx context.Context, deviceID, groupID, bannedDeviceID string) error {
+	if err := s.checkModerator(ctx, deviceID, groupID); err != nil {
+		return err
+	}
+	if err := s.banRepo.Unban(ctx, groupID, bannedDeviceID); err != nil {
+		return fmt.Errorf("failed to unban device: %w", err)
+	}
+	return nil
+}
+
+// checkModerator checks the group exists and the device created it
+func (s *GroupBanService) checkModerator(ctx context.Context, deviceID, groupID string) error {
+	group, err := s.groupRepo.GetByID(ctx, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to get group: %w", err)
+	}
+	if group.CreatorDeviceID == nil || *group.CreatorDeviceID != deviceID {
+		return ErrNotGroupModerator
+	}
+	return nil
+}
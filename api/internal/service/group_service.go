@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"time"
 
 	"nearby-msg/api/internal/domain"
 	"nearby-msg/api/internal/infrastructure/database"
@@ -12,16 +13,24 @@ import (
 
 // GroupService handles group business logic
 type GroupService struct {
-	repo *database.GroupRepository
+	repo             *database.GroupRepository
+	conflictStrategy ConflictStrategy // How stale updates are resolved
+	rateLimits       *RateLimitPolicy
 }
 
 // NewGroupService creates a new group service
-func NewGroupService(repo *database.GroupRepository) *GroupService {
-	return &GroupService{repo: repo}
+func NewGroupService(repo *database.GroupRepository, conflictStrategy ConflictStrategy, rateLimits *RateLimitPolicy) *GroupService {
+	return &GroupService{repo: repo, conflictStrategy: conflictStrategy, rateLimits: rateLimits}
+}
+
+// WithQuerier returns a copy of the service whose repository runs on q (e.g. a transaction)
+func (s *GroupService) WithQuerier(q database.Querier) *GroupService {
+	return &GroupService{repo: s.repo.WithQuerier(q), conflictStrategy: s.conflictStrategy, rateLimits: s.rateLimits}
 }
 
 // CreateGroupRequest represents a group creation request
 type CreateGroupRequest struct {
+	ID              string           `json:"id,omitempty"` // Optional client-generated ID, used if it is a valid NanoID and not taken
 	Name            string           `json:"name"`
 	Type            domain.GroupType `json:"type"`
 	Latitude        float64          `json:"latitude"`
@@ -41,10 +50,24 @@ func (s *GroupService) CreateGroup(ctx context.Context, req CreateGroupRequest)
 		return nil, fmt.Errorf("device has already created a group")
 	}
 
-	// Create group
-	groupID, err := utils.GenerateID()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate group ID: %w", err)
+	// Create group, keeping the client's ID when possible so its references stay valid
+	groupID := req.ID
+	if utils.IsValidID(groupID) {
+		taken, _, err := s.repo.GetDeletedAt(ctx, groupID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check group ID: %w", err)
+		}
+		if taken {
+			groupID = ""
+		}
+	} else {
+		groupID = ""
+	}
+	if groupID == "" {
+		groupID, err = utils.GenerateID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate group ID: %w", err)
+		}
 	}
 
 	// CreatorDeviceID must be provided when creating a group (cannot be NULL)
@@ -62,6 +85,9 @@ func (s *GroupService) CreateGroup(ctx context.Context, req CreateGroupRequest)
 	if err := group.Validate(); err != nil {
 		return nil, fmt.Errorf("group validation failed: %w", err)
 	}
+	if err := s.rateLimits.AllowGroupCreate(ctx, req.CreatorDeviceID); err != nil {
+		return nil, err
+	}
 
 	if err := s.repo.Create(ctx, group); err != nil {
 		return nil, fmt.Errorf("failed to create group: %w", err)
@@ -146,40 +172,66 @@ func (s *GroupService) GetGroup(ctx context.Context, groupID string) (*domain.Gr
 
 // UpdateGroupRequest represents a group update request
 type UpdateGroupRequest struct {
-	Name string `json:"name"`
+	Name            string     `json:"name"`
+	BaseRevision    *int64     `json:"base_revision,omitempty"`     // Revision the client edited; omitted means overwrite
+	ClientUpdatedAt *time.Time `json:"client_updated_at,omitempty"` // When the client made the edit, used by last-writer-wins
 }
 
-// UpdateGroup updates a group (only name for now)
-func (s *GroupService) UpdateGroup(ctx context.Context, groupID string, deviceID string, req UpdateGroupRequest) (*domain.Group, error) {
-	// Get the group first
-	group, err := s.repo.GetByID(ctx, groupID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get group: %w", err)
-	}
-
-	// Check if the device is the creator
-	// Check if group has a creator and if it matches the device ID
-	if group.CreatorDeviceID == nil || *group.CreatorDeviceID != deviceID {
-		return nil, fmt.Errorf("only the creator can update the group")
-	}
-
+// UpdateGroup updates a group (only name for now).
+// If the update was based on a stale revision and the conflict strategy kept the server's
+// name, the returned Conflict describes it and the group is returned unchanged.
+func (s *GroupService) UpdateGroup(ctx context.Context, groupID string, deviceID string, req UpdateGroupRequest) (*domain.Group, *Conflict, error) {
 	// Validate new name
 	if len(req.Name) < 1 || len(req.Name) > 100 {
-		return nil, domain.ErrInvalidGroupName
+		return nil, nil, domain.ErrInvalidGroupName
 	}
 
-	// Update the name
-	if err := s.repo.UpdateName(ctx, groupID, req.Name); err != nil {
-		return nil, fmt.Errorf("failed to update group: %w", err)
-	}
+	for attempt := 0; attempt < maxConflictRetries; attempt++ {
+		group, err := s.repo.GetByID(ctx, groupID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get group: %w", err)
+		}
 
-	// Return updated group
-	updatedGroup, err := s.repo.GetByID(ctx, groupID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get updated group: %w", err)
+		// Check if group has a creator and if it matches the device ID
+		if group.CreatorDeviceID == nil || *group.CreatorDeviceID != deviceID {
+			return nil, nil, fmt.Errorf("only the creator can update the group")
+		}
+
+		apply, kept := resolveFields(s.conflictStrategy, revisionedDocument{
+			Revision:        group.Revision,
+			FieldRevisions:  group.FieldRevisions,
+			UpdatedAt:       group.UpdatedAt,
+			ClientUpdatedAt: group.ClientUpdatedAt,
+		}, req.BaseRevision, req.ClientUpdatedAt, []string{"name"})
+		if len(apply) == 0 {
+			return group, &Conflict{
+				Collection:   "groups",
+				ID:           group.ID,
+				BaseRevision: *req.BaseRevision,
+				Strategy:     s.conflictStrategy,
+				Resolution:   ConflictResolutionRejected,
+				Fields:       kept,
+				Document:     group,
+			}, nil
+		}
+
+		updated, err := s.repo.UpdateName(ctx, groupID, req.Name, group.Revision, req.ClientUpdatedAt)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to update group: %w", err)
+		}
+		if !updated {
+			// Someone else wrote in between; resolve again against the new revision
+			continue
+		}
+
+		updatedGroup, err := s.repo.GetByID(ctx, groupID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get updated group: %w", err)
+		}
+		return updatedGroup, nil, nil
 	}
 
-	return updatedGroup, nil
+	return nil, nil, fmt.Errorf("failed to update group: too many concurrent updates")
 }
 
 // GroupSuggestionRequest represents a request for group name/type suggestions
@@ -0,0 +1,266 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+	"nearby-msg/api/internal/infrastructure/database"
+	"nearby-msg/api/internal/infrastructure/logging"
+	"nearby-msg/api/internal/utils"
+)
+
+const (
+	// defaultLocationShareDuration is how long a share lasts when the client doesn't say
+	defaultLocationShareDuration = 15 * time.Minute
+	// maxLocationShareDuration caps how long a share may stream from when it started, however
+	// often it is restarted
+	maxLocationShareDuration = time.Hour
+	// locationExpiryInterval is how often expired shares are looked up to announce their end
+	locationExpiryInterval = 10 * time.Second
+	// locationExpiryBatch bounds how many expired shares are claimed at once
+	locationExpiryBatch = 100
+	// sosLocationWindow is how far back SOS messages are listed by GetSOSLocations
+	sosLocationWindow = 24 * time.Hour
+	// sosLocationLimit bounds how many SOS locations are listed
+	sosLocationLimit = 100
+)
+
+// LocationService handles live location shares and the locations of SOS messages
+type LocationService struct {
+	shareRepo    *database.LocationShareRepository
+	messageRepo  *database.MessageRepository
+	accessPolicy *AccessPolicy
+	rateLimits   *RateLimitPolicy
+}
+
+// NewLocationService creates a new location service
+func NewLocationService(shareRepo *database.LocationShareRepository, messageRepo *database.MessageRepository, accessPolicy *AccessPolicy, rateLimits *RateLimitPolicy) *LocationService {
+	return &LocationService{
+		shareRepo:    shareRepo,
+		messageRepo:  messageRepo,
+		accessPolicy: accessPolicy,
+		rateLimits:   rateLimits,
+	}
+}
+
+// ShareLocationRequest is a position update for a device's live share in a group
+type ShareLocationRequest struct {
+	GroupID   string
+	DeviceID  string
+	Latitude  float64
+	Longitude float64
+	Accuracy  *float64
+	Duration  time.Duration // Moves an active share's expiry to Duration from now; zero keeps it (or uses the default)
+	MessageID *string       // SOS message in the group the share follows up
+}
+
+// ShareLocation starts or updates a device's live location share in a group. A position update
+// without a duration keeps the active share's expiry; a duration moves it, but a share never
+// streams longer than maxLocationShareDuration from when it started. Sharing follows the same
+// rules as posting to the group, and positions are rate limited per device.
+func (s *LocationService) ShareLocation(ctx context.Context, req ShareLocationRequest) (*domain.LocationShare, error) {
+	if req.GroupID == "" {
+		return nil, fmt.Errorf("group ID is required")
+	}
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanPost(ctx, req.DeviceID, req.GroupID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.rateLimits.AllowLocationUpdate(ctx, req.DeviceID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	active, err := s.shareRepo.GetActive(ctx, req.DeviceID, req.GroupID, now)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		return nil, fmt.Errorf("failed to get location share: %w", err)
+	}
+
+	share := &domain.LocationShare{
+		DeviceID:  req.DeviceID,
+		GroupID:   req.GroupID,
+		MessageID: req.MessageID,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		Accuracy:  req.Accuracy,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	if active != nil {
+		share.ID = active.ID
+		share.StartedAt = active.StartedAt
+		share.ExpiresAt = active.ExpiresAt
+		if share.MessageID == nil {
+			share.MessageID = active.MessageID
+		}
+	}
+	if active == nil || req.Duration > 0 {
+		duration := req.Duration
+		if duration <= 0 {
+			duration = defaultLocationShareDuration
+		}
+		share.ExpiresAt = now.Add(duration)
+		if latest := share.StartedAt.Add(maxLocationShareDuration); share.ExpiresAt.After(latest) {
+			share.ExpiresAt = latest
+		}
+	}
+
+	if share.ID == "" {
+		shareID, err := utils.GenerateID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate location share ID: %w", err)
+		}
+		share.ID = shareID
+	}
+	if err := share.Validate(); err != nil {
+		return nil, fmt.Errorf("location validation failed: %w", err)
+	}
+
+	if req.MessageID != nil {
+		message, err := s.messageRepo.GetByID(ctx, *req.MessageID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get message: %w", err)
+		}
+		if message.GroupID != req.GroupID {
+			return nil, ErrMessageNotInGroup
+		}
+	}
+
+	if err := s.shareRepo.Upsert(ctx, share); err != nil {
+		return nil, fmt.Errorf("failed to save location share: %w", err)
+	}
+	return share, nil
+}
+
+// StopSharing ends a device's active share in a group. Returns false if there was none.
+func (s *LocationService) StopSharing(ctx context.Context, deviceID, groupID string) (bool, error) {
+	ended, err := s.shareRepo.End(ctx, deviceID, groupID, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to end location share: %w", err)
+	}
+	return ended, nil
+}
+
+// RunExpiry announces shares that expired without being stopped, calling ended for each, every
+// locationExpiryInterval until ctx is cancelled. Each expiry is claimed in the database, so
+// it is announced once across instances.
+func (s *LocationService) RunExpiry(ctx context.Context, ended func(groupID, deviceID string)) {
+	ticker := time.NewTicker(locationExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.announceExpired(ctx, ended)
+		}
+	}
+}
+
+// announceExpired claims expired shares in batches and calls ended for each
+func (s *LocationService) announceExpired(ctx context.Context, ended func(groupID, deviceID string)) {
+	for {
+		shares, err := s.shareRepo.ClaimExpired(ctx, time.Now(), locationExpiryBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				logging.GetLogger().Warn("Failed to claim expired location shares", "error", err)
+			}
+			return
+		}
+		for _, share := range shares {
+			ended(share.GroupID, share.DeviceID)
+		}
+		if len(shares) < locationExpiryBatch {
+			return
+		}
+	}
+}
+
+// SOSLocation is where an SOS was raised, or where its sender is now if they are sharing live
+type SOSLocation struct {
+	MessageID      string          `json:"message_id"`
+	DeviceID       string          `json:"device_id"`
+	SOSType        *domain.SOSType `json:"sos_type,omitempty"`
+	Content        string          `json:"content"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Latitude       float64         `json:"latitude"`
+	Longitude      float64         `json:"longitude"`
+	Accuracy       *float64        `json:"accuracy,omitempty"`
+	Live           bool            `json:"live"`                      // Position comes from an active location share
+	LocatedAt      time.Time       `json:"located_at"`                // Time of the position
+	DistanceMeters *float64        `json:"distance_meters,omitempty"` // From the viewer, if they gave their position
+}
+
+// GetSOSLocations lists the group's SOS messages sent with a location in the last
+// sosLocationWindow. A sender's active location share in the group replaces the position of
+// their SOS. Given the viewer's position, each includes its distance and the list is sorted
+// nearest first; otherwise newest first. Reading follows the same rules as subscribing.
+func (s *LocationService) GetSOSLocations(ctx context.Context, deviceID, groupID string, viewerLatitude, viewerLongitude *float64) ([]SOSLocation, error) {
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanSubscribe(ctx, deviceID, groupID); err != nil {
+			return nil, err
+		}
+	}
+	if (viewerLatitude == nil) != (viewerLongitude == nil) {
+		return nil, domain.ErrIncompleteLocation
+	}
+	if viewerLatitude != nil {
+		if err := domain.ValidateCoordinates(*viewerLatitude, *viewerLongitude); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	messages, err := s.messageRepo.GetSOSLocations(ctx, groupID, now.Add(-sosLocationWindow), sosLocationLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SOS messages: %w", err)
+	}
+	shares, err := s.shareRepo.GetActiveByGroup(ctx, groupID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get location shares: %w", err)
+	}
+	liveByDevice := make(map[string]*domain.LocationShare, len(shares))
+	for _, share := range shares {
+		liveByDevice[share.DeviceID] = share
+	}
+
+	locations := make([]SOSLocation, 0, len(messages))
+	for _, message := range messages {
+		location := SOSLocation{
+			MessageID: message.ID,
+			DeviceID:  message.DeviceID,
+			SOSType:   message.SOSType,
+			Content:   message.Content,
+			CreatedAt: message.CreatedAt,
+			Latitude:  *message.Latitude,
+			Longitude: *message.Longitude,
+			Accuracy:  message.Accuracy,
+			LocatedAt: message.CreatedAt,
+		}
+		if share, ok := liveByDevice[message.DeviceID]; ok && share.UpdatedAt.After(message.CreatedAt) {
+			location.Latitude = share.Latitude
+			location.Longitude = share.Longitude
+			location.Accuracy = share.Accuracy
+			location.Live = true
+			location.LocatedAt = share.UpdatedAt
+		}
+		if viewerLatitude != nil {
+			distance := domain.DistanceMeters(*viewerLatitude, *viewerLongitude, location.Latitude, location.Longitude)
+			location.DistanceMeters = &distance
+		}
+		locations = append(locations, location)
+	}
+
+	if viewerLatitude != nil {
+		sort.SliceStable(locations, func(i, j int) bool {
+			return *locations[i].DistanceMeters < *locations[j].DistanceMeters
+		})
+	}
+	return locations, nil
+}
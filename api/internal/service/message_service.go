@@ -2,8 +2,11 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"nearby-msg/api/internal/domain"
 	"nearby-msg/api/internal/infrastructure/database"
@@ -12,42 +15,53 @@ import (
 
 // MessageService handles message business logic
 type MessageService struct {
-	// Store last SOS timestamp per device (in-memory for now)
-	// In production, this should be in Redis or database
-	lastSOSTimestamps map[string]time.Time
-	messageRepo       *database.MessageRepository
+	messageRepo  *database.MessageRepository
+	accessPolicy *AccessPolicy
+	rateLimits   *RateLimitPolicy
+	editWindow   time.Duration // How long after sending a message its author may edit it
 }
 
 // NewMessageService creates a new message service
-func NewMessageService(messageRepo *database.MessageRepository) *MessageService {
+func NewMessageService(messageRepo *database.MessageRepository, accessPolicy *AccessPolicy, rateLimits *RateLimitPolicy, editWindow time.Duration) *MessageService {
 	return &MessageService{
-		lastSOSTimestamps: make(map[string]time.Time),
-		messageRepo:       messageRepo,
+		messageRepo:  messageRepo,
+		accessPolicy: accessPolicy,
+		rateLimits:   rateLimits,
+		editWindow:   editWindow,
 	}
 }
 
-// SOSCooldownDuration is the minimum time between SOS messages (30 seconds)
-const SOSCooldownDuration = 30 * time.Second
-
-// CheckSOSCooldown checks if a device can send an SOS message (30 second cooldown)
-func (s *MessageService) CheckSOSCooldown(ctx context.Context, deviceID string) error {
-	lastSOS, exists := s.lastSOSTimestamps[deviceID]
-	if !exists {
-		return nil // No previous SOS, allowed
+// WithQuerier returns a copy of the service whose repository runs on q (e.g. a transaction).
+// Rate limits are not part of the transaction: tokens taken stay taken if it rolls back.
+func (s *MessageService) WithQuerier(q database.Querier) *MessageService {
+	copied := &MessageService{
+		messageRepo: s.messageRepo.WithQuerier(q),
+		rateLimits:  s.rateLimits,
+		editWindow:  s.editWindow,
 	}
-
-	timeSinceLastSOS := time.Since(lastSOS)
-	if timeSinceLastSOS < SOSCooldownDuration {
-		remaining := SOSCooldownDuration - timeSinceLastSOS
-		return fmt.Errorf("SOS cooldown active: please wait %d more seconds", int(remaining.Seconds())+1)
+	if s.accessPolicy != nil {
+		copied.accessPolicy = s.accessPolicy.WithQuerier(q)
 	}
-
-	return nil
+	return copied
 }
 
-// RecordSOSMessage records that a device sent an SOS message
-func (s *MessageService) RecordSOSMessage(ctx context.Context, deviceID string) {
-	s.lastSOSTimestamps[deviceID] = time.Now()
+const (
+	defaultSearchLimit  = 20
+	maxSearchLimit      = 100
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 200
+)
+
+var (
+	ErrNotMessageAuthor  = errors.New("only the author can change a message")
+	ErrEditWindowExpired = errors.New("message can no longer be edited")
+	ErrReplyOutsideGroup = errors.New("a reply must be in the same group as the message it replies to")
+)
+
+// CheckRateLimit takes a token for a device sending a message of the given type, returning a
+// *RateLimitError if the device is over a limit. SOS messages are also held to the SOS limits.
+func (s *MessageService) CheckRateLimit(ctx context.Context, deviceID string, messageType domain.MessageType) error {
+	return s.rateLimits.AllowMessage(ctx, deviceID, messageType)
 }
 
 // CreateMessageRequest represents a message creation request
@@ -59,17 +73,15 @@ type CreateMessageRequest struct {
 	SOSType        *domain.SOSType    `json:"sos_type,omitempty"`
 	Tags           []string           `json:"tags,omitempty"`
 	DeviceSequence *int               `json:"device_sequence,omitempty"`
+	ReplyToID      *string            `json:"reply_to_id,omitempty"`
+	AttachmentIDs  []string           `json:"attachment_ids,omitempty"` // The sender's uploads to the group (see AttachmentService)
+	Latitude       *float64           `json:"latitude,omitempty"`
+	Longitude      *float64           `json:"longitude,omitempty"`
+	Accuracy       *float64           `json:"accuracy,omitempty"`
 }
 
 // CreateMessage creates a new message with validation
 func (s *MessageService) CreateMessage(ctx context.Context, req CreateMessageRequest) (*domain.Message, error) {
-	// Check SOS cooldown if this is an SOS message
-	if req.MessageType == domain.MessageTypeSOS {
-		if err := s.CheckSOSCooldown(ctx, req.DeviceID); err != nil {
-			return nil, fmt.Errorf("SOS cooldown check failed: %w", err)
-		}
-	}
-
 	// Create message
 	messageID, err := utils.GenerateID()
 	if err != nil {
@@ -87,16 +99,24 @@ func (s *MessageService) CreateMessage(ctx context.Context, req CreateMessageReq
 		Pinned:         false,
 		CreatedAt:      time.Now(),
 		DeviceSequence: req.DeviceSequence,
+		ReplyToID:      req.ReplyToID,
+		AttachmentIDs:  req.AttachmentIDs,
+		Latitude:       req.Latitude,
+		Longitude:      req.Longitude,
+		Accuracy:       req.Accuracy,
 	}
 
 	// Validate message
 	if err := message.Validate(); err != nil {
 		return nil, fmt.Errorf("message validation failed: %w", err)
 	}
+	if err := attachReplyQuote(ctx, s.messageRepo, message); err != nil {
+		return nil, err
+	}
 
-	// Record SOS if applicable
-	if req.MessageType == domain.MessageTypeSOS {
-		s.RecordSOSMessage(ctx, req.DeviceID)
+	// Only valid messages count towards the limits
+	if err := s.CheckRateLimit(ctx, req.DeviceID, req.MessageType); err != nil {
+		return nil, err
 	}
 
 	return message, nil
@@ -107,6 +127,17 @@ func (s *MessageService) ValidateMessage(message *domain.Message) error {
 	return message.Validate()
 }
 
+// clampLimit returns def for an unset limit and caps the rest at maxLimit
+func clampLimit(limit, def, maxLimit int) int {
+	if limit <= 0 {
+		return def
+	}
+	if limit > maxLimit {
+		return maxLimit
+	}
+	return limit
+}
+
 // EnforceRetention ensures groups do not exceed the maximum number of messages.
 func (s *MessageService) EnforceRetention(ctx context.Context, groupID string, maxMessages int) error {
 	if s.messageRepo == nil {
@@ -114,3 +145,282 @@ func (s *MessageService) EnforceRetention(ctx context.Context, groupID string, m
 	}
 	return s.messageRepo.TrimOldMessages(ctx, groupID, maxMessages)
 }
+
+// maxSearchQueryLength bounds search queries; messages themselves are at most 2048 characters
+const maxSearchQueryLength = 200
+
+// SearchMessagesRequest represents a message search within a group
+type SearchMessagesRequest struct {
+	Query       string              `json:"q"`
+	MessageType *domain.MessageType `json:"message_type,omitempty"`
+	SOSType     *domain.SOSType     `json:"sos_type,omitempty"`
+	Tags        []string            `json:"tags,omitempty"` // Messages must carry all of them
+	From        *time.Time          `json:"from,omitempty"` // Inclusive
+	To          *time.Time          `json:"to,omitempty"`   // Exclusive
+	Cursor      string              `json:"cursor,omitempty"`
+	Limit       int                 `json:"limit,omitempty"`
+}
+
+// SearchMessagesResponse is a page of search results
+type SearchMessagesResponse struct {
+	Results    []database.MessageSearchResult `json:"results"`
+	NextCursor string                         `json:"next_cursor,omitempty"` // Set if there may be more results
+}
+
+// SearchMessages searches a group's messages, most relevant first.
+// Reading a group's history follows the same rules as subscribing to it.
+func (s *MessageService) SearchMessages(ctx context.Context, deviceID, groupID string, req SearchMessagesRequest) (*SearchMessagesResponse, error) {
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		return nil, fmt.Errorf("search query is required")
+	}
+	if utf8.RuneCountInString(query) > maxSearchQueryLength {
+		return nil, fmt.Errorf("search query must be at most %d characters", maxSearchQueryLength)
+	}
+	if req.MessageType != nil && !req.MessageType.IsValid() {
+		return nil, domain.ErrInvalidMessageType
+	}
+	if req.SOSType != nil && !req.SOSType.IsValid() {
+		return nil, domain.ErrInvalidSOSType
+	}
+	if req.From != nil && req.To != nil && !req.From.Before(*req.To) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+
+	var after *database.SearchCursor
+	if req.Cursor != "" {
+		cursor, err := database.ParseSearchCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &cursor
+	}
+
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanSubscribe(ctx, deviceID, groupID); err != nil {
+			return nil, err
+		}
+	}
+
+	limit := clampLimit(req.Limit, defaultSearchLimit, maxSearchLimit)
+	results, err := s.messageRepo.SearchMessages(ctx, groupID, database.MessageSearchFilter{
+		Query:       query,
+		MessageType: req.MessageType,
+		SOSType:     req.SOSType,
+		Tags:        req.Tags,
+		From:        req.From,
+		To:          req.To,
+	}, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	resp := &SearchMessagesResponse{Results: results}
+	if resp.Results == nil {
+		resp.Results = []database.MessageSearchResult{}
+	}
+	if len(results) == limit {
+		last := results[len(results)-1]
+		resp.NextCursor = database.SearchCursor{Rank: last.Rank, Time: last.Message.CreatedAt, ID: last.Message.ID}.Encode()
+	}
+	return resp, nil
+}
+
+// GroupHistoryRequest selects a page of a group's message history.
+// At most one of Before and After may be set; with neither, the latest messages are returned.
+type GroupHistoryRequest struct {
+	Before *database.Cursor `json:"before,omitempty"` // Older messages than this position
+	After  *database.Cursor `json:"after,omitempty"`  // Newer messages than this position
+	Limit  int              `json:"limit,omitempty"`
+}
+
+// GroupHistoryResponse is a page of a group's history, oldest message first
+type GroupHistoryResponse struct {
+	Messages []*database.GroupMessage `json:"messages"`
+	HasMore  bool                     `json:"has_more"`         // More messages exist in the requested direction (older if After wasn't set)
+	Before   *database.Cursor         `json:"before,omitempty"` // Pass as before to page further back
+	After    *database.Cursor         `json:"after,omitempty"`  // Pass as after to page forward
+}
+
+// GetGroupHistory returns a page of a group's messages for a device.
+// Reading a group's history follows the same rules as subscribing to it.
+func (s *MessageService) GetGroupHistory(ctx context.Context, deviceID, groupID string, req GroupHistoryRequest) (*GroupHistoryResponse, error) {
+	if req.Before != nil && req.After != nil {
+		return nil, fmt.Errorf("before and after cannot be combined")
+	}
+
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanSubscribe(ctx, deviceID, groupID); err != nil {
+			return nil, err
+		}
+	}
+
+	limit := clampLimit(req.Limit, defaultHistoryLimit, maxHistoryLimit)
+	messages, hasMore, err := s.messageRepo.GetGroupMessages(ctx, groupID, deviceID, req.Before, req.After, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	resp := &GroupHistoryResponse{Messages: messages, HasMore: hasMore}
+	if resp.Messages == nil {
+		resp.Messages = []*database.GroupMessage{}
+	}
+	if len(messages) > 0 {
+		oldest, newest := messages[0], messages[len(messages)-1]
+		before := database.NewCursor(oldest.CreatedAt, oldest.ID)
+		after := database.NewCursor(newest.CreatedAt, newest.ID)
+		resp.Before, resp.After = &before, &after
+	}
+	return resp, nil
+}
+
+// EditMessage replaces the content of a message on behalf of its author, recording the previous
+// content in the message's edit history. Authors may only edit within the edit window and while
+// they can still post in the group. An edit that doesn't change the content is a no-op.
+func (s *MessageService) EditMessage(ctx context.Context, deviceID, messageID, content string) (*domain.Message, error) {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if message.DeviceID != deviceID {
+		return nil, ErrNotMessageAuthor
+	}
+	if time.Since(message.CreatedAt) > s.editWindow {
+		return nil, ErrEditWindowExpired
+	}
+
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanPost(ctx, deviceID, message.GroupID); err != nil {
+			return nil, err
+		}
+	}
+
+	if content == message.Content {
+		return message, nil
+	}
+	edited := *message
+	edited.Content = content
+	if err := edited.Validate(); err != nil {
+		return nil, fmt.Errorf("message validation failed: %w", err)
+	}
+
+	editID, err := utils.GenerateID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate edit ID: %w", err)
+	}
+	edit := &domain.MessageEdit{
+		ID:        editID,
+		MessageID: message.ID,
+		DeviceID:  deviceID,
+		EditedAt:  time.Now(),
+	}
+	if err := s.messageRepo.EditMessage(ctx, edit, content); err != nil {
+		return nil, fmt.Errorf("failed to edit message: %w", err)
+	}
+
+	edited.EditedAt = &edit.EditedAt
+	return &edited, nil
+}
+
+// GetMessageEdits returns a message's edit history, oldest first.
+// Reading it follows the same rules as subscribing to the message's group.
+func (s *MessageService) GetMessageEdits(ctx context.Context, deviceID, messageID string) ([]*domain.MessageEdit, error) {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanSubscribe(ctx, deviceID, message.GroupID); err != nil {
+			return nil, err
+		}
+	}
+
+	edits, err := s.messageRepo.GetEdits(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message edits: %w", err)
+	}
+	if edits == nil {
+		edits = []*domain.MessageEdit{}
+	}
+	return edits, nil
+}
+
+// DeleteMessage soft-deletes a message on behalf of its author and removes its pins and reactions.
+// The deletion reaches other devices as a tombstone on their next pull.
+func (s *MessageService) DeleteMessage(ctx context.Context, deviceID, messageID string) (*domain.Message, error) {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if message.DeviceID != deviceID {
+		return nil, ErrNotMessageAuthor
+	}
+
+	deletedAt := time.Now()
+	if err := s.messageRepo.SoftDelete(ctx, messageID, deletedAt); err != nil {
+		return nil, fmt.Errorf("failed to delete message: %w", err)
+	}
+
+	message.DeletedAt = &deletedAt
+	return message, nil
+}
+
+// attachReplyQuote checks that a new reply answers a live message in its own group and
+// quotes that message on it. Messages that aren't replies are left alone.
+func attachReplyQuote(ctx context.Context, repo *database.MessageRepository, message *domain.Message) error {
+	if message.ReplyToID == nil {
+		return nil
+	}
+	parent, err := repo.GetByID(ctx, *message.ReplyToID)
+	if err != nil {
+		return fmt.Errorf("failed to get replied-to message: %w", err)
+	}
+	if parent.GroupID != message.GroupID {
+		return ErrReplyOutsideGroup
+	}
+	message.ReplyTo = domain.NewMessageQuote(parent.ID, parent.DeviceID, parent.Content, false)
+	return nil
+}
+
+// RepliesResponse is a page of the replies to a message, oldest first
+type RepliesResponse struct {
+	Replies    []*domain.Message `json:"replies"`
+	NextCursor *database.Cursor  `json:"next_cursor,omitempty"` // Set if there may be more replies; pass as after
+}
+
+// GetReplies returns a page of the replies to a message.
+// Reading them follows the same rules as subscribing to the message's group.
+func (s *MessageService) GetReplies(ctx context.Context, deviceID, messageID string, after *database.Cursor, limit int) (*RepliesResponse, error) {
+	parent, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanSubscribe(ctx, deviceID, parent.GroupID); err != nil {
+			return nil, err
+		}
+	}
+
+	var since database.Cursor
+	if after != nil {
+		since = *after
+	}
+	limit = clampLimit(limit, defaultHistoryLimit, maxHistoryLimit)
+	replies, err := s.messageRepo.GetReplies(ctx, messageID, since, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replies: %w", err)
+	}
+
+	resp := &RepliesResponse{Replies: replies}
+	if resp.Replies == nil {
+		resp.Replies = []*domain.Message{}
+	}
+	if len(replies) == limit {
+		last := replies[len(replies)-1]
+		next := database.NewCursor(last.CreatedAt, last.ID)
+		resp.NextCursor = &next
+	}
+	return resp, nil
+}
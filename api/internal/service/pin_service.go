@@ -11,15 +11,19 @@ import (
 
 // PinService handles pinned message business logic
 type PinService struct {
-	pinRepo     *database.PinRepository
-	messageRepo *database.MessageRepository
+	pinRepo      *database.PinRepository
+	messageRepo  *database.MessageRepository
+	accessPolicy *AccessPolicy
+	rateLimits   *RateLimitPolicy
 }
 
 // NewPinService creates a new pin service
-func NewPinService(pinRepo *database.PinRepository, messageRepo *database.MessageRepository) *PinService {
+func NewPinService(pinRepo *database.PinRepository, messageRepo *database.MessageRepository, accessPolicy *AccessPolicy, rateLimits *RateLimitPolicy) *PinService {
 	return &PinService{
-		pinRepo:     pinRepo,
-		messageRepo: messageRepo,
+		pinRepo:      pinRepo,
+		messageRepo:  messageRepo,
+		accessPolicy: accessPolicy,
+		rateLimits:   rateLimits,
 	}
 }
 
@@ -44,6 +48,16 @@ func (s *PinService) PinMessage(ctx context.Context, deviceID, messageID string,
 	}
 	groupID := message.GroupID
 
+	// Pinning is a write to the group, so it follows the same rules as posting
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanPost(ctx, deviceID, groupID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.rateLimits.AllowPin(ctx, deviceID); err != nil {
+		return nil, err
+	}
+
 	// Create new pin
 	pinID, err := utils.GenerateID()
 	if err != nil {
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"nearby-msg/api/internal/infrastructure/database"
+)
+
+// PresenceService reports which devices are online in a group
+type PresenceService struct {
+	wsService    *WebSocketService
+	deviceRepo   *database.DeviceRepository
+	accessPolicy *AccessPolicy
+}
+
+// NewPresenceService creates a new presence service
+func NewPresenceService(wsService *WebSocketService, deviceRepo *database.DeviceRepository, accessPolicy *AccessPolicy) *PresenceService {
+	return &PresenceService{
+		wsService:    wsService,
+		deviceRepo:   deviceRepo,
+		accessPolicy: accessPolicy,
+	}
+}
+
+// GroupPresence lists the devices online in a group
+type GroupPresence struct {
+	GroupID string         `json:"group_id"`
+	Online  int            `json:"online"`
+	Devices []OnlineDevice `json:"devices"`
+}
+
+// OnlineDevice is a device with at least one connection subscribed to the group
+type OnlineDevice struct {
+	DeviceID string `json:"device_id"`
+	Nickname string `json:"nickname"`
+}
+
+// GetGroupPresence returns the devices subscribed to a group over WebSocket, counted once
+// however many connections and instances each has. Seeing presence follows the same rules
+// as subscribing.
+func (s *PresenceService) GetGroupPresence(ctx context.Context, deviceID, groupID string) (*GroupPresence, error) {
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanSubscribe(ctx, deviceID, groupID); err != nil {
+			return nil, err
+		}
+	}
+
+	deviceIDs, err := s.wsService.GroupPresence(ctx, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get presence: %w", err)
+	}
+	nicknames, err := s.deviceRepo.GetNicknames(ctx, deviceIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nicknames: %w", err)
+	}
+
+	devices := make([]OnlineDevice, 0, len(deviceIDs))
+	for _, id := range deviceIDs {
+		devices = append(devices, OnlineDevice{DeviceID: id, Nickname: nicknames[id]})
+	}
+	return &GroupPresence{
+		GroupID: groupID,
+		Online:  len(devices),
+		Devices: devices,
+	}, nil
+}
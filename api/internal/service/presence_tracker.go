@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"nearby-msg/api/internal/infrastructure/database"
+	"nearby-msg/api/internal/infrastructure/logging"
+	"nearby-msg/api/internal/utils"
+)
+
+const (
+	// presenceHeartbeatInterval is how often an instance marks its connections as live
+	presenceHeartbeatInterval = 15 * time.Second
+	// presenceTTL is how long connections of an instance that stopped heartbeating (e.g. it
+	// crashed) count as present before they are removed and their devices announced as gone
+	presenceTTL = 45 * time.Second
+)
+
+// PresenceTracker tracks the WebSocket connections subscribed to each group, so a device is
+// announced when its first connection joins a group and its last one leaves, however many
+// tabs and instances it is connected through
+type PresenceTracker interface {
+	// Join records a connection of a device subscribed to a group. Returns true if it is the
+	// device's only connection to the group.
+	Join(ctx context.Context, groupID, deviceID, connectionID string) (bool, error)
+	// Leave removes a connection from a group. Returns true if it was the device's last
+	// connection to the group.
+	Leave(ctx context.Context, groupID, deviceID, connectionID string) (bool, error)
+	// Devices lists the distinct devices with a connection to a group, ordered by ID
+	Devices(ctx context.Context, groupID string) ([]string, error)
+}
+
+// InMemoryPresenceTracker tracks connections in process memory (single-node deployments)
+type InMemoryPresenceTracker struct {
+	mu     sync.Mutex
+	groups map[string]map[string]map[string]bool // group ID -> device ID -> set of connection IDs
+}
+
+// NewInMemoryPresenceTracker creates a new in-memory presence tracker
+func NewInMemoryPresenceTracker() *InMemoryPresenceTracker {
+	return &InMemoryPresenceTracker{groups: make(map[string]map[string]map[string]bool)}
+}
+
+// Join records a connection of a device subscribed to a group
+func (t *InMemoryPresenceTracker) Join(ctx context.Context, groupID, deviceID, connectionID string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	devices, ok := t.groups[groupID]
+	if !ok {
+		devices = make(map[string]map[string]bool)
+		t.groups[groupID] = devices
+	}
+	connections, ok := devices[deviceID]
+	if !ok {
+		connections = make(map[string]bool)
+		devices[deviceID] = connections
+	}
+	connections[connectionID] = true
+	return len(connections) == 1, nil
+}
+
+// Leave removes a connection from a group
+func (t *InMemoryPresenceTracker) Leave(ctx context.Context, groupID, deviceID, connectionID string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	connections := t.groups[groupID][deviceID]
+	if !connections[connectionID] {
+		return false, nil
+	}
+	delete(connections, connectionID)
+	if len(connections) > 0 {
+		return false, nil
+	}
+	delete(t.groups[groupID], deviceID)
+	if len(t.groups[groupID]) == 0 {
+		delete(t.groups, groupID)
+	}
+	return true, nil
+}
+
+// Devices lists the distinct devices with a connection to a group
+func (t *InMemoryPresenceTracker) Devices(ctx context.Context, groupID string) ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	deviceIDs := make([]string, 0, len(t.groups[groupID]))
+	for deviceID := range t.groups[groupID] {
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	sort.Strings(deviceIDs)
+	return deviceIDs, nil
+}
+
+// PostgresPresenceTracker tracks connections in PostgreSQL, so presence covers every instance.
+// Each instance heartbeats its connections; see Run.
+type PostgresPresenceTracker struct {
+	repo       *database.PresenceRepository
+	instanceID string
+}
+
+// NewPostgresPresenceTracker creates a PostgreSQL-backed presence tracker for this instance
+func NewPostgresPresenceTracker(repo *database.PresenceRepository) (*PostgresPresenceTracker, error) {
+	instanceID, err := utils.GenerateID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate instance ID: %w", err)
+	}
+	return &PostgresPresenceTracker{repo: repo, instanceID: instanceID}, nil
+}
+
+// Join records a connection of a device subscribed to a group
+func (t *PostgresPresenceTracker) Join(ctx context.Context, groupID, deviceID, connectionID string) (bool, error) {
+	first, err := t.repo.Join(ctx, groupID, deviceID, connectionID, t.instanceID, presenceTTL)
+	if err != nil {
+		return false, fmt.Errorf("failed to record presence: %w", err)
+	}
+	return first, nil
+}
+
+// Leave removes a connection from a group
+func (t *PostgresPresenceTracker) Leave(ctx context.Context, groupID, deviceID, connectionID string) (bool, error) {
+	last, err := t.repo.Leave(ctx, groupID, deviceID, connectionID, presenceTTL)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove presence: %w", err)
+	}
+	return last, nil
+}
+
+// Devices lists the distinct devices with a live connection to a group on any instance
+func (t *PostgresPresenceTracker) Devices(ctx context.Context, groupID string) ([]string, error) {
+	deviceIDs, err := t.repo.GetDevices(ctx, groupID, presenceTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get presence: %w", err)
+	}
+	return deviceIDs, nil
+}
+
+// Run heartbeats this instance's connections every presenceHeartbeatInterval until ctx is
+// cancelled. Connections of instances that stopped heartbeating are removed, and gone is
+// called for each device left with no connection to a group.
+func (t *PostgresPresenceTracker) Run(ctx context.Context, gone func(groupID, deviceID string)) {
+	ticker := time.NewTicker(presenceHeartbeatInterval)
+	defer ticker.Stop()
+
+	logger := logging.GetLogger()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.repo.Touch(ctx, t.instanceID); err != nil && ctx.Err() == nil {
+				logger.Warn("Failed to heartbeat presence", "error", err)
+			}
+			t.removeStale(ctx, gone)
+		}
+	}
+}
+
+// removeStale removes connections not heartbeated within presenceTTL
+func (t *PostgresPresenceTracker) removeStale(ctx context.Context, gone func(groupID, deviceID string)) {
+	logger := logging.GetLogger()
+	stale, err := t.repo.GetStale(ctx, presenceTTL)
+	if err != nil {
+		if ctx.Err() == nil {
+			logger.Warn("Failed to list stale presence", "error", err)
+		}
+		return
+	}
+	for _, key := range stale {
+		last, err := t.repo.RemoveStale(ctx, key, presenceTTL)
+		if err != nil {
+			logger.Warn("Failed to remove stale presence", "groupID", key.GroupID, "deviceID", key.DeviceID, "error", err)
+			continue
+		}
+		if last {
+			gone(key.GroupID, key.DeviceID)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+	"nearby-msg/api/internal/infrastructure/database"
+	"nearby-msg/api/internal/infrastructure/logging"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// RateLimitRule is a token bucket per key: up to Limit actions may happen at once, and the
+// bucket refills one token every Window/Limit. A rule with a zero Limit is disabled.
+type RateLimitRule struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// Enabled reports whether the rule limits anything
+func (r RateLimitRule) Enabled() bool {
+	return r.Limit > 0 && r.Window > 0
+}
+
+// interval is how long the bucket takes to regain one token
+func (r RateLimitRule) interval() time.Duration {
+	return r.Window / time.Duration(r.Limit)
+}
+
+// String formats the rule the way ParseRateLimitRule reads it
+func (r RateLimitRule) String() string {
+	if !r.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", r.Limit, r.Window)
+}
+
+// ParseRateLimitRule reads a rule written as "<limit>/<window>", e.g. "10/1m", or "off" to
+// disable it. An empty value keeps def.
+func ParseRateLimitRule(value string, def RateLimitRule) (RateLimitRule, error) {
+	value = strings.TrimSpace(value)
+	switch value {
+	case "":
+		return def, nil
+	case "off", "0":
+		return RateLimitRule{Name: def.Name}, nil
+	}
+
+	limitStr, windowStr, ok := strings.Cut(value, "/")
+	if !ok {
+		return RateLimitRule{}, fmt.Errorf("invalid rate limit %q: expected <limit>/<window>", value)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(limitStr))
+	if err != nil || limit < 0 {
+		return RateLimitRule{}, fmt.Errorf("invalid rate limit %q: limit must be a non-negative integer", value)
+	}
+	window, err := time.ParseDuration(strings.TrimSpace(windowStr))
+	if err != nil || window <= 0 {
+		return RateLimitRule{}, fmt.Errorf("invalid rate limit %q: window must be a positive duration", value)
+	}
+	return RateLimitRule{Name: def.Name, Limit: limit, Window: window}, nil
+}
+
+// RateLimitError is returned when a rate limit rule denies an action
+type RateLimitError struct {
+	Rule       RateLimitRule
+	RetryAfter time.Duration // How long until the action would be allowed
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s rate limit exceeded (max %d per %s): retry in %d seconds",
+		e.Rule.Name, e.Rule.Limit, e.Rule.Window, e.RetryAfterSeconds())
+}
+
+// RetryAfterSeconds returns RetryAfter rounded up to whole seconds, as sent in Retry-After
+func (e *RateLimitError) RetryAfterSeconds() int {
+	seconds := int(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// AsRateLimitError extracts a *RateLimitError from err's chain
+func AsRateLimitError(err error) (*RateLimitError, bool) {
+	var rateErr *RateLimitError
+	if errors.As(err, &rateErr) {
+		return rateErr, true
+	}
+	return nil, false
+}
+
+// RateLimiter keeps a token bucket per rule and key
+type RateLimiter interface {
+	// Take takes a token from key's bucket under each of the enabled rules, all or none. If any
+	// bucket is empty, nothing is taken and it returns the error of the rule with the longest wait.
+	Take(ctx context.Context, rules []RateLimitRule, key string) (*RateLimitError, error)
+}
+
+// longerWait returns whichever denial has the longer wait; either may be nil
+func longerWait(current *RateLimitError, rule RateLimitRule, retryAfter time.Duration) *RateLimitError {
+	if current != nil && current.RetryAfter >= retryAfter {
+		return current
+	}
+	return &RateLimitError{Rule: rule, RetryAfter: retryAfter}
+}
+
+// inMemoryBucket is a token bucket held by InMemoryRateLimiter
+type inMemoryBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// inMemorySweepInterval is how often InMemoryRateLimiter drops buckets that have refilled
+const inMemorySweepInterval = time.Minute
+
+// InMemoryRateLimiter keeps token buckets in process memory. Limits hold per instance and
+// reset on restart; use PostgresRateLimiter when running several instances.
+type InMemoryRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*inMemoryBucket // "rule:key" -> bucket
+	windows   map[string]time.Duration   // "rule:key" -> window of the rule, for sweeping
+	lastSweep time.Time
+}
+
+// NewInMemoryRateLimiter creates a new in-memory rate limiter
+func NewInMemoryRateLimiter() *InMemoryRateLimiter {
+	return &InMemoryRateLimiter{
+		buckets:   make(map[string]*inMemoryBucket),
+		windows:   make(map[string]time.Duration),
+		lastSweep: time.Now(),
+	}
+}
+
+// Take takes a token from key's bucket under each rule, all or none
+func (l *InMemoryRateLimiter) Take(ctx context.Context, rules []RateLimitRule, key string) (*RateLimitError, error) {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= inMemorySweepInterval {
+		l.sweepLocked(now)
+	}
+
+	// Check every bucket before taking from any
+	tokens := make([]float64, len(rules))
+	var denied *RateLimitError
+	for i, rule := range rules {
+		capacity := float64(rule.Limit)
+		perToken := rule.interval()
+
+		// A missing bucket is full
+		tokens[i] = capacity
+		if bucket, ok := l.buckets[rule.Name+":"+key]; ok {
+			tokens[i] = math.Min(capacity, bucket.tokens+float64(now.Sub(bucket.updatedAt))/float64(perToken))
+		}
+		if tokens[i] < 1 {
+			denied = longerWait(denied, rule, time.Duration((1-tokens[i])*float64(perToken)))
+		}
+	}
+	if denied != nil {
+		return denied, nil
+	}
+
+	for i, rule := range rules {
+		bucketKey := rule.Name + ":" + key
+		l.buckets[bucketKey] = &inMemoryBucket{tokens: tokens[i] - 1, updatedAt: now}
+		l.windows[bucketKey] = rule.Window
+	}
+	return nil, nil
+}
+
+// sweepLocked drops buckets untouched for a whole window, which have refilled.
+// Caller must hold l.mu.
+func (l *InMemoryRateLimiter) sweepLocked(now time.Time) {
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updatedAt) >= l.windows[key] {
+			delete(l.buckets, key)
+			delete(l.windows, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// PostgresRateLimiter keeps token buckets in PostgreSQL, so limits hold across instances and restarts
+type PostgresRateLimiter struct {
+	pool *database.Pool
+	repo *database.RateLimitRepository
+}
+
+// NewPostgresRateLimiter creates a new PostgreSQL-backed rate limiter
+func NewPostgresRateLimiter(pool *database.Pool, repo *database.RateLimitRepository) *PostgresRateLimiter {
+	return &PostgresRateLimiter{pool: pool, repo: repo}
+}
+
+// errRateLimitDenied rolls back the tokens taken when a later rule denies
+var errRateLimitDenied = errors.New("rate limit denied")
+
+// Take takes a token from key's bucket under each rule, all or none. The tokens are taken in
+// one transaction that is rolled back if any rule denies.
+func (l *PostgresRateLimiter) Take(ctx context.Context, rules []RateLimitRule, key string) (*RateLimitError, error) {
+	var denied *RateLimitError
+	err := l.pool.WithTx(ctx, func(tx pgx.Tx) error {
+		repo := l.repo.WithQuerier(tx)
+		for _, rule := range rules {
+			taken, retryAfter, err := repo.Take(ctx, rule.Name, key, rule.interval(), rule.Window)
+			if err != nil {
+				return fmt.Errorf("failed to take rate limit token: %w", err)
+			}
+			if !taken {
+				denied = longerWait(denied, rule, retryAfter)
+			}
+		}
+		if denied != nil {
+			return errRateLimitDenied
+		}
+		return nil
+	})
+	if denied != nil {
+		return denied, nil
+	}
+	return nil, err
+}
+
+// RunCleanup deletes buckets that have refilled every interval until ctx is cancelled
+func (l *PostgresRateLimiter) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := l.repo.DeleteRefilled(ctx); err != nil && ctx.Err() == nil {
+				logging.GetLogger().Warn("Failed to delete refilled rate limit buckets", "error", err)
+			}
+		}
+	}
+}
+
+// RateLimits are the rules RateLimitPolicy applies, each per device
+type RateLimits struct {
+	Messages    RateLimitRule // Any message but SOS, over WebSocket or push
+	SOS         RateLimitRule // SOS messages, which have their own budget so chat never blocks one
+	SOSCooldown RateLimitRule // Minimum spacing of SOS messages
+	GroupCreate RateLimitRule
+	Pins        RateLimitRule
+	Locations   RateLimitRule // Live location share positions
+}
+
+// DefaultRateLimits returns the rules used when none are configured
+func DefaultRateLimits() RateLimits {
+	return RateLimits{
+		Messages:    RateLimitRule{Name: "messages", Limit: 10, Window: time.Minute},
+		SOS:         RateLimitRule{Name: "sos", Limit: 6, Window: time.Hour},
+		SOSCooldown: RateLimitRule{Name: "sos_cooldown", Limit: 1, Window: 30 * time.Second},
+		GroupCreate: RateLimitRule{Name: "group_create", Limit: 5, Window: time.Hour},
+		Pins:        RateLimitRule{Name: "pins", Limit: 30, Window: time.Minute},
+		Locations:   RateLimitRule{Name: "locations", Limit: 30, Window: time.Minute},
+	}
+}
+
+// RateLimitPolicy applies the configured rate limits to device actions. A nil policy allows
+// everything. If the limiter fails, the action is allowed, so an outage of the limiter's
+// storage never blocks an SOS.
+type RateLimitPolicy struct {
+	limiter RateLimiter
+	limits  RateLimits
+}
+
+// NewRateLimitPolicy creates a new rate limit policy
+func NewRateLimitPolicy(limiter RateLimiter, limits RateLimits) *RateLimitPolicy {
+	return &RateLimitPolicy{limiter: limiter, limits: limits}
+}
+
+// AllowMessage takes a token for a device sending a message of the given type. SOS messages
+// only count against the SOS rules, so sending chat never uses up an emergency.
+func (p *RateLimitPolicy) AllowMessage(ctx context.Context, deviceID string, messageType domain.MessageType) error {
+	if messageType == domain.MessageTypeSOS {
+		return p.allow(ctx, deviceID, p.limits.SOSCooldown, p.limits.SOS)
+	}
+	return p.allow(ctx, deviceID, p.limits.Messages)
+}
+
+// AllowGroupCreate takes a token for a device creating a group
+func (p *RateLimitPolicy) AllowGroupCreate(ctx context.Context, deviceID string) error {
+	return p.allow(ctx, deviceID, p.limits.GroupCreate)
+}
+
+// AllowPin takes a token for a device pinning a message
+func (p *RateLimitPolicy) AllowPin(ctx context.Context, deviceID string) error {
+	return p.allow(ctx, deviceID, p.limits.Pins)
+}
+
+// AllowLocationUpdate takes a token for a device sending a live location position
+func (p *RateLimitPolicy) AllowLocationUpdate(ctx context.Context, deviceID string) error {
+	return p.allow(ctx, deviceID, p.limits.Locations)
+}
+
+// allow takes a token from each enabled rule if all of them allow it; if any denies, none is taken
+func (p *RateLimitPolicy) allow(ctx context.Context, key string, rules ...RateLimitRule) error {
+	if p == nil || p.limiter == nil {
+		return nil
+	}
+	enabled := make([]RateLimitRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Enabled() {
+			enabled = append(enabled, rule)
+		}
+	}
+	if len(enabled) == 0 {
+		return nil
+	}
+
+	denied, err := p.limiter.Take(ctx, enabled, key)
+	if err != nil {
+		logging.GetLogger().Warn("Rate limiter failed, allowing action", "key", key, "error", err)
+		return nil
+	}
+	if denied != nil {
+		return denied
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"nearby-msg/api/internal/domain"
+	"nearby-msg/api/internal/infrastructure/database"
+	"nearby-msg/api/internal/utils"
+)
+
+// ReactionService handles message reaction business logic
+type ReactionService struct {
+	reactionRepo *database.ReactionRepository
+	messageRepo  *database.MessageRepository
+	accessPolicy *AccessPolicy
+	sosService   *SOSService
+}
+
+// NewReactionService creates a new reaction service
+func NewReactionService(reactionRepo *database.ReactionRepository, messageRepo *database.MessageRepository, accessPolicy *AccessPolicy, sosService *SOSService) *ReactionService {
+	return &ReactionService{
+		reactionRepo: reactionRepo,
+		messageRepo:  messageRepo,
+		accessPolicy: accessPolicy,
+		sosService:   sosService,
+	}
+}
+
+// ReactionChange is the outcome of adding or removing a reaction
+type ReactionChange struct {
+	Reaction *domain.MessageReaction `json:"reaction"`
+	Count    int                     `json:"count"`              // Reactions of this kind on the message after the change
+	Changed  bool                    `json:"changed"`            // False if the device already had the reaction, or had none to remove
+	Incident *domain.SOSIncident     `json:"incident,omitempty"` // Set when an ack or responding reaction changed the SOS incident
+}
+
+// AddReaction adds a device's reaction to a message. Adding a reaction the device already has
+// changes nothing and reports the existing one. An ack reaction acknowledges the message's
+// open SOS incident and a responding reaction claims it, as update_sos and claim_sos do.
+func (s *ReactionService) AddReaction(ctx context.Context, deviceID, messageID string, kind domain.ReactionKind) (*ReactionChange, error) {
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if err := kind.ValidateFor(message); err != nil {
+		return nil, err
+	}
+
+	// Reacting is a write to the group, so it follows the same rules as posting
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanPost(ctx, deviceID, message.GroupID); err != nil {
+			return nil, err
+		}
+	}
+
+	reactionID, err := utils.GenerateID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate reaction ID: %w", err)
+	}
+	reaction := &domain.MessageReaction{
+		ID:        reactionID,
+		MessageID: message.ID,
+		GroupID:   message.GroupID,
+		DeviceID:  deviceID,
+		Kind:      kind,
+	}
+	changed, err := s.reactionRepo.Add(ctx, reaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add reaction: %w", err)
+	}
+
+	incident, err := s.applyToIncident(ctx, deviceID, message, kind, true)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := s.reactionRepo.CountKind(ctx, messageID, kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	return &ReactionChange{Reaction: reaction, Count: count, Changed: changed, Incident: incident}, nil
+}
+
+// RemoveReaction removes a device's reaction from a message. Removing a reaction the device
+// doesn't have changes nothing. Removing a responding reaction releases the device's claim on
+// the message's SOS incident.
+func (s *ReactionService) RemoveReaction(ctx context.Context, deviceID, messageID string, kind domain.ReactionKind) (*ReactionChange, error) {
+	if !kind.IsValid() {
+		return nil, domain.ErrInvalidReactionKind
+	}
+
+	message, err := s.messageRepo.GetByID(ctx, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanPost(ctx, deviceID, message.GroupID); err != nil {
+			return nil, err
+		}
+	}
+
+	changed := true
+	reaction, err := s.reactionRepo.Remove(ctx, deviceID, messageID, kind)
+	if err != nil {
+		if !strings.Contains(err.Error(), "not found") {
+			return nil, fmt.Errorf("failed to remove reaction: %w", err)
+		}
+		changed = false
+		reaction = &domain.MessageReaction{
+			MessageID: message.ID,
+			GroupID:   message.GroupID,
+			DeviceID:  deviceID,
+			Kind:      kind,
+		}
+	}
+
+	var incident *domain.SOSIncident
+	if changed {
+		incident, err = s.applyToIncident(ctx, deviceID, message, kind, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	count, err := s.reactionRepo.CountKind(ctx, messageID, kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	return &ReactionChange{Reaction: reaction, Count: count, Changed: changed, Incident: incident}, nil
+}
+
+// applyToIncident carries an ack or responding reaction over to the SOS incident of the
+// message, so reacting and changing the incident directly never disagree. Adding ack
+// acknowledges an open incident, adding responding claims it and removing responding
+// releases the claim. Returns the incident if it changed. An incident already past the
+// state, resolved or missing is left as it is.
+func (s *ReactionService) applyToIncident(ctx context.Context, deviceID string, message *domain.Message, kind domain.ReactionKind, added bool) (*domain.SOSIncident, error) {
+	if s.sosService == nil || message.MessageType != domain.MessageTypeSOS {
+		return nil, nil
+	}
+
+	var change *SOSChange
+	var err error
+	switch {
+	case kind == domain.ReactionAck && added:
+		change, err = s.sosService.Transition(ctx, deviceID, message.ID, domain.SOSStateAcknowledged)
+	case kind == domain.ReactionResponding && added:
+		change, err = s.sosService.Claim(ctx, deviceID, message.ID)
+	case kind == domain.ReactionResponding:
+		change, err = s.sosService.Release(ctx, deviceID, message.ID)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidSOSTransition) || errors.Is(err, domain.ErrSOSResolved) ||
+			strings.Contains(err.Error(), "not found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to update SOS incident: %w", err)
+	}
+	if !change.Changed {
+		return nil, nil
+	}
+	return change.Incident, nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+	"nearby-msg/api/internal/infrastructure/database"
+	"nearby-msg/api/internal/utils"
+)
+
+// ErrMessageNotInGroup is returned when a group is marked read up to a message from another group
+var ErrMessageNotInGroup = errors.New("message is not in the group")
+
+// ReadMarkerService handles read markers and unread counts
+type ReadMarkerService struct {
+	markerRepo   *database.ReadMarkerRepository
+	messageRepo  *database.MessageRepository
+	favoriteRepo *database.FavoriteRepository
+	accessPolicy *AccessPolicy
+}
+
+// NewReadMarkerService creates a new read marker service
+func NewReadMarkerService(markerRepo *database.ReadMarkerRepository, messageRepo *database.MessageRepository, favoriteRepo *database.FavoriteRepository, accessPolicy *AccessPolicy) *ReadMarkerService {
+	return &ReadMarkerService{
+		markerRepo:   markerRepo,
+		messageRepo:  messageRepo,
+		favoriteRepo: favoriteRepo,
+		accessPolicy: accessPolicy,
+	}
+}
+
+// MarkRead marks a group read for a device up to and including a message, or up to now if
+// messageID is empty. Markers only move forward; the returned bool reports whether this one did.
+// Reading a group follows the same rules as subscribing to it.
+func (s *ReadMarkerService) MarkRead(ctx context.Context, deviceID, groupID, messageID string) (*domain.ReadMarker, bool, error) {
+	if groupID == "" {
+		return nil, false, fmt.Errorf("group ID is required")
+	}
+
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanSubscribe(ctx, deviceID, groupID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	markerID, err := utils.GenerateID()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to generate read marker ID: %w", err)
+	}
+	marker := &domain.ReadMarker{
+		ID:         markerID,
+		DeviceID:   deviceID,
+		GroupID:    groupID,
+		LastReadAt: time.Now(),
+	}
+	if messageID != "" {
+		message, err := s.messageRepo.GetByID(ctx, messageID)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to get message: %w", err)
+		}
+		if message.GroupID != groupID {
+			return nil, false, ErrMessageNotInGroup
+		}
+		marker.LastReadMessageID = message.ID
+		marker.LastReadAt = message.CreatedAt
+	}
+
+	moved, err := s.markerRepo.Advance(ctx, marker)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to update read marker: %w", err)
+	}
+	return marker, moved, nil
+}
+
+// GetUnreadCounts returns a device's unread and unread SOS message counts in each group it favorited
+func (s *ReadMarkerService) GetUnreadCounts(ctx context.Context, deviceID string) ([]database.UnreadCount, error) {
+	groupIDs, err := s.favoriteRepo.GetActiveGroupIDs(ctx, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get favorites: %w", err)
+	}
+
+	counts, err := s.markerRepo.CountUnread(ctx, deviceID, groupIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unread messages: %w", err)
+	}
+	if counts == nil {
+		counts = []database.UnreadCount{}
+	}
+	return counts, nil
+}
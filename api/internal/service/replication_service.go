@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -9,6 +10,8 @@ import (
 	"nearby-msg/api/internal/infrastructure/database"
 	"nearby-msg/api/internal/infrastructure/logging"
 	"nearby-msg/api/internal/utils"
+
+	"github.com/jackc/pgx/v5"
 )
 
 const (
@@ -20,54 +23,78 @@ const (
 
 // ReplicationService coordinates push/pull synchronization between clients and the server.
 type ReplicationService struct {
-	messageRepo     *database.MessageRepository
-	groupRepo       *database.GroupRepository
-	favoriteRepo    *database.FavoriteRepository
-	pinRepo         *database.PinRepository
-	statusRepo      *database.StatusRepository
-	replicationRepo *database.ReplicationRepository
-	messageService  *MessageService
-	groupService    *GroupService
-	favoriteService *FavoriteService
-	statusService   *StatusService
-	deviceService   *DeviceService
+	pool             *database.Pool
+	tx               pgx.Tx // Set on copies bound to an atomic push transaction
+	messageRepo      *database.MessageRepository
+	groupRepo        *database.GroupRepository
+	favoriteRepo     *database.FavoriteRepository
+	pinRepo          *database.PinRepository
+	reactionRepo     *database.ReactionRepository
+	readMarkerRepo   *database.ReadMarkerRepository
+	attachmentRepo   *database.AttachmentRepository
+	statusRepo       *database.StatusRepository
+	replicationRepo  *database.ReplicationRepository
+	mutationRepo     *database.MutationRepository
+	accessPolicy     *AccessPolicy
+	messageService   *MessageService
+	groupService     *GroupService
+	favoriteService  *FavoriteService
+	statusService    *StatusService
+	deviceService    *DeviceService
 	websocketService *WebSocketService
+	tombstoneHorizon time.Duration // Tombstones older than this are purged; 0 if they are kept forever
 }
 
 // NewReplicationService creates a new replication service.
 func NewReplicationService(
+	pool *database.Pool,
 	messageRepo *database.MessageRepository,
 	groupRepo *database.GroupRepository,
 	favoriteRepo *database.FavoriteRepository,
 	pinRepo *database.PinRepository,
+	reactionRepo *database.ReactionRepository,
+	readMarkerRepo *database.ReadMarkerRepository,
+	attachmentRepo *database.AttachmentRepository,
 	statusRepo *database.StatusRepository,
 	replicationRepo *database.ReplicationRepository,
+	mutationRepo *database.MutationRepository,
+	accessPolicy *AccessPolicy,
 	messageService *MessageService,
 	groupService *GroupService,
 	favoriteService *FavoriteService,
 	statusService *StatusService,
 	deviceService *DeviceService,
 	websocketService *WebSocketService,
+	tombstoneHorizon time.Duration,
 ) *ReplicationService {
 	return &ReplicationService{
-		messageRepo:     messageRepo,
-		groupRepo:       groupRepo,
-		favoriteRepo:    favoriteRepo,
-		pinRepo:         pinRepo,
-		statusRepo:      statusRepo,
-		replicationRepo: replicationRepo,
-		messageService:  messageService,
-		groupService:    groupService,
-		favoriteService: favoriteService,
-		statusService:   statusService,
-		deviceService:   deviceService,
+		pool:             pool,
+		messageRepo:      messageRepo,
+		groupRepo:        groupRepo,
+		favoriteRepo:     favoriteRepo,
+		pinRepo:          pinRepo,
+		reactionRepo:     reactionRepo,
+		readMarkerRepo:   readMarkerRepo,
+		attachmentRepo:   attachmentRepo,
+		statusRepo:       statusRepo,
+		replicationRepo:  replicationRepo,
+		mutationRepo:     mutationRepo,
+		accessPolicy:     accessPolicy,
+		messageService:   messageService,
+		groupService:     groupService,
+		favoriteService:  favoriteService,
+		statusService:    statusService,
+		deviceService:    deviceService,
 		websocketService: websocketService,
+		tombstoneHorizon: tombstoneHorizon,
 	}
 }
 
 // PushMessagesRequest represents mutations sent from the client to the server.
 // Extends existing messages-only format to support all mutation types.
+// With Atomic set, the whole batch runs in one transaction and is rolled back if any mutation is rejected.
 type PushMessagesRequest struct {
+	Atomic    bool               `json:"atomic,omitempty"`    // All-or-nothing batch
 	Messages  []PushMessage      `json:"messages,omitempty"`  // Existing messages format
 	Groups    []GroupMutation    `json:"groups,omitempty"`    // NEW: Group mutations
 	Favorites []FavoriteMutation `json:"favorites,omitempty"` // NEW: Favorite mutations
@@ -77,55 +104,123 @@ type PushMessagesRequest struct {
 
 // GroupMutation represents a group mutation (create or update)
 type GroupMutation struct {
-	ID              string   `json:"id"`                  // Group ID (client-generated for create)
-	MutationType    string   `json:"mutation_type"`       // "create" or "update"
-	Name            string   `json:"name,omitempty"`      // Required for create, optional for update
-	Type            string   `json:"type,omitempty"`      // Required for create
-	Latitude        *float64 `json:"latitude,omitempty"`  // Required for create
-	Longitude       *float64 `json:"longitude,omitempty"` // Required for create
-	RegionCode      *string  `json:"region_code,omitempty"`
-	CreatorDeviceID string   `json:"creator_device_id,omitempty"` // Required for create
+	ClientMutationID string   `json:"client_mutation_id,omitempty"` // Idempotency key, unique per device
+	ID               string   `json:"id"`                           // Group ID (client-generated for create)
+	MutationType     string   `json:"mutation_type"`                // "create" or "update"
+	Name             string   `json:"name,omitempty"`               // Required for create, optional for update
+	Type             string   `json:"type,omitempty"`               // Required for create
+	Latitude         *float64 `json:"latitude,omitempty"`           // Required for create
+	Longitude        *float64 `json:"longitude,omitempty"`          // Required for create
+	RegionCode       *string  `json:"region_code,omitempty"`
+	CreatorDeviceID  string   `json:"creator_device_id,omitempty"` // Required for create
+	// Conflict detection for updates: the revision the client edited and when it made the edit
+	BaseRevision    *int64     `json:"base_revision,omitempty"`
+	ClientUpdatedAt *time.Time `json:"client_updated_at,omitempty"`
 }
 
 // FavoriteMutation represents a favorite mutation (add or remove)
 type FavoriteMutation struct {
-	MutationType string `json:"mutation_type"` // "add" or "remove"
-	GroupID      string `json:"group_id"`      // Group ID to favorite/unfavorite
+	ClientMutationID string `json:"client_mutation_id,omitempty"` // Idempotency key, unique per device
+	MutationType     string `json:"mutation_type"`                // "add" or "remove"
+	GroupID          string `json:"group_id"`                     // Group ID to favorite/unfavorite
 }
 
 // StatusMutation represents a status mutation (update)
 type StatusMutation struct {
-	StatusType  string  `json:"status_type"`           // "safe", "need_help", "cannot_contact"
-	Description *string `json:"description,omitempty"` // Optional description
+	ClientMutationID string  `json:"client_mutation_id,omitempty"` // Idempotency key, unique per device
+	StatusType       string  `json:"status_type"`                  // "safe", "need_help", "cannot_contact"
+	Description      *string `json:"description,omitempty"`        // Optional description
+	// Conflict detection: the revision the client edited and when it made the edit
+	BaseRevision    *int64     `json:"base_revision,omitempty"`
+	ClientUpdatedAt *time.Time `json:"client_updated_at,omitempty"`
 }
 
 // DeviceMutation represents a device mutation (update nickname)
 type DeviceMutation struct {
-	Nickname string `json:"nickname"` // Updated nickname (1-50 characters)
+	ClientMutationID string `json:"client_mutation_id,omitempty"` // Idempotency key, unique per device
+	Nickname         string `json:"nickname"`                     // Updated nickname (1-50 characters)
 }
 
 // PushMessage represents a single message being pushed to the server.
 type PushMessage struct {
-	ID             string             `json:"id"`
-	GroupID        string             `json:"group_id"`
-	Content        string             `json:"content"`
-	MessageType    domain.MessageType `json:"message_type"`
-	SOSType        *domain.SOSType    `json:"sos_type,omitempty"`
-	Tags           []string           `json:"tags,omitempty"`
-	CreatedAt      *time.Time         `json:"created_at,omitempty"`
-	DeviceSequence *int               `json:"device_sequence,omitempty"`
+	ClientMutationID string             `json:"client_mutation_id,omitempty"` // Idempotency key, unique per device
+	ID               string             `json:"id"`
+	GroupID          string             `json:"group_id"`
+	Content          string             `json:"content"`
+	MessageType      domain.MessageType `json:"message_type"`
+	SOSType          *domain.SOSType    `json:"sos_type,omitempty"`
+	Tags             []string           `json:"tags,omitempty"`
+	CreatedAt        *time.Time         `json:"created_at,omitempty"`
+	DeviceSequence   *int               `json:"device_sequence,omitempty"`
+	ReplyToID        *string            `json:"reply_to_id,omitempty"` // Message this one replies to, in the same group
+	AttachmentIDs    []string           `json:"attachment_ids,omitempty"`
+	Latitude         *float64           `json:"latitude,omitempty"`
+	Longitude        *float64           `json:"longitude,omitempty"`
+	Accuracy         *float64           `json:"accuracy,omitempty"`
+}
+
+// Mutation result statuses reported by PushMutations
+const (
+	MutationApplied   = "applied"   // The mutation was applied by this request
+	MutationDuplicate = "duplicate" // The client mutation ID was already applied; nothing was done
+	MutationRejected  = "rejected"  // The mutation was not applied; see Reason
+)
+
+// codeBatchRolledBack marks mutations that succeeded but were undone because another
+// mutation in the same atomic batch was rejected
+const codeBatchRolledBack = "batch_rolled_back"
+
+// codeConflict marks mutations rejected because they were based on a stale revision
+const codeConflict = "conflict"
+
+// codeRateLimited marks mutations rejected because the device is over a rate limit
+const codeRateLimited = "rate_limited"
+
+// errBatchRejected aborts an atomic push transaction when any mutation is rejected
+var errBatchRejected = errors.New("atomic batch rejected")
+
+// maxClientMutationIDLength matches processed_mutations.mutation_id
+const maxClientMutationIDLength = 64
+
+// MutationResult reports the outcome of a single pushed mutation.
+type MutationResult struct {
+	Collection       string `json:"collection"`                   // "groups", "messages", "favorites", "status" or "devices"
+	Index            int    `json:"index"`                        // Position of the mutation in its request array
+	ClientMutationID string `json:"client_mutation_id,omitempty"` // Echoed from the mutation
+	ID               string `json:"id,omitempty"`                 // Server ID of the entity the mutation created or changed
+	Status           string `json:"status"`                       // MutationApplied, MutationDuplicate or MutationRejected
+	Code             string `json:"code,omitempty"`               // Machine-readable rejection reason, when known
+	Reason           string `json:"reason,omitempty"`             // Why the mutation was rejected
+	RetryAfter       int    `json:"retry_after,omitempty"`        // Seconds until a rate-limited mutation may be retried
+}
+
+// PushMutationsResponse reports the outcome of every mutation in a push request,
+// in processing order: groups, messages, favorites, status, devices.
+type PushMutationsResponse struct {
+	Results   []MutationResult   `json:"results"`
+	IDMap     map[string]string  `json:"id_map,omitempty"`    // Client group ID -> server group ID, for created groups whose ID had to change
+	Conflicts []MutationConflict `json:"conflicts,omitempty"` // Mutations based on a stale revision, with the server's document
+}
+
+// MutationConflict is a Conflict raised by a pushed mutation. Collection is the pull
+// collection of the document ("groups" or "user_status").
+type MutationConflict struct {
+	Index int `json:"index"` // Position of the mutation in its request array
+	Conflict
 }
 
 // PullMessagesRequest represents a request for new messages (legacy format).
 type PullMessagesRequest struct {
-	Since *time.Time `json:"since,omitempty"`
-	Limit int        `json:"limit,omitempty"`
+	Since  *time.Time       `json:"since,omitempty"`
+	Cursor *database.Cursor `json:"cursor,omitempty"` // Takes precedence over Since
+	Limit  int              `json:"limit,omitempty"`
 }
 
 // PullMessagesResponse represents the server response for new messages (legacy format).
 type PullMessagesResponse struct {
 	Messages   []*domain.Message `json:"messages"`
 	Checkpoint time.Time         `json:"checkpoint"`
+	Cursor     database.Cursor   `json:"cursor"` // Exact position to resume from; send back as cursor
 }
 
 // Document represents a single synchronized document with its collection type identifier.
@@ -136,14 +231,17 @@ type Document struct {
 
 // PullDocumentsRequest represents a request to synchronize multiple collections.
 type PullDocumentsRequest struct {
-	Checkpoint  map[string]time.Time `json:"checkpoint,omitempty"` // Per-collection checkpoints: collection -> timestamp
-	Collections []string             `json:"collections"`          // List of collections to sync
-	GroupIDs    []string             `json:"group_ids,omitempty"`  // Filter messages by group IDs (messages collection only)
-	Limit       int                  `json:"limit,omitempty"`      // Max documents per collection
+	Checkpoint  map[string]database.Cursor `json:"checkpoint,omitempty"` // Per-collection checkpoints: collection -> cursor (legacy timestamps accepted)
+	Collections []string                   `json:"collections"`          // List of collections to sync
+	GroupIDs    []string                   `json:"group_ids,omitempty"`  // Filter messages by group IDs (messages collection only); always limited to the device's own groups
+	Limit       int                        `json:"limit,omitempty"`      // Max documents per collection
 	// Location filter for groups collection (optional)
 	Latitude  *float64 `json:"latitude,omitempty"`  // Location latitude for nearby groups filter
 	Longitude *float64 `json:"longitude,omitempty"` // Location longitude for nearby groups filter
 	Radius    *float64 `json:"radius,omitempty"`    // Radius in meters for nearby groups filter
+	// Per-collection deletion cursors from deletion_checkpoints; collections without one continue
+	// from the cursor last returned to the device
+	DeletionCheckpoint map[string]database.Cursor `json:"deletion_checkpoint,omitempty"`
 }
 
 // Deletion represents a deletion signal for a specific entity
@@ -154,148 +252,240 @@ type Deletion struct {
 }
 
 // PullDocumentsResponse represents the server response for multi-collection synchronization.
-// Checkpoints field provides per-collection checkpoint timestamps, allowing each collection
+// Checkpoints field provides per-collection checkpoint cursors, allowing each collection
 // to maintain its own independent checkpoint for accurate incremental synchronization.
 type PullDocumentsResponse struct {
-	Documents   []Document           `json:"documents"`             // Unified array of synchronized documents
-	Deletions   []Deletion           `json:"deletions,omitempty"`   // Deletion signals (NEW)
-	Checkpoint  time.Time            `json:"checkpoint"`            // Latest checkpoint across all documents (legacy, for backward compatibility)
-	Checkpoints map[string]time.Time `json:"checkpoints,omitempty"` // Per-collection checkpoints: collection -> timestamp (each collection's checkpoint updated independently)
-	HasMore     bool                 `json:"has_more"`              // Indicates whether additional data is available
+	Documents   []Document                 `json:"documents"`             // Unified array of synchronized documents
+	Deletions   []Deletion                 `json:"deletions,omitempty"`   // Deletion signals (NEW)
+	Checkpoint  time.Time                  `json:"checkpoint"`            // Latest checkpoint across all documents (legacy, for backward compatibility)
+	Checkpoints map[string]database.Cursor `json:"checkpoints,omitempty"` // Per-collection checkpoints: collection -> opaque cursor (each collection's checkpoint updated independently)
+	HasMore     bool                       `json:"has_more"`              // Indicates whether additional data is available
+	// Collections the device must resync from scratch: it hasn't pulled them since before the
+	// tombstone horizon, so it may have missed deletions. The client should discard its local
+	// copy of each; this response already restarts them from the beginning.
+	Resync []string `json:"resync,omitempty"`
+	// Per-collection cursors over deletions, which page separately from documents: collection ->
+	// opaque cursor to send back as deletion_checkpoint
+	DeletionCheckpoints map[string]database.Cursor `json:"deletion_checkpoints,omitempty"`
 }
 
 // PushMessages stores incoming messages for the given device.
-func (s *ReplicationService) PushMessages(ctx context.Context, deviceID string, req PushMessagesRequest) error {
+// Each message is applied on its own; the outcome of every message is reported in order,
+// along with the stored messages, which the caller broadcasts once they are committed.
+// processed holds the device's already-applied client mutation IDs and is updated in place.
+func (s *ReplicationService) PushMessages(ctx context.Context, deviceID string, req PushMessagesRequest, processed map[string]string) ([]MutationResult, []*domain.Message) {
+	results := make([]MutationResult, 0, len(req.Messages))
 	if len(req.Messages) == 0 {
-		return nil
+		return results, nil
 	}
 
 	now := time.Now().UTC()
-	var domainMessages []*domain.Message
+	var stored []*domain.Message
 	groupsTouched := map[string]struct{}{}
-
-	for _, incoming := range req.Messages {
-		// Check SOS cooldown if this is an SOS message
-		if incoming.MessageType == domain.MessageTypeSOS {
-			if s.messageService != nil {
-				if err := s.messageService.CheckSOSCooldown(ctx, deviceID); err != nil {
-					return fmt.Errorf("SOS cooldown check failed: %w", err)
+	groupAccess := map[string]error{} // Access policy decision per group, checked once per batch
+
+	for i, incoming := range req.Messages {
+		var inserted *domain.Message
+		result := s.applyMutation(ctx, deviceID, "messages", i, incoming.ClientMutationID, processed, func(s *ReplicationService) (string, error) {
+			// Check the device may post in the group
+			if s.accessPolicy != nil {
+				accessErr, checked := groupAccess[incoming.GroupID]
+				if !checked {
+					accessErr = s.accessPolicy.CanPost(ctx, deviceID, incoming.GroupID)
+					groupAccess[incoming.GroupID] = accessErr
+				}
+				if accessErr != nil {
+					return "", accessErr
 				}
 			}
-		}
 
-		messageID := incoming.ID
-		if messageID == "" {
-			id, err := utils.GenerateID()
-			if err != nil {
-				return fmt.Errorf("failed to generate message ID: %w", err)
+			messageID := incoming.ID
+			if messageID == "" {
+				id, err := utils.GenerateID()
+				if err != nil {
+					return "", fmt.Errorf("failed to generate message ID: %w", err)
+				}
+				messageID = id
 			}
-			messageID = id
-		}
 
-		createdAt := now
-		if incoming.CreatedAt != nil {
-			createdAt = incoming.CreatedAt.UTC()
-		}
-
-		message := &domain.Message{
-			ID:             messageID,
-			GroupID:        incoming.GroupID,
-			DeviceID:       deviceID,
-			Content:        incoming.Content,
-			MessageType:    incoming.MessageType,
-			SOSType:        incoming.SOSType,
-			Tags:           incoming.Tags,
-			Pinned:         false,
-			CreatedAt:      createdAt,
-			DeviceSequence: incoming.DeviceSequence,
-			SyncedAt:       &now,
-		}
+			createdAt := now
+			if incoming.CreatedAt != nil {
+				createdAt = incoming.CreatedAt.UTC()
+			}
 
-		if err := message.Validate(); err != nil {
-			return fmt.Errorf("message validation failed: %w", err)
-		}
+			message := &domain.Message{
+				ID:             messageID,
+				GroupID:        incoming.GroupID,
+				DeviceID:       deviceID,
+				Content:        incoming.Content,
+				MessageType:    incoming.MessageType,
+				SOSType:        incoming.SOSType,
+				Tags:           incoming.Tags,
+				Pinned:         false,
+				CreatedAt:      createdAt,
+				DeviceSequence: incoming.DeviceSequence,
+				SyncedAt:       &now,
+				ReplyToID:      incoming.ReplyToID,
+				AttachmentIDs:  incoming.AttachmentIDs,
+				Latitude:       incoming.Latitude,
+				Longitude:      incoming.Longitude,
+				Accuracy:       incoming.Accuracy,
+			}
 
-		// Record SOS message if applicable
-		if incoming.MessageType == domain.MessageTypeSOS {
+			if err := message.Validate(); err != nil {
+				return "", fmt.Errorf("message validation failed: %w", err)
+			}
+			if err := attachReplyQuote(ctx, s.messageRepo, message); err != nil {
+				return "", err
+			}
 			if s.messageService != nil {
-				s.messageService.RecordSOSMessage(ctx, deviceID)
+				if err := s.messageService.CheckRateLimit(ctx, deviceID, message.MessageType); err != nil {
+					return "", err
+				}
 			}
-		}
 
-		domainMessages = append(domainMessages, message)
-		groupsTouched[message.GroupID] = struct{}{}
-	}
+			if err := s.messageRepo.InsertMessages(ctx, []*domain.Message{message}); err != nil {
+				return "", fmt.Errorf("failed to insert message: %w", err)
+			}
 
-	if err := s.messageRepo.InsertMessages(ctx, domainMessages); err != nil {
-		return fmt.Errorf("failed to insert messages: %w", err)
+			inserted = message
+			return message.ID, nil
+		})
+		// Only messages whose transaction committed are announced
+		if result.Status == MutationApplied && inserted != nil {
+			stored = append(stored, inserted)
+			groupsTouched[inserted.GroupID] = struct{}{}
+		}
+		results = append(results, result)
 	}
 
-	// Enforce retention per group.
+	// Enforce retention per group. The messages are already stored, so failures are only logged.
 	for groupID := range groupsTouched {
+		var err error
 		if s.messageService != nil {
-			if err := s.messageService.EnforceRetention(ctx, groupID, maxMessagesPerGroup); err != nil {
-				return fmt.Errorf("failed to enforce retention for group %s: %w", groupID, err)
-			}
+			err = s.messageService.EnforceRetention(ctx, groupID, maxMessagesPerGroup)
 		} else {
-			if err := s.messageRepo.TrimOldMessages(ctx, groupID, maxMessagesPerGroup); err != nil {
-				return fmt.Errorf("failed to enforce retention for group %s: %w", groupID, err)
-			}
+			err = s.messageRepo.TrimOldMessages(ctx, groupID, maxMessagesPerGroup)
+		}
+		if err != nil {
+			logger := logging.GetLogger()
+			logger.Warn("Failed to enforce message retention", "groupID", groupID, "error", err)
 		}
 	}
 
-	// After storing messages and enforcing retention, broadcast them via WebSocket
-	// so online clients receive real-time updates even when messages arrive via replication push.
+	return results, stored
+}
+
+// broadcastMessages sends pushed messages to online clients via WebSocket,
+// so they receive real-time updates even when messages arrive via replication push.
+func (s *ReplicationService) broadcastMessages(messages []*domain.Message) {
+	if s.websocketService == nil {
+		return
+	}
+	for _, msg := range messages {
+		s.websocketService.BroadcastToGroup(msg.GroupID, NewMessageFrame(msg))
+	}
+}
+
+// notifyChanges wakes replication streams on this node; group, favorite, status and device
+// mutations aren't broadcast as group events, so streams wouldn't otherwise see them until they poll
+func (s *ReplicationService) notifyChanges() {
 	if s.websocketService != nil {
-		for _, msg := range domainMessages {
-			wsMsg := WebSocketMessage{
-				Type: "new_message",
-				Payload: map[string]interface{}{
-					"id":             msg.ID,
-					"groupId":        msg.GroupID,
-					"deviceId":       msg.DeviceID,
-					"content":        msg.Content,
-					"messageType":    string(msg.MessageType),
-					"sosType":        msg.SOSType,
-					"tags":           msg.Tags,
-					"pinned":         msg.Pinned,
-					"createdAt":      msg.CreatedAt.Format(time.RFC3339),
-					"deviceSequence": msg.DeviceSequence,
-				},
-				Timestamp: now.Format(time.RFC3339),
+		s.websocketService.Changes().Notify()
+	}
+}
+
+// Note: CreateGroupRequest, UpdateGroupRequest, and UpdateStatusRequest are defined in group_service.go and status_service.go
+// They're in the same package, so we can use them directly
+
+// PushMutations handles all mutation types (groups, favorites, status, devices) from client.
+// A failing mutation does not stop the rest of the batch: every mutation gets a result, and
+// mutations whose client mutation ID was already applied are skipped as duplicates, so the
+// whole batch can be retried safely. The error is only non-nil if the batch couldn't be processed at all.
+//
+// In atomic mode every mutation runs in one transaction; if any is rejected, nothing is
+// committed and the mutations that had succeeded are reported as rejected (batch_rolled_back).
+func (s *ReplicationService) PushMutations(ctx context.Context, deviceID string, req PushMessagesRequest) (*PushMutationsResponse, error) {
+	if !req.Atomic {
+		resp, stored, err := s.pushMutations(ctx, deviceID, req)
+		if err != nil {
+			return nil, err
+		}
+		s.broadcastMessages(stored)
+		s.notifyChanges()
+		return resp, nil
+	}
+
+	var resp *PushMutationsResponse
+	var stored []*domain.Message
+	err := s.pool.WithTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		resp, stored, err = s.withTx(tx).pushMutations(ctx, deviceID, req)
+		if err != nil {
+			return err
+		}
+		for _, result := range resp.Results {
+			if result.Status == MutationRejected {
+				return errBatchRejected
 			}
-			s.websocketService.BroadcastToGroup(msg.GroupID, wsMsg)
 		}
+		return nil
+	})
+	if errors.Is(err, errBatchRejected) {
+		for i := range resp.Results {
+			if resp.Results[i].Status == MutationApplied {
+				resp.Results[i].Status = MutationRejected
+				resp.Results[i].Code = codeBatchRolledBack
+				resp.Results[i].Reason = "not applied: another mutation in the atomic batch was rejected"
+			}
+		}
+		return resp, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	// Only announce messages once they are committed
+	s.broadcastMessages(stored)
+	s.notifyChanges()
+	return resp, nil
 }
 
-// Note: CreateGroupRequest, UpdateGroupRequest, and UpdateStatusRequest are defined in group_service.go and status_service.go
-// They're in the same package, so we can use them directly
+// pushMutations applies every mutation in the request and returns the per-item results
+// and the messages it stored
+func (s *ReplicationService) pushMutations(ctx context.Context, deviceID string, req PushMessagesRequest) (*PushMutationsResponse, []*domain.Message, error) {
+	processed, err := s.mutationRepo.GetProcessed(ctx, deviceID, clientMutationIDs(req))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get processed mutations: %w", err)
+	}
+
+	results := make([]MutationResult, 0)
+	idMap := make(map[string]string) // Client group ID -> server group ID, where they differ
+	var conflicts []MutationConflict
 
-// PushMutations handles all mutation types (groups, favorites, status, devices) from client
-func (s *ReplicationService) PushMutations(ctx context.Context, deviceID string, req PushMessagesRequest) error {
 	// Process group mutations FIRST
 	// This ensures groups exist on server before messages reference them
 	// Prevents foreign key constraint errors: "messages_group_id_fkey"
-	if len(req.Groups) > 0 {
-		for _, groupMut := range req.Groups {
-			if groupMut.MutationType == "create" {
+	for i, groupMut := range req.Groups {
+		groupID := remapID(idMap, groupMut.ID)
+		result := s.applyMutation(ctx, deviceID, "groups", i, groupMut.ClientMutationID, processed, func(s *ReplicationService) (string, error) {
+			switch groupMut.MutationType {
+			case "create":
 				// Create group
 				if groupMut.Latitude == nil || groupMut.Longitude == nil {
-					return fmt.Errorf("latitude and longitude are required for group creation")
+					return "", fmt.Errorf("latitude and longitude are required for group creation")
 				}
 				if groupMut.Name == "" {
-					return fmt.Errorf("name is required for group creation")
+					return "", fmt.Errorf("name is required for group creation")
 				}
 				if groupMut.Type == "" {
-					return fmt.Errorf("type is required for group creation")
+					return "", fmt.Errorf("type is required for group creation")
 				}
 				if groupMut.CreatorDeviceID == "" {
-					return fmt.Errorf("creator_device_id is required for group creation")
+					return "", fmt.Errorf("creator_device_id is required for group creation")
 				}
 				createReq := CreateGroupRequest{
+					ID:              groupMut.ID, // Kept if valid and unused, otherwise replaced and reported in id_map
 					Name:            groupMut.Name,
 					Type:            domain.GroupType(groupMut.Type),
 					Latitude:        *groupMut.Latitude,
@@ -303,71 +493,288 @@ func (s *ReplicationService) PushMutations(ctx context.Context, deviceID string,
 					RegionCode:      groupMut.RegionCode,
 					CreatorDeviceID: groupMut.CreatorDeviceID, // string from mutation, will be converted to *string in CreateGroup
 				}
-				// Note: Server will generate its own ID, ignoring client-provided ID
-				// Client's optimistic ID will be replaced during sync
-				if _, err := s.groupService.CreateGroup(ctx, createReq); err != nil {
-					return fmt.Errorf("failed to create group %s: %w", groupMut.ID, err)
+				group, err := s.groupService.CreateGroup(ctx, createReq)
+				if err != nil {
+					return "", fmt.Errorf("failed to create group %s: %w", groupMut.ID, err)
 				}
-			} else if groupMut.MutationType == "update" {
+				return group.ID, nil
+			case "update":
 				// Update group name
 				if groupMut.Name != "" {
 					updateReq := UpdateGroupRequest{
-						Name: groupMut.Name,
+						Name:            groupMut.Name,
+						BaseRevision:    groupMut.BaseRevision,
+						ClientUpdatedAt: groupMut.ClientUpdatedAt,
+					}
+					_, conflict, err := s.groupService.UpdateGroup(ctx, groupID, deviceID, updateReq)
+					if err != nil {
+						return "", fmt.Errorf("failed to update group %s: %w", groupID, err)
 					}
-					if _, err := s.groupService.UpdateGroup(ctx, groupMut.ID, deviceID, updateReq); err != nil {
-						return fmt.Errorf("failed to update group %s: %w", groupMut.ID, err)
+					if conflict != nil {
+						conflicts = append(conflicts, MutationConflict{Index: i, Conflict: *conflict})
+						return "", conflict
 					}
 				}
+				return groupID, nil
+			default:
+				return "", fmt.Errorf("invalid mutation_type: %s", groupMut.MutationType)
 			}
+		})
+		// Created groups (including ones created by an earlier attempt of this batch) may have a new ID
+		if groupMut.MutationType == "create" && groupMut.ID != "" && result.ID != "" && result.ID != groupMut.ID {
+			idMap[groupMut.ID] = result.ID
 		}
+		results = append(results, result)
 	}
 
-	// Process messages AFTER groups are created
-	// This ensures all referenced groups exist on server
-	if len(req.Messages) > 0 {
-		if err := s.PushMessages(ctx, deviceID, req); err != nil {
-			return fmt.Errorf("failed to push messages: %w", err)
+	// Rewrite references to remapped groups in the rest of the batch
+	if len(idMap) > 0 {
+		req.Messages = append([]PushMessage(nil), req.Messages...)
+		for i := range req.Messages {
+			req.Messages[i].GroupID = remapID(idMap, req.Messages[i].GroupID)
+		}
+		req.Favorites = append([]FavoriteMutation(nil), req.Favorites...)
+		for i := range req.Favorites {
+			req.Favorites[i].GroupID = remapID(idMap, req.Favorites[i].GroupID)
 		}
 	}
 
+	// Process messages AFTER groups are created
+	// This ensures all referenced groups exist on server
+	messageResults, stored := s.PushMessages(ctx, deviceID, req, processed)
+	results = append(results, messageResults...)
+
 	// Process favorite mutations
-	if len(req.Favorites) > 0 {
-		for _, favMut := range req.Favorites {
-			if favMut.MutationType == "add" {
-				if _, err := s.favoriteService.AddFavorite(ctx, deviceID, favMut.GroupID); err != nil {
-					return fmt.Errorf("failed to add favorite for group %s: %w", favMut.GroupID, err)
+	for i, favMut := range req.Favorites {
+		results = append(results, s.applyMutation(ctx, deviceID, "favorites", i, favMut.ClientMutationID, processed, func(s *ReplicationService) (string, error) {
+			switch favMut.MutationType {
+			case "add":
+				favorite, err := s.favoriteService.AddFavorite(ctx, deviceID, favMut.GroupID)
+				if err != nil {
+					return "", fmt.Errorf("failed to add favorite for group %s: %w", favMut.GroupID, err)
 				}
-			} else if favMut.MutationType == "remove" {
+				return favorite.ID, nil
+			case "remove":
 				if err := s.favoriteService.RemoveFavorite(ctx, deviceID, favMut.GroupID); err != nil {
-					return fmt.Errorf("failed to remove favorite for group %s: %w", favMut.GroupID, err)
+					return "", fmt.Errorf("failed to remove favorite for group %s: %w", favMut.GroupID, err)
 				}
+				return "", nil
+			default:
+				return "", fmt.Errorf("invalid mutation_type: %s", favMut.MutationType)
 			}
-		}
+		}))
 	}
 
 	// Process status mutations
-	if len(req.Status) > 0 {
-		for _, statusMut := range req.Status {
+	for i, statusMut := range req.Status {
+		results = append(results, s.applyMutation(ctx, deviceID, "status", i, statusMut.ClientMutationID, processed, func(s *ReplicationService) (string, error) {
 			updateReq := UpdateStatusRequest{
-				StatusType:  domain.StatusType(statusMut.StatusType),
-				Description: statusMut.Description,
+				StatusType:      domain.StatusType(statusMut.StatusType),
+				Description:     statusMut.Description,
+				BaseRevision:    statusMut.BaseRevision,
+				ClientUpdatedAt: statusMut.ClientUpdatedAt,
 			}
-			if _, err := s.statusService.UpdateStatus(ctx, deviceID, updateReq); err != nil {
-				return fmt.Errorf("failed to update status: %w", err)
+			status, conflict, err := s.statusService.UpdateStatus(ctx, deviceID, updateReq)
+			if err != nil {
+				return "", fmt.Errorf("failed to update status: %w", err)
 			}
-		}
+			if conflict != nil {
+				conflicts = append(conflicts, MutationConflict{Index: i, Conflict: *conflict})
+				if conflict.Resolution == ConflictResolutionRejected {
+					return "", conflict
+				}
+			}
+			return status.ID, nil
+		}))
 	}
 
 	// Process device mutations
-	if len(req.Devices) > 0 {
-		for _, deviceMut := range req.Devices {
+	for i, deviceMut := range req.Devices {
+		results = append(results, s.applyMutation(ctx, deviceID, "devices", i, deviceMut.ClientMutationID, processed, func(s *ReplicationService) (string, error) {
 			if err := s.deviceService.UpdateNickname(ctx, deviceID, deviceMut.Nickname); err != nil {
-				return fmt.Errorf("failed to update device nickname: %w", err)
+				return "", fmt.Errorf("failed to update device nickname: %w", err)
+			}
+			return deviceID, nil
+		}))
+	}
+
+	resp := &PushMutationsResponse{Results: results, Conflicts: conflicts}
+	if len(idMap) > 0 {
+		resp.IDMap = idMap
+	}
+	return resp, stored, nil
+}
+
+// remapID returns the server ID for a client ID that was replaced earlier in the batch
+func remapID(idMap map[string]string, id string) string {
+	if mapped, ok := idMap[id]; ok {
+		return mapped
+	}
+	return id
+}
+
+// withTx returns a copy of the service whose repositories, services and access policy all
+// run on tx. WebSocket broadcasting is left to the caller, after the transaction commits.
+func (s *ReplicationService) withTx(tx pgx.Tx) *ReplicationService {
+	txService := *s
+	txService.tx = tx
+	txService.messageRepo = s.messageRepo.WithQuerier(tx)
+	txService.groupRepo = s.groupRepo.WithQuerier(tx)
+	txService.favoriteRepo = s.favoriteRepo.WithQuerier(tx)
+	txService.pinRepo = s.pinRepo.WithQuerier(tx)
+	txService.reactionRepo = s.reactionRepo.WithQuerier(tx)
+	txService.readMarkerRepo = s.readMarkerRepo.WithQuerier(tx)
+	txService.attachmentRepo = s.attachmentRepo.WithQuerier(tx)
+	txService.statusRepo = s.statusRepo.WithQuerier(tx)
+	txService.replicationRepo = s.replicationRepo.WithQuerier(tx)
+	txService.mutationRepo = s.mutationRepo.WithQuerier(tx)
+	if s.accessPolicy != nil {
+		txService.accessPolicy = s.accessPolicy.WithQuerier(tx)
+	}
+	if s.messageService != nil {
+		txService.messageService = s.messageService.WithQuerier(tx)
+	}
+	txService.groupService = s.groupService.WithQuerier(tx)
+	txService.favoriteService = s.favoriteService.WithQuerier(tx)
+	txService.statusService = s.statusService.WithQuerier(tx)
+	txService.deviceService = s.deviceService.WithQuerier(tx)
+	return &txService
+}
+
+// applyMutation applies a single mutation unless its client mutation ID has already been
+// processed for the device, and reports the outcome. apply runs on the service it is given,
+// which is bound to the mutation's transaction.
+func (s *ReplicationService) applyMutation(
+	ctx context.Context,
+	deviceID string,
+	collection string,
+	index int,
+	mutationID string,
+	processed map[string]string,
+	apply func(s *ReplicationService) (string, error),
+) MutationResult {
+	result := MutationResult{
+		Collection:       collection,
+		Index:            index,
+		ClientMutationID: mutationID,
+	}
+
+	if len(mutationID) > maxClientMutationIDLength {
+		result.Status = MutationRejected
+		result.Reason = fmt.Sprintf("client_mutation_id must be at most %d characters", maxClientMutationIDLength)
+		return result
+	}
+	if resultID, ok := processed[mutationID]; mutationID != "" && ok {
+		result.Status = MutationDuplicate
+		result.ID = resultID
+		return result
+	}
+
+	resultID, claimed, err := s.runMutation(ctx, deviceID, collection, mutationID, apply)
+	if err != nil {
+		result.Status = MutationRejected
+		result.Reason = err.Error()
+		if accessErr, ok := AsAccessError(err); ok {
+			result.Code = string(accessErr.Code)
+		}
+		var conflict *Conflict
+		if errors.As(err, &conflict) {
+			result.Code = codeConflict
+		}
+		if rateErr, ok := AsRateLimitError(err); ok {
+			result.Code = codeRateLimited
+			result.RetryAfter = rateErr.RetryAfterSeconds()
+		}
+		return result
+	}
+	if mutationID != "" {
+		processed[mutationID] = resultID
+	}
+
+	result.Status = MutationApplied
+	if !claimed {
+		result.Status = MutationDuplicate
+	}
+	result.ID = resultID
+	return result
+}
+
+// runMutation runs apply. A mutation with a client mutation ID runs in its own transaction,
+// which claims the ID before applying it and records the result, so the claim, the mutation
+// and its result commit together or not at all; concurrent retries of the same mutation wait
+// on the claim and only one applies. Inside an atomic push the transaction is a savepoint, so
+// a failed statement doesn't abort the push and the remaining mutations can still be checked
+// and reported. Returns false if the ID was already claimed, with the result recorded for it.
+func (s *ReplicationService) runMutation(ctx context.Context, deviceID, collection, mutationID string, apply func(s *ReplicationService) (string, error)) (string, bool, error) {
+	if s.tx == nil && mutationID == "" {
+		resultID, err := apply(s)
+		return resultID, true, err
+	}
+
+	var q database.Querier = s.pool
+	if s.tx != nil {
+		q = s.tx
+	}
+	tx, err := q.Begin(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to begin mutation: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	txService := s.withTx(tx)
+
+	if mutationID != "" {
+		claimed, err := txService.mutationRepo.Claim(ctx, deviceID, mutationID, collection)
+		if err != nil {
+			return "", false, fmt.Errorf("failed to claim client mutation ID: %w", err)
+		}
+		if !claimed {
+			processed, err := txService.mutationRepo.GetProcessed(ctx, deviceID, []string{mutationID})
+			if err != nil {
+				return "", false, fmt.Errorf("failed to get processed mutation: %w", err)
 			}
+			return processed[mutationID], false, nil
+		}
+	}
+
+	resultID, err := apply(txService)
+	if err != nil {
+		return "", false, err
+	}
+	if mutationID != "" {
+		if err := txService.mutationRepo.SetResult(ctx, deviceID, mutationID, resultID); err != nil {
+			return "", false, fmt.Errorf("failed to record client mutation ID: %w", err)
 		}
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", false, fmt.Errorf("failed to commit mutation: %w", err)
+	}
+	return resultID, true, nil
+}
 
-	return nil
+// clientMutationIDs collects the non-empty client mutation IDs in a push request
+func clientMutationIDs(req PushMessagesRequest) []string {
+	var ids []string
+	add := func(id string) {
+		if id != "" && len(id) <= maxClientMutationIDLength {
+			ids = append(ids, id)
+		}
+	}
+	for _, m := range req.Groups {
+		add(m.ClientMutationID)
+	}
+	for _, m := range req.Messages {
+		add(m.ClientMutationID)
+	}
+	for _, m := range req.Favorites {
+		add(m.ClientMutationID)
+	}
+	for _, m := range req.Status {
+		add(m.ClientMutationID)
+	}
+	for _, m := range req.Devices {
+		add(m.ClientMutationID)
+	}
+	return ids
 }
 
 // getCheckpointForCollection retrieves checkpoint for a collection with fallback to default.
@@ -377,8 +784,8 @@ func (s *ReplicationService) getCheckpointForCollection(
 	ctx context.Context,
 	deviceID string,
 	collection string,
-	defaultSince time.Time,
-) time.Time {
+	defaultSince database.Cursor,
+) database.Cursor {
 	checkpoint, err := s.replicationRepo.GetCheckpoint(ctx, deviceID, collection)
 	if err != nil {
 		// No checkpoint exists, return default
@@ -387,6 +794,62 @@ func (s *ReplicationService) getCheckpointForCollection(
 	return checkpoint
 }
 
+// deletionCheckpointCollection is the name a collection's deletion cursor is stored under
+func deletionCheckpointCollection(collection string) string {
+	return collection + ":deletions"
+}
+
+// deletionCheckpointFor returns where to continue a collection's deletions from: the cursor the
+// client sent, else the one last returned to the device, else the collection's document checkpoint
+// (for clients that predate deletion cursors)
+func (s *ReplicationService) deletionCheckpointFor(ctx context.Context, deviceID, collection string, sent map[string]database.Cursor, since database.Cursor) database.Cursor {
+	if cursor, ok := sent[collection]; ok {
+		return cursor
+	}
+	return s.getCheckpointForCollection(ctx, deviceID, deletionCheckpointCollection(collection), database.Cursor{Time: since.Time})
+}
+
+// needsResync reports whether a device last pulled a collection before the tombstone horizon,
+// so deletions it never received may already have been purged. Devices that never pulled the
+// collection have nothing to reconcile.
+func (s *ReplicationService) needsResync(ctx context.Context, deviceID string, collection string) bool {
+	if s.tombstoneHorizon <= 0 {
+		return false
+	}
+	syncedAt, err := s.replicationRepo.GetSyncedAt(ctx, deviceID, collection)
+	if err != nil {
+		logger := logging.GetLogger()
+		logger.Warn("Failed to get last sync time", "collection", collection, "deviceID", deviceID, "error", err)
+		return false
+	}
+	return syncedAt != nil && syncedAt.Before(time.Now().Add(-s.tombstoneHorizon))
+}
+
+// messageGroupScope returns the groups whose messages a device may pull: the groups it has
+// favorited, created or posted in, narrowed to the requested group IDs when any are given.
+func (s *ReplicationService) messageGroupScope(ctx context.Context, deviceID string, requested []string) ([]string, error) {
+	relevant, err := s.groupRepo.GetRelevantGroupIDs(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if len(requested) == 0 {
+		return relevant, nil
+	}
+
+	relevantSet := make(map[string]bool, len(relevant))
+	for _, groupID := range relevant {
+		relevantSet[groupID] = true
+	}
+	scoped := make([]string, 0, len(requested))
+	for _, groupID := range requested {
+		if relevantSet[groupID] {
+			scoped = append(scoped, groupID)
+			delete(relevantSet, groupID) // Drop duplicates in the request
+		}
+	}
+	return scoped, nil
+}
+
 // normalizeLimit validates and normalizes limit value to be between 1 and maxPullLimit.
 // This helper function eliminates duplication in limit validation logic across replication endpoints.
 // Returns defaultPullLimit if limit <= 0, maxPullLimit if limit > maxPullLimit, otherwise returns limit.
@@ -481,12 +944,14 @@ func processCollectionResult(
 func (s *ReplicationService) PullMessages(ctx context.Context, deviceID string, req PullMessagesRequest) (*PullMessagesResponse, error) {
 	limit := normalizeLimit(req.Limit)
 
-	var since time.Time
-	if req.Since != nil {
-		since = req.Since.UTC()
+	var since database.Cursor
+	if req.Cursor != nil {
+		since = *req.Cursor
+	} else if req.Since != nil {
+		since = database.NewCursor(*req.Since, "")
 	} else {
 		// Use helper function for checkpoint retrieval
-		defaultSince := time.Now().UTC().Add(defaultCheckpointDelta)
+		defaultSince := database.NewCursor(time.Now().UTC().Add(defaultCheckpointDelta), "")
 		checkpoint, err := s.messageRepo.GetCheckpoint(ctx, deviceID)
 		if err != nil {
 			since = defaultSince
@@ -495,14 +960,20 @@ func (s *ReplicationService) PullMessages(ctx context.Context, deviceID string,
 		}
 	}
 
-	messages, err := s.messageRepo.GetMessagesAfter(ctx, since, limit)
+	groupIDs, err := s.messageGroupScope(ctx, deviceID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve message groups: %w", err)
+	}
+
+	messages, err := s.messageRepo.GetMessagesAfter(ctx, groupIDs, since, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages after checkpoint: %w", err)
 	}
 
-	var newCheckpoint time.Time = since
+	newCheckpoint := since
 	if len(messages) > 0 {
-		newCheckpoint = messages[len(messages)-1].CreatedAt
+		last := messages[len(messages)-1]
+		newCheckpoint = database.NewCursor(last.ChangedAt(), last.ID)
 		if err := s.messageRepo.UpsertCheckpoint(ctx, deviceID, newCheckpoint); err != nil {
 			return nil, fmt.Errorf("failed to upsert checkpoint: %w", err)
 		}
@@ -510,7 +981,8 @@ func (s *ReplicationService) PullMessages(ctx context.Context, deviceID string,
 
 	return &PullMessagesResponse{
 		Messages:   messages,
-		Checkpoint: newCheckpoint,
+		Checkpoint: newCheckpoint.Time,
+		Cursor:     newCheckpoint,
 	}, nil
 }
 
@@ -522,6 +994,9 @@ var ValidCollections = map[string]bool{
 	"favorite_groups": true,
 	"pinned_messages": true,
 	"user_status":     true,
+	"reactions":       true,
+	"read_markers":    true,
+	"attachments":     true,
 }
 
 // PullDocuments returns documents from multiple collections newer than client's checkpoints.
@@ -540,21 +1015,36 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 	limit := normalizeLimit(req.Limit)
 
 	// Default checkpoint delta
-	defaultSince := time.Now().UTC().Add(defaultCheckpointDelta)
+	defaultSince := database.NewCursor(time.Now().UTC().Add(defaultCheckpointDelta), "")
 
 	var allDocuments []Document
 	var allDeletions []Deletion
 	var latestCheckpoint time.Time = time.Time{}
-	checkpoints := make(map[string]time.Time) // Per-collection checkpoints
+	checkpoints := make(map[string]database.Cursor) // Per-collection checkpoints
+	deletionCheckpoints := make(map[string]database.Cursor)
 	hasMore := false
+	var resync []string
+
+	// Messages, reactions and attachments (and their deletions) are only pulled from the device's own groups
+	var messageGroupIDs []string
+	for _, collection := range req.Collections {
+		if collection == "messages" || collection == "reactions" || collection == "attachments" {
+			scope, err := s.messageGroupScope(ctx, deviceID, req.GroupIDs)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve message groups: %w", err)
+			}
+			messageGroupIDs = scope
+			break
+		}
+	}
 
 	// Process each collection
 	for _, collection := range req.Collections {
 		// Get checkpoint for this collection
-		var since time.Time
+		var since database.Cursor
 		if req.Checkpoint != nil {
 			if checkpoint, ok := req.Checkpoint[collection]; ok {
-				since = checkpoint.UTC()
+				since = checkpoint
 			} else {
 				since = defaultSince
 			}
@@ -563,15 +1053,21 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 			since = s.getCheckpointForCollection(ctx, deviceID, collection, defaultSince)
 		}
 
+		// A device that missed purged tombstones can't catch up incrementally
+		resyncCollection := s.needsResync(ctx, deviceID, collection)
+		if resyncCollection {
+			since = database.Cursor{}
+			resync = append(resync, collection)
+		}
+
 		// Query documents for this collection
 		var collectionDocs []interface{}
-		var collectionCheckpoint time.Time = since
+		collectionCheckpoint := since
 		var collectionHasMore bool
 
 		switch collection {
 		case "messages":
-			// Apply group_ids filter if provided
-			messages, err := s.messageRepo.GetMessagesAfter(ctx, since, limit)
+			messages, err := s.messageRepo.GetMessagesAfter(ctx, messageGroupIDs, since, limit)
 			if err != nil {
 				// Log error with structured context but continue with other collections (partial failure handling)
 				logger := logging.GetLogger()
@@ -579,20 +1075,6 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 				continue
 			}
 			if len(messages) > 0 {
-				// Filter by group_ids if provided
-				if len(req.GroupIDs) > 0 {
-					filtered := make([]*domain.Message, 0)
-					groupIDSet := make(map[string]bool)
-					for _, gid := range req.GroupIDs {
-						groupIDSet[gid] = true
-					}
-					for _, msg := range messages {
-						if groupIDSet[msg.GroupID] {
-							filtered = append(filtered, msg)
-						}
-					}
-					messages = filtered
-				}
 				// Convert to interface{} for Document
 				for _, msg := range messages {
 					collectionDocs = append(collectionDocs, msg)
@@ -600,13 +1082,14 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 				if len(messages) == limit {
 					collectionHasMore = true
 				}
-				collectionCheckpoint = messages[len(messages)-1].CreatedAt
+				last := messages[len(messages)-1]
+				collectionCheckpoint = database.NewCursor(last.ChangedAt(), last.ID)
 			}
 
 		case "groups":
 			var groups []*domain.Group
 			var err error
-			
+
 			// Use nearby filter if location is provided
 			if req.Latitude != nil && req.Longitude != nil && req.Radius != nil {
 				// Use FindNearby for location-based filtering
@@ -624,13 +1107,13 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 			} else {
 				// Fallback to GetGroupsAfter for time-based sync
 				groups, err = s.groupRepo.GetGroupsAfter(ctx, since, limit)
-			if err != nil {
-				logger := logging.GetLogger()
-				logger.Warn("Failed to pull groups collection", "deviceID", deviceID, "collection", "groups", "error", err)
-				continue
-			}
+				if err != nil {
+					logger := logging.GetLogger()
+					logger.Warn("Failed to pull groups collection", "deviceID", deviceID, "collection", "groups", "error", err)
+					continue
+				}
 			}
-			
+
 			if len(groups) > 0 {
 				for _, group := range groups {
 					collectionDocs = append(collectionDocs, group)
@@ -638,7 +1121,8 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 				if len(groups) == limit {
 					collectionHasMore = true
 				}
-				collectionCheckpoint = groups[len(groups)-1].UpdatedAt
+				last := groups[len(groups)-1]
+				collectionCheckpoint = database.NewCursor(last.UpdatedAt, last.ID)
 			}
 
 		case "favorite_groups":
@@ -656,7 +1140,8 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 				if len(favorites) == limit {
 					collectionHasMore = true
 				}
-				collectionCheckpoint = favorites[len(favorites)-1].CreatedAt
+				last := favorites[len(favorites)-1]
+				collectionCheckpoint = database.NewCursor(last.CreatedAt, last.ID)
 			}
 
 		case "pinned_messages":
@@ -674,7 +1159,8 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 				if len(pins) == limit {
 					collectionHasMore = true
 				}
-				collectionCheckpoint = pins[len(pins)-1].PinnedAt
+				last := pins[len(pins)-1]
+				collectionCheckpoint = database.NewCursor(last.PinnedAt, last.ID)
 			}
 
 		case "user_status":
@@ -692,7 +1178,66 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 				if len(statuses) == limit {
 					collectionHasMore = true
 				}
-				collectionCheckpoint = statuses[len(statuses)-1].UpdatedAt
+				last := statuses[len(statuses)-1]
+				collectionCheckpoint = database.NewCursor(last.UpdatedAt, last.ID)
+			}
+
+		case "reactions":
+			reactions, err := s.reactionRepo.GetReactionsAfter(ctx, messageGroupIDs, since, limit)
+			if err != nil {
+				// Log error with structured context but continue with other collections (partial failure handling)
+				logger := logging.GetLogger()
+				logger.Warn("Failed to pull reactions collection", "deviceID", deviceID, "collection", "reactions", "error", err)
+				continue
+			}
+			if len(reactions) > 0 {
+				for _, reaction := range reactions {
+					collectionDocs = append(collectionDocs, reaction)
+				}
+				if len(reactions) == limit {
+					collectionHasMore = true
+				}
+				last := reactions[len(reactions)-1]
+				collectionCheckpoint = database.NewCursor(last.UpdatedAt, last.ID)
+			}
+
+		case "attachments":
+			attachments, err := s.attachmentRepo.GetAttachmentsAfter(ctx, messageGroupIDs, since, limit)
+			if err != nil {
+				// Log error with structured context but continue with other collections (partial failure handling)
+				logger := logging.GetLogger()
+				logger.Warn("Failed to pull attachments collection", "deviceID", deviceID, "collection", "attachments", "error", err)
+				continue
+			}
+			if len(attachments) > 0 {
+				for _, attachment := range attachments {
+					collectionDocs = append(collectionDocs, attachment)
+				}
+				if len(attachments) == limit {
+					collectionHasMore = true
+				}
+				last := attachments[len(attachments)-1]
+				collectionCheckpoint = database.NewCursor(last.UpdatedAt, last.ID)
+			}
+
+		case "read_markers":
+			// Markers only move forward and are never deleted, so the collection has no deletions
+			markers, err := s.readMarkerRepo.GetMarkersAfter(ctx, deviceID, since, limit)
+			if err != nil {
+				// Log error with structured context but continue with other collections (partial failure handling)
+				logger := logging.GetLogger()
+				logger.Warn("Failed to pull read_markers collection", "deviceID", deviceID, "collection", "read_markers", "error", err)
+				continue
+			}
+			if len(markers) > 0 {
+				for _, marker := range markers {
+					collectionDocs = append(collectionDocs, marker)
+				}
+				if len(markers) == limit {
+					collectionHasMore = true
+				}
+				last := markers[len(markers)-1]
+				collectionCheckpoint = database.NewCursor(last.UpdatedAt, last.ID)
 			}
 		}
 
@@ -715,8 +1260,8 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 			// Store per-collection checkpoint
 			checkpoints[collection] = collectionCheckpoint
 			// Track latest checkpoint across all collections (for legacy compatibility)
-			if collectionCheckpoint.After(latestCheckpoint) {
-				latestCheckpoint = collectionCheckpoint
+			if collectionCheckpoint.Time.After(latestCheckpoint) {
+				latestCheckpoint = collectionCheckpoint.Time
 			}
 		} else {
 			// No new documents for this collection, but we should still return its current checkpoint if it exists
@@ -725,6 +1270,11 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 			if err == nil && !currentCheckpoint.IsZero() {
 				checkpoints[collection] = currentCheckpoint
 			}
+			// The device is still up to date, which keeps it within the tombstone horizon
+			if err := s.replicationRepo.MarkSynced(ctx, deviceID, collection, since); err != nil {
+				logger := logging.GetLogger()
+				logger.Warn("Failed to mark collection synced", "collection", collection, "deviceID", deviceID, "error", err)
+			}
 		}
 
 		// Track has_more
@@ -733,69 +1283,59 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 		}
 
 		// Query deletions for this collection
+		// A resyncing client discards its local copy, so it needs no deletions
+		if resyncCollection {
+			continue
+		}
+		deletionSince := s.deletionCheckpointFor(ctx, deviceID, collection, req.DeletionCheckpoint, since)
+		var deletionInfos []database.DeletionInfo
+		var err error
 		switch collection {
 		case "messages":
-			deletionInfos, err := s.messageRepo.GetDeletionsAfter(ctx, since, limit)
-			if err != nil {
-				logger := logging.GetLogger()
-				logger.Warn("Failed to pull message deletions", "deviceID", deviceID, "collection", "messages", "error", err)
-			} else {
-				for _, del := range deletionInfos {
-					allDeletions = append(allDeletions, Deletion{
-						Collection: collection,
-						ID:         del.ID,
-						DeletedAt:  del.DeletedAt,
-					})
-				}
-			}
-
+			deletionInfos, err = s.messageRepo.GetDeletionsAfter(ctx, messageGroupIDs, deletionSince, limit)
 		case "groups":
-			deletionInfos, err := s.groupRepo.GetDeletionsAfter(ctx, since, limit)
-			if err != nil {
-				logger := logging.GetLogger()
-				logger.Warn("Failed to pull group deletions", "deviceID", deviceID, "collection", "groups", "error", err)
-			} else {
-				for _, del := range deletionInfos {
-					allDeletions = append(allDeletions, Deletion{
-						Collection: collection,
-						ID:         del.ID,
-						DeletedAt:  del.DeletedAt,
-					})
-				}
-			}
-
+			deletionInfos, err = s.groupRepo.GetDeletionsAfter(ctx, deletionSince, limit)
 		case "favorite_groups":
-			deletionInfos, err := s.favoriteRepo.GetDeletionsAfter(ctx, deviceID, since, limit)
-			if err != nil {
-				logger := logging.GetLogger()
-				logger.Warn("Failed to pull favorite deletions", "deviceID", deviceID, "collection", "favorite_groups", "error", err)
-			} else {
-				for _, del := range deletionInfos {
-					allDeletions = append(allDeletions, Deletion{
-						Collection: collection,
-						ID:         del.ID,
-						DeletedAt:  del.DeletedAt,
-					})
-				}
-			}
-
+			deletionInfos, err = s.favoriteRepo.GetDeletionsAfter(ctx, deviceID, deletionSince, limit)
 		case "user_status":
-			deletionInfos, err := s.statusRepo.GetDeletionsAfter(ctx, deviceID, since, limit)
-			if err != nil {
-				logger := logging.GetLogger()
-				logger.Warn("Failed to pull status deletions", "deviceID", deviceID, "collection", "user_status", "error", err)
-			} else {
-				for _, del := range deletionInfos {
-					allDeletions = append(allDeletions, Deletion{
-						Collection: collection,
-						ID:         del.ID,
-						DeletedAt:  del.DeletedAt,
-					})
-				}
-			}
-
+			deletionInfos, err = s.statusRepo.GetDeletionsAfter(ctx, deviceID, deletionSince, limit)
 		case "pinned_messages":
-			// Pinned messages don't have deletion sync yet (not in scope)
+			deletionInfos, err = s.pinRepo.GetDeletionsAfter(ctx, deviceID, deletionSince, limit)
+		case "reactions":
+			deletionInfos, err = s.reactionRepo.GetDeletionsAfter(ctx, messageGroupIDs, deletionSince, limit)
+		case "attachments":
+			deletionInfos, err = s.attachmentRepo.GetDeletionsAfter(ctx, messageGroupIDs, deletionSince, limit)
+		default:
+			continue
+		}
+		if err != nil {
+			logger := logging.GetLogger()
+			logger.Warn("Failed to pull deletions", "deviceID", deviceID, "collection", collection, "error", err)
+			continue
+		}
+
+		for _, del := range deletionInfos {
+			allDeletions = append(allDeletions, Deletion{
+				Collection: collection,
+				ID:         del.ID,
+				DeletedAt:  del.DeletedAt,
+			})
+		}
+		if len(deletionInfos) == 0 {
+			if !deletionSince.IsZero() {
+				deletionCheckpoints[collection] = deletionSince
+			}
+			continue
+		}
+		last := deletionInfos[len(deletionInfos)-1]
+		deletionCheckpoint := database.NewCursor(last.DeletedAt, last.ID)
+		if err := s.replicationRepo.UpsertCheckpoint(ctx, deviceID, deletionCheckpointCollection(collection), deletionCheckpoint); err != nil {
+			logger := logging.GetLogger()
+			logger.Warn("Failed to update deletion checkpoint", "collection", collection, "deviceID", deviceID, "error", err)
+		}
+		deletionCheckpoints[collection] = deletionCheckpoint
+		if len(deletionInfos) == limit {
+			hasMore = true
 		}
 	}
 
@@ -810,5 +1350,8 @@ func (s *ReplicationService) PullDocuments(ctx context.Context, deviceID string,
 		Checkpoint:  latestCheckpoint, // Legacy field for backward compatibility
 		Checkpoints: checkpoints,      // Per-collection checkpoints
 		HasMore:     hasMore,
+		Resync:      resync,
+
+		DeletionCheckpoints: deletionCheckpoints,
 	}, nil
 }
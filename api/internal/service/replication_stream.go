@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"nearby-msg/api/internal/infrastructure/database"
+)
+
+const (
+	// streamPollInterval is how often an idle stream re-checks for changes it wasn't signalled
+	// about, e.g. group or status writes made through another instance
+	streamPollInterval = 15 * time.Second
+	// streamHeartbeatInterval keeps idle streams alive through proxies that drop silent connections
+	streamHeartbeatInterval = 25 * time.Second
+)
+
+// Stream event types
+const (
+	StreamEventDocument  = "document"  // Data is a Document
+	StreamEventDeletion  = "deletion"  // Data is a Deletion
+	StreamEventResync    = "resync"    // Data is a StreamResync; discard the listed collections locally
+	StreamEventReady     = "ready"     // Data is a StreamReady; the backlog has been sent
+	StreamEventHeartbeat = "heartbeat" // No data; only keeps the connection open
+)
+
+// StreamEvent is a single event of a replication stream
+type StreamEvent struct {
+	ID    string      // Resume token (see EncodeStreamCheckpoint); empty if the position didn't change
+	Event string      // One of the StreamEvent* types
+	Data  interface{} // JSON payload
+}
+
+// StreamResync lists collections the client must rebuild from scratch (see PullDocumentsResponse.Resync)
+type StreamResync struct {
+	Collections []string `json:"collections"`
+}
+
+// StreamReady is sent once the backlog has been streamed
+type StreamReady struct {
+	Checkpoints map[string]database.Cursor `json:"checkpoints"`
+}
+
+// EncodeStreamCheckpoint encodes per-collection checkpoints as an opaque stream event ID
+func EncodeStreamCheckpoint(checkpoints map[string]database.Cursor) string {
+	data, err := json.Marshal(checkpoints)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseStreamCheckpoint decodes a stream event ID produced by EncodeStreamCheckpoint
+func ParseStreamCheckpoint(id string) (map[string]database.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream event ID: %w", err)
+	}
+	var checkpoints map[string]database.Cursor
+	if err := json.Unmarshal(data, &checkpoints); err != nil {
+		return nil, fmt.Errorf("invalid stream event ID: %w", err)
+	}
+	return checkpoints, nil
+}
+
+// StreamDocuments streams documents and deletions newer than the request's checkpoints, then
+// keeps streaming new ones as they are written, until ctx is cancelled or send fails.
+// Every batch of events ends with one carrying the resume token for the position after it.
+// The location filter of PullDocumentsRequest is not supported; groups are streamed by time only.
+func (s *ReplicationService) StreamDocuments(ctx context.Context, deviceID string, req PullDocumentsRequest, send func(StreamEvent) error) error {
+	if len(req.Collections) == 0 {
+		return fmt.Errorf("collections array cannot be empty")
+	}
+	for _, collection := range req.Collections {
+		if !ValidCollections[collection] {
+			return fmt.Errorf("invalid collection: %s", collection)
+		}
+	}
+
+	// Resolve every collection's starting point up front, the same way a pull would
+	checkpoints := make(map[string]database.Cursor, len(req.Collections))
+	defaultSince := database.NewCursor(time.Now().UTC().Add(defaultCheckpointDelta), "")
+	for _, collection := range req.Collections {
+		if req.Checkpoint != nil {
+			if checkpoint, ok := req.Checkpoint[collection]; ok {
+				checkpoints[collection] = checkpoint
+				continue
+			}
+			checkpoints[collection] = defaultSince
+		} else {
+			checkpoints[collection] = s.getCheckpointForCollection(ctx, deviceID, collection, defaultSince)
+		}
+	}
+
+	// Subscribe before the first pull so no change between the pull and the wait is missed
+	var changes <-chan struct{}
+	if s.websocketService != nil {
+		var unsubscribe func()
+		changes, unsubscribe = s.websocketService.Changes().Subscribe()
+		defer unsubscribe()
+	}
+	poll := time.NewTicker(streamPollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	// Deletions are selected by timestamp and would repeat on every pull; only send new ones
+	deletionsSent := make(map[string]time.Time)
+	ready := false
+
+	for {
+		pullReq := PullDocumentsRequest{
+			Checkpoint:  make(map[string]database.Cursor, len(checkpoints)),
+			Collections: req.Collections,
+			GroupIDs:    req.GroupIDs,
+			Limit:       req.Limit,
+		}
+		for collection, checkpoint := range checkpoints {
+			pullReq.Checkpoint[collection] = checkpoint
+		}
+
+		resp, err := s.PullDocuments(ctx, deviceID, pullReq)
+		if err != nil {
+			return err
+		}
+
+		var events []StreamEvent
+		if len(resp.Resync) > 0 {
+			events = append(events, StreamEvent{Event: StreamEventResync, Data: StreamResync{Collections: resp.Resync}})
+		}
+		for _, doc := range resp.Documents {
+			events = append(events, StreamEvent{Event: StreamEventDocument, Data: doc})
+			if checkpoint, ok := resp.Checkpoints[doc.Collection]; ok {
+				checkpoints[doc.Collection] = checkpoint
+			}
+		}
+		for _, del := range resp.Deletions {
+			if !del.DeletedAt.After(deletionsSent[del.Collection]) {
+				continue
+			}
+			deletionsSent[del.Collection] = del.DeletedAt
+			events = append(events, StreamEvent{Event: StreamEventDeletion, Data: del})
+		}
+		if !ready && !resp.HasMore {
+			events = append(events, StreamEvent{Event: StreamEventReady, Data: StreamReady{Checkpoints: checkpoints}})
+			ready = true
+		}
+
+		// Only the last event of a batch moves the resume position, so resuming never skips events
+		if len(events) > 0 {
+			events[len(events)-1].ID = EncodeStreamCheckpoint(checkpoints)
+		}
+		for _, event := range events {
+			if err := send(event); err != nil {
+				return err
+			}
+		}
+
+		if resp.HasMore {
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+
+		// Wait for something to change
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-changes:
+				break wait
+			case <-poll.C:
+				break wait
+			case <-heartbeat.C:
+				if err := send(StreamEvent{Event: StreamEventHeartbeat}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
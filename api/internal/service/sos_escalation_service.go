@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+	"nearby-msg/api/internal/infrastructure/database"
+	"nearby-msg/api/internal/infrastructure/logging"
+	"nearby-msg/api/internal/protocol"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// sosEscalationPollInterval is how often the engine looks for incidents to escalate
+	sosEscalationPollInterval = 30 * time.Second
+	// sosEscalationMaxAge stops incidents open for longer than this past the escalation delay,
+	// e.g. while the server was down, from being escalated late
+	sosEscalationMaxAge = time.Hour
+	// sosEscalationBatch bounds how many incidents an escalation pass handles
+	sosEscalationBatch = 50
+	// sosEscalationMaxGroups caps how many nearby groups a single incident is escalated to, nearest first
+	sosEscalationMaxGroups = 20
+)
+
+// SOSEscalationService rebroadcasts SOS incidents nobody acknowledged to the groups around
+// them. An incident still open after a delay is sent as sos_escalated to every group within
+// a radius of its group's location. Each incident reaches each group at most once, and a
+// group hears from the same origin group at most once per cooldown; escalations held back by
+// the cooldown are sent once it ends, while the incident is still open.
+type SOSEscalationService struct {
+	pool         *database.Pool
+	incidentRepo *database.SOSIncidentRepository
+	groupRepo    *database.GroupRepository
+	messageRepo  *database.MessageRepository
+	wsService    *WebSocketService
+	after        time.Duration // How long an incident may stay open before it is escalated
+	radiusMeters float64
+	cooldown     time.Duration
+}
+
+// NewSOSEscalationService creates a new SOS escalation service
+func NewSOSEscalationService(pool *database.Pool, incidentRepo *database.SOSIncidentRepository, groupRepo *database.GroupRepository, messageRepo *database.MessageRepository, wsService *WebSocketService, after time.Duration, radiusMeters float64, cooldown time.Duration) *SOSEscalationService {
+	return &SOSEscalationService{
+		pool:         pool,
+		incidentRepo: incidentRepo,
+		groupRepo:    groupRepo,
+		messageRepo:  messageRepo,
+		wsService:    wsService,
+		after:        after,
+		radiusMeters: radiusMeters,
+		cooldown:     cooldown,
+	}
+}
+
+// Run escalates due incidents every sosEscalationPollInterval until ctx is cancelled
+func (s *SOSEscalationService) Run(ctx context.Context) {
+	ticker := time.NewTicker(sosEscalationPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.EscalateDue(ctx)
+		}
+	}
+}
+
+// EscalateDue escalates the incidents that have stayed open past the delay, and those with
+// escalations deferred by a cooldown. An incident that fails to escalate stays due and is
+// retried on the next pass.
+func (s *SOSEscalationService) EscalateDue(ctx context.Context) {
+	logger := logging.GetLogger()
+	now := time.Now()
+	dueBefore := now.Add(-s.after)
+	after := database.NewCursor(dueBefore.Add(-sosEscalationMaxAge), "")
+
+	for {
+		due, err := s.incidentRepo.GetDueForEscalation(ctx, after, dueBefore, sosEscalationBatch)
+		if err != nil {
+			logger.Warn("Failed to list SOS incidents due for escalation", "error", err)
+			return
+		}
+
+		for _, incident := range due {
+			after = database.NewCursor(incident.CreatedAt, incident.ID)
+
+			claimed, reached, deferred, err := s.escalate(ctx, incident, now)
+			if err != nil {
+				logger.Warn("Failed to escalate SOS incident", "incidentID", incident.ID, "error", err)
+				continue
+			}
+			if !claimed {
+				continue
+			}
+			logger.Info("Escalated SOS incident", "incidentID", incident.ID, "groupID", incident.GroupID, "groupsReached", reached, "groupsDeferred", deferred)
+		}
+
+		if len(due) < sosEscalationBatch {
+			return
+		}
+	}
+}
+
+// escalatedTarget is a group an escalation pass recorded, to be sent the incident once committed
+type escalatedTarget struct {
+	groupID string
+	frame   protocol.Frame
+}
+
+// escalate sends an incident to the groups around its group it hasn't reached yet, and tells
+// its own group the first time it is escalated. The incident is claimed and the escalations
+// are recorded in one transaction, and events are only broadcast once it commits. Returns
+// whether the incident was claimed, how many groups were reached and how many were deferred
+// by the cooldown.
+func (s *SOSEscalationService) escalate(ctx context.Context, incident *domain.SOSIncident, now time.Time) (bool, int, int, error) {
+	origin, err := s.groupRepo.GetByID(ctx, incident.GroupID)
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("failed to get group: %w", err)
+	}
+	message, err := s.messageRepo.GetByID(ctx, incident.ID)
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("failed to get SOS message: %w", err)
+	}
+
+	nearby, err := s.groupRepo.FindNearby(ctx, origin.Latitude, origin.Longitude, s.radiusMeters)
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("failed to find nearby groups: %w", err)
+	}
+	sort.Slice(nearby, func(i, j int) bool {
+		return nearby[i].Distance < nearby[j].Distance
+	})
+
+	var claimed, first bool
+	var targets []escalatedTarget
+	deferred := 0
+	err = s.pool.WithTx(ctx, func(tx pgx.Tx) error {
+		incidentRepo := s.incidentRepo.WithQuerier(tx)
+
+		ok, err := incidentRepo.ClaimForEscalation(ctx, incident)
+		if err != nil {
+			return fmt.Errorf("failed to claim incident: %w", err)
+		}
+		if !ok {
+			return nil
+		}
+		claimed, first = true, incident.EscalatedAt == nil
+
+		escalated, err := incidentRepo.GetEscalatedGroupIDs(ctx, incident.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get escalated groups: %w", err)
+		}
+
+		considered := 0
+		cooldownSince := now.Add(-s.cooldown)
+		for _, result := range nearby {
+			if considered >= sosEscalationMaxGroups {
+				break
+			}
+			if result.Group.ID == origin.ID {
+				continue
+			}
+			considered++
+			if escalated[result.Group.ID] {
+				continue
+			}
+			recorded, err := incidentRepo.RecordEscalation(ctx, incident.ID, origin.ID, result.Group.ID, now, cooldownSince)
+			if err != nil {
+				return fmt.Errorf("failed to record escalation: %w", err)
+			}
+			if !recorded {
+				deferred++
+				continue
+			}
+			targets = append(targets, escalatedTarget{
+				groupID: result.Group.ID,
+				frame:   SOSEscalatedFrame(incident, message, origin, result.Group, now),
+			})
+		}
+
+		if err := incidentRepo.MarkEscalated(ctx, incident.ID, now, deferred > 0); err != nil {
+			return fmt.Errorf("failed to mark incident escalated: %w", err)
+		}
+		return nil
+	})
+	if err != nil || !claimed {
+		return false, 0, 0, err
+	}
+
+	for _, target := range targets {
+		s.wsService.BroadcastToGroup(target.groupID, target.frame)
+	}
+	if first {
+		incident.EscalatedAt = &now
+		incident.UpdatedAt = now
+		s.wsService.BroadcastToGroup(incident.GroupID, SOSIncidentFrame(incident, ""))
+	}
+	return true, len(targets), deferred, nil
+}
+
+// SOSEscalatedFrame converts an escalated incident into the sos_escalated event frame sent to a nearby group
+func SOSEscalatedFrame(incident *domain.SOSIncident, message *domain.Message, origin, target *domain.Group, escalatedAt time.Time) protocol.Frame {
+	var sosType *string
+	if message.SOSType != nil {
+		st := string(*message.SOSType)
+		sosType = &st
+	}
+
+	latitude, longitude, accuracy := origin.Latitude, origin.Longitude, (*float64)(nil)
+	if message.HasLocation() {
+		latitude, longitude, accuracy = *message.Latitude, *message.Longitude, message.Accuracy
+	}
+
+	return protocol.NewFrame(protocol.TypeSOSEscalated, protocol.SOSEscalatedEvent{
+		IncidentID:      incident.ID,
+		GroupID:         target.ID,
+		OriginGroupID:   origin.ID,
+		OriginGroupName: origin.Name,
+		DeviceID:        incident.DeviceID,
+		SOSType:         sosType,
+		Content:         message.Content,
+		Latitude:        latitude,
+		Longitude:       longitude,
+		Accuracy:        accuracy,
+		DistanceMeters:  domain.DistanceMeters(target.Latitude, target.Longitude, latitude, longitude),
+		CreatedAt:       message.CreatedAt.Format(time.RFC3339),
+		EscalatedAt:     escalatedAt.Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"nearby-msg/api/internal/domain"
+	"nearby-msg/api/internal/infrastructure/database"
+)
+
+// sosIncidentLimit bounds how many incidents ListIncidents returns
+const sosIncidentLimit = 100
+
+// ErrNotSOSResolver is returned when a device other than the SOS author or the group creator resolves an incident
+var ErrNotSOSResolver = errors.New("only the SOS author or the group creator can resolve it")
+
+// SOSService handles the lifecycle of SOS incidents
+type SOSService struct {
+	incidentRepo *database.SOSIncidentRepository
+	groupRepo    *database.GroupRepository
+	accessPolicy *AccessPolicy
+}
+
+// NewSOSService creates a new SOS service
+func NewSOSService(incidentRepo *database.SOSIncidentRepository, groupRepo *database.GroupRepository, accessPolicy *AccessPolicy) *SOSService {
+	return &SOSService{
+		incidentRepo: incidentRepo,
+		groupRepo:    groupRepo,
+		accessPolicy: accessPolicy,
+	}
+}
+
+// SOSChange is the outcome of changing an incident
+type SOSChange struct {
+	Incident *domain.SOSIncident `json:"incident"`
+	Changed  bool                `json:"changed"` // False if the incident was already in the requested state
+}
+
+// GetIncident returns an incident. Reading it follows the same rules as subscribing to its group.
+func (s *SOSService) GetIncident(ctx context.Context, deviceID, incidentID string) (*domain.SOSIncident, error) {
+	incident, err := s.incidentRepo.GetByID(ctx, incidentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SOS incident: %w", err)
+	}
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanSubscribe(ctx, deviceID, incident.GroupID); err != nil {
+			return nil, err
+		}
+	}
+	return incident, nil
+}
+
+// ListIncidents returns a group's incidents in any of the given states (all if none), newest first
+func (s *SOSService) ListIncidents(ctx context.Context, deviceID, groupID string, states []domain.SOSState) ([]*domain.SOSIncident, error) {
+	for _, state := range states {
+		if !state.IsValid() {
+			return nil, domain.ErrInvalidSOSState
+		}
+	}
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanSubscribe(ctx, deviceID, groupID); err != nil {
+			return nil, err
+		}
+	}
+
+	incidents, err := s.incidentRepo.GetByGroup(ctx, groupID, states, sosIncidentLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SOS incidents: %w", err)
+	}
+	return incidents, nil
+}
+
+// Transition moves an incident forward to a state. Anyone who may post in the group may
+// acknowledge an incident or mark it in progress; only the SOS author or the group creator
+// may resolve it. Moving to the state the incident is already in changes nothing.
+func (s *SOSService) Transition(ctx context.Context, deviceID, incidentID string, to domain.SOSState) (*SOSChange, error) {
+	if !to.IsValid() || to == domain.SOSStateOpen {
+		return nil, domain.ErrInvalidSOSState
+	}
+
+	incident, err := s.incidentForChange(ctx, deviceID, incidentID)
+	if err != nil {
+		return nil, err
+	}
+	if to == domain.SOSStateResolved {
+		if err := s.checkResolver(ctx, deviceID, incident); err != nil {
+			return nil, err
+		}
+	}
+	if incident.State == to {
+		return &SOSChange{Incident: incident, Changed: false}, nil
+	}
+	if !incident.State.CanTransitionTo(to) {
+		return nil, domain.ErrInvalidSOSTransition
+	}
+
+	moved, err := s.incidentRepo.Transition(ctx, incidentID, to, deviceID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to update SOS incident: %w", err)
+	}
+	return s.reload(ctx, incidentID, to, moved)
+}
+
+// Claim adds a device as a responder to an unresolved incident. An open or acknowledged
+// incident moves to in progress once someone responds.
+func (s *SOSService) Claim(ctx context.Context, deviceID, incidentID string) (*SOSChange, error) {
+	incident, err := s.incidentForChange(ctx, deviceID, incidentID)
+	if err != nil {
+		return nil, err
+	}
+	if incident.State == domain.SOSStateResolved {
+		return nil, domain.ErrSOSResolved
+	}
+
+	now := time.Now()
+	claimed, err := s.incidentRepo.AddResponder(ctx, incidentID, deviceID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim SOS incident: %w", err)
+	}
+	moved := false
+	if incident.State.CanTransitionTo(domain.SOSStateInProgress) {
+		moved, err = s.incidentRepo.Transition(ctx, incidentID, domain.SOSStateInProgress, deviceID, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update SOS incident: %w", err)
+		}
+	}
+
+	incident, err = s.incidentRepo.GetByID(ctx, incidentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SOS incident: %w", err)
+	}
+	if !claimed && !incident.HasResponder(deviceID) {
+		// Resolved between the read and the claim
+		return nil, domain.ErrSOSResolved
+	}
+	return &SOSChange{Incident: incident, Changed: claimed || moved}, nil
+}
+
+// Release removes a device's claim on an incident. The incident's state is left as it is.
+func (s *SOSService) Release(ctx context.Context, deviceID, incidentID string) (*SOSChange, error) {
+	if _, err := s.incidentForChange(ctx, deviceID, incidentID); err != nil {
+		return nil, err
+	}
+
+	released, err := s.incidentRepo.RemoveResponder(ctx, incidentID, deviceID, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to release SOS incident: %w", err)
+	}
+	incident, err := s.incidentRepo.GetByID(ctx, incidentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SOS incident: %w", err)
+	}
+	return &SOSChange{Incident: incident, Changed: released}, nil
+}
+
+// incidentForChange loads an incident a device wants to change. Changing an incident is a
+// write to its group, so it follows the same rules as posting.
+func (s *SOSService) incidentForChange(ctx context.Context, deviceID, incidentID string) (*domain.SOSIncident, error) {
+	incident, err := s.incidentRepo.GetByID(ctx, incidentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SOS incident: %w", err)
+	}
+	if s.accessPolicy != nil {
+		if err := s.accessPolicy.CanPost(ctx, deviceID, incident.GroupID); err != nil {
+			return nil, err
+		}
+	}
+	return incident, nil
+}
+
+// checkResolver checks the device raised the SOS or created its group
+func (s *SOSService) checkResolver(ctx context.Context, deviceID string, incident *domain.SOSIncident) error {
+	if incident.DeviceID == deviceID {
+		return nil
+	}
+	group, err := s.groupRepo.GetByID(ctx, incident.GroupID)
+	if err != nil {
+		return fmt.Errorf("failed to get group: %w", err)
+	}
+	if group.CreatorDeviceID == nil || *group.CreatorDeviceID != deviceID {
+		return ErrNotSOSResolver
+	}
+	return nil
+}
+
+// reload returns the incident after a transition to a state. If another device moved it
+// first, the change is reported as unchanged when it ended up in that state anyway.
+func (s *SOSService) reload(ctx context.Context, incidentID string, to domain.SOSState, moved bool) (*SOSChange, error) {
+	incident, err := s.incidentRepo.GetByID(ctx, incidentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SOS incident: %w", err)
+	}
+	if !moved && incident.State != to {
+		return nil, domain.ErrInvalidSOSTransition
+	}
+	return &SOSChange{Incident: incident, Changed: moved}, nil
+}
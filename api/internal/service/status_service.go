@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"nearby-msg/api/internal/domain"
 	"nearby-msg/api/internal/infrastructure/database"
@@ -11,44 +12,117 @@ import (
 
 // StatusService handles user status business logic
 type StatusService struct {
-	repo *database.StatusRepository
+	repo             *database.StatusRepository
+	conflictStrategy ConflictStrategy // How stale updates are resolved
 }
 
 // NewStatusService creates a new status service
-func NewStatusService(repo *database.StatusRepository) *StatusService {
-	return &StatusService{repo: repo}
+func NewStatusService(repo *database.StatusRepository, conflictStrategy ConflictStrategy) *StatusService {
+	return &StatusService{repo: repo, conflictStrategy: conflictStrategy}
 }
 
+// WithQuerier returns a copy of the service whose repository runs on q (e.g. a transaction)
+func (s *StatusService) WithQuerier(q database.Querier) *StatusService {
+	return &StatusService{repo: s.repo.WithQuerier(q), conflictStrategy: s.conflictStrategy}
+}
+
+// statusFields are the user-editable fields of a status, as tracked in its field revisions
+var statusFields = []string{"status_type", "description"}
+
 // UpdateStatusRequest represents a status update request
 type UpdateStatusRequest struct {
-	StatusType  domain.StatusType `json:"status_type"`
-	Description *string           `json:"description,omitempty"`
+	StatusType      domain.StatusType `json:"status_type"`
+	Description     *string           `json:"description,omitempty"`
+	BaseRevision    *int64            `json:"base_revision,omitempty"`     // Revision the client edited; omitted means overwrite
+	ClientUpdatedAt *time.Time        `json:"client_updated_at,omitempty"` // When the client made the edit, used by last-writer-wins
 }
 
-// UpdateStatus creates or updates a user's status
-func (s *StatusService) UpdateStatus(ctx context.Context, deviceID string, req UpdateStatusRequest) (*domain.UserStatus, error) {
-	// Check if status already exists
-	existing, err := s.repo.GetByDeviceID(ctx, deviceID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check existing status: %w", err)
-	}
+// UpdateStatus creates or updates a user's status.
+// If the update was based on a stale revision and the conflict strategy kept some or all of the
+// server's fields, the returned Conflict describes it alongside the resulting status.
+func (s *StatusService) UpdateStatus(ctx context.Context, deviceID string, req UpdateStatusRequest) (*domain.UserStatus, *Conflict, error) {
+	for attempt := 0; attempt < maxConflictRetries; attempt++ {
+		// Check if status already exists
+		existing, err := s.repo.GetByDeviceID(ctx, deviceID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to check existing status: %w", err)
+		}
+
+		if existing == nil {
+			status, err := s.createStatus(ctx, deviceID, req)
+			return status, nil, err
+		}
+
+		apply, kept := resolveFields(s.conflictStrategy, revisionedDocument{
+			Revision:        existing.Revision,
+			FieldRevisions:  existing.FieldRevisions,
+			UpdatedAt:       existing.UpdatedAt,
+			ClientUpdatedAt: existing.ClientUpdatedAt,
+		}, req.BaseRevision, req.ClientUpdatedAt, statusFields)
+
+		var conflict *Conflict
+		if len(kept) > 0 {
+			conflict = &Conflict{
+				Collection:   "user_status",
+				ID:           existing.ID,
+				BaseRevision: *req.BaseRevision,
+				Strategy:     s.conflictStrategy,
+				Resolution:   ConflictResolutionMerged,
+				Fields:       kept,
+				Document:     existing,
+			}
+			if len(apply) == 0 {
+				conflict.Resolution = ConflictResolutionRejected
+				return existing, conflict, nil
+			}
+		}
 
-	var statusID string
-	if existing != nil {
-		statusID = existing.ID
-	} else {
-		// Generate new ID
-		statusID, err = utils.GenerateID()
+		status := *existing
+		status.ClientUpdatedAt = req.ClientUpdatedAt
+		for _, field := range apply {
+			switch field {
+			case "status_type":
+				status.StatusType = req.StatusType
+			case "description":
+				status.Description = req.Description
+			}
+		}
+
+		if err := status.Validate(); err != nil {
+			return nil, nil, fmt.Errorf("status validation failed: %w", err)
+		}
+
+		updated, err := s.repo.UpdateFields(ctx, &status, apply, existing.Revision)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate status ID: %w", err)
+			return nil, nil, fmt.Errorf("failed to update status: %w", err)
+		}
+		if !updated {
+			// Someone else wrote in between; resolve again against the new revision
+			continue
+		}
+
+		if conflict != nil {
+			conflict.Document = &status
 		}
+		return &status, conflict, nil
+	}
+
+	return nil, nil, fmt.Errorf("failed to update status: too many concurrent updates")
+}
+
+// createStatus creates the first status of a device
+func (s *StatusService) createStatus(ctx context.Context, deviceID string, req UpdateStatusRequest) (*domain.UserStatus, error) {
+	statusID, err := utils.GenerateID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate status ID: %w", err)
 	}
 
 	status := &domain.UserStatus{
-		ID:          statusID,
-		DeviceID:    deviceID,
-		StatusType:  req.StatusType,
-		Description: req.Description,
+		ID:              statusID,
+		DeviceID:        deviceID,
+		StatusType:      req.StatusType,
+		Description:     req.Description,
+		ClientUpdatedAt: req.ClientUpdatedAt,
 	}
 
 	if err := status.Validate(); err != nil {
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"nearby-msg/api/internal/infrastructure/database"
+	"nearby-msg/api/internal/infrastructure/logging"
+)
+
+// TombstoneCompactor periodically purges soft-deleted rows older than a horizon.
+// Devices that haven't synced since before the horizon may have missed purged deletions,
+// so PullDocuments tells them to resync (see ReplicationService).
+type TombstoneCompactor struct {
+	repo     *database.TombstoneRepository
+	horizon  time.Duration // How long tombstones are kept
+	interval time.Duration // How often compaction runs
+}
+
+// NewTombstoneCompactor creates a new tombstone compactor
+func NewTombstoneCompactor(repo *database.TombstoneRepository, horizon, interval time.Duration) *TombstoneCompactor {
+	return &TombstoneCompactor{repo: repo, horizon: horizon, interval: interval}
+}
+
+// Horizon returns how long tombstones are kept before they are purged
+func (c *TombstoneCompactor) Horizon() time.Duration {
+	return c.horizon
+}
+
+// Run compacts immediately and then every interval until ctx is cancelled
+func (c *TombstoneCompactor) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.Compact(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Compact purges tombstones older than the horizon from every soft-deleted table.
+// A failure on one table is logged and doesn't stop the others.
+func (c *TombstoneCompactor) Compact(ctx context.Context) {
+	logger := logging.GetLogger()
+	before := time.Now().Add(-c.horizon)
+
+	for _, table := range database.TombstoneTables {
+		purged, err := c.repo.Purge(ctx, table, before)
+		if err != nil {
+			logger.Warn("Failed to purge tombstones", "table", table, "purged", purged, "error", err)
+			continue
+		}
+		if purged > 0 {
+			logger.Info("Purged tombstones", "table", table, "purged", purged, "before", before)
+		}
+	}
+}
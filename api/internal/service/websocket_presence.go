@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"nearby-msg/api/internal/protocol"
+)
+
+// typingTimeout is how long a device shows as typing after its last typing_start
+const typingTimeout = 6 * time.Second
+
+// typingKey identifies a device typing in a group; tabs of the same device share it
+type typingKey struct {
+	groupID  string
+	deviceID string
+}
+
+// typingState tracks when a device's typing indicator expires
+type typingState struct {
+	timer     *time.Timer
+	expiresAt time.Time
+}
+
+// BroadcastEphemeral broadcasts a frame to a group's subscribers on every instance without
+// sequencing it, so it is neither replayed to resuming clients nor signalled to replication
+func (s *WebSocketService) BroadcastEphemeral(groupID string, message protocol.Frame) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.broadcaster.Publish(ctx, BroadcastMessage{GroupID: groupID, Message: message, Ephemeral: true}); err != nil {
+		log.Printf("Failed to publish ephemeral broadcast to group %s: %v", groupID, err)
+	}
+}
+
+// GroupPresence returns the distinct devices with a connection subscribed to a group, on every
+// instance when presence is tracked in PostgreSQL
+func (s *WebSocketService) GroupPresence(ctx context.Context, groupID string) ([]string, error) {
+	return s.presence.Devices(ctx, groupID)
+}
+
+// announcePresence records a connection joining or leaving groups and broadcasts presence_join
+// or presence_leave for those where it was the device's first or last connection. If presence
+// can't be recorded, the event is broadcast anyway. A device leaving a group also stops typing
+// in it. Must not be called with s.mu held.
+func (s *WebSocketService) announcePresence(frameType string, deviceID, clientID string, groupIDs []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, groupID := range groupIDs {
+		var crossed bool
+		var err error
+		if frameType == protocol.TypePresenceLeave {
+			crossed, err = s.presence.Leave(ctx, groupID, deviceID, clientID)
+		} else {
+			crossed, err = s.presence.Join(ctx, groupID, deviceID, clientID)
+			if err == nil && !s.clientSubscribed(clientID, groupID) {
+				// The connection left meanwhile and its leave may have been recorded first
+				if _, err := s.presence.Leave(ctx, groupID, deviceID, clientID); err != nil {
+					log.Printf("Failed to track presence of device %s in group %s: %v", deviceID, groupID, err)
+				}
+				continue
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to track presence of device %s in group %s: %v", deviceID, groupID, err)
+			crossed = true
+		}
+		if !crossed {
+			continue
+		}
+		if frameType == protocol.TypePresenceLeave {
+			s.StopTyping(groupID, deviceID)
+		}
+		s.broadcastPresence(frameType, groupID, deviceID)
+	}
+}
+
+// clientSubscribed reports whether a connection is still subscribed to a group
+func (s *WebSocketService) clientSubscribed(clientID, groupID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.groups[groupID][clientID]
+}
+
+// PresenceGone announces that a device left a group because the instance holding its last
+// connection stopped heartbeating
+func (s *WebSocketService) PresenceGone(groupID, deviceID string) {
+	s.StopTyping(groupID, deviceID)
+	s.broadcastPresence(protocol.TypePresenceLeave, groupID, deviceID)
+}
+
+func (s *WebSocketService) broadcastPresence(frameType string, groupID, deviceID string) {
+	s.BroadcastEphemeral(groupID, protocol.NewFrame(frameType, protocol.PresenceEvent{
+		GroupID:  groupID,
+		DeviceID: deviceID,
+	}))
+}
+
+// StartTyping marks a client's device as typing in a group it is subscribed to and broadcasts
+// typing_started. Repeating it extends the indicator; it stops by itself after typingTimeout.
+func (s *WebSocketService) StartTyping(client *Client, groupID string) error {
+	client.mu.RLock()
+	subscribed := client.Subscriptions[groupID]
+	client.mu.RUnlock()
+	if !subscribed {
+		return protocol.NewError(protocol.CodeForbidden, "not subscribed to group %s", groupID)
+	}
+
+	key := typingKey{groupID: groupID, deviceID: client.DeviceID}
+	expiresAt := time.Now().Add(typingTimeout)
+
+	s.typingMu.Lock()
+	if state, ok := s.typing[key]; ok {
+		state.expiresAt = expiresAt
+		state.timer.Reset(typingTimeout)
+	} else {
+		state := &typingState{expiresAt: expiresAt}
+		state.timer = time.AfterFunc(typingTimeout, func() { s.expireTyping(key, state) })
+		s.typing[key] = state
+	}
+	s.typingMu.Unlock()
+
+	s.BroadcastEphemeral(groupID, protocol.NewFrame(protocol.TypeTypingStarted, protocol.TypingEvent{
+		GroupID:   groupID,
+		DeviceID:  client.DeviceID,
+		ExpiresAt: expiresAt.UTC().Format(time.RFC3339Nano),
+	}))
+	return nil
+}
+
+// StopTyping clears a device's typing indicator in a group, broadcasting typing_stopped if it was set
+func (s *WebSocketService) StopTyping(groupID string, deviceID string) {
+	key := typingKey{groupID: groupID, deviceID: deviceID}
+
+	s.typingMu.Lock()
+	state, ok := s.typing[key]
+	if ok {
+		state.timer.Stop()
+		delete(s.typing, key)
+	}
+	s.typingMu.Unlock()
+
+	if ok {
+		s.broadcastTypingStopped(key)
+	}
+}
+
+// expireTyping clears a typing indicator whose timer fired, unless it was refreshed in the meantime
+func (s *WebSocketService) expireTyping(key typingKey, state *typingState) {
+	s.typingMu.Lock()
+	if s.typing[key] != state || time.Now().Before(state.expiresAt) {
+		s.typingMu.Unlock()
+		return
+	}
+	delete(s.typing, key)
+	s.typingMu.Unlock()
+
+	s.broadcastTypingStopped(key)
+}
+
+func (s *WebSocketService) broadcastTypingStopped(key typingKey) {
+	s.BroadcastEphemeral(key.groupID, protocol.NewFrame(protocol.TypeTypingStopped, protocol.TypingEvent{
+		GroupID:  key.groupID,
+		DeviceID: key.deviceID,
+	}))
+}
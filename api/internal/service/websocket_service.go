@@ -2,33 +2,30 @@ package service
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"strings"
 	"sync"
 	"time"
 
 	"nearby-msg/api/internal/domain"
+	"nearby-msg/api/internal/infrastructure/database"
+	"nearby-msg/api/internal/protocol"
 )
 
-// WebSocketMessage represents a WebSocket message
-type WebSocketMessage struct {
-	Type      string      `json:"type"`
-	Payload   interface{} `json:"payload"`
-	Timestamp string      `json:"timestamp,omitempty"`
-	MessageID string      `json:"messageId,omitempty"`
-}
-
 // Client represents a WebSocket client connection
 type Client struct {
-	ID           string
-	DeviceID     string
-	Conn         WebSocketConnection
+	ID            string
+	DeviceID      string
+	Conn          WebSocketConnection
 	Subscriptions map[string]bool // group IDs this client is subscribed to
-	Send         chan WebSocketMessage
-	LastPing     time.Time
-	mu           sync.RWMutex
+	Send          chan protocol.Frame
+	LastPing      time.Time
+	// ProtocolVersion is the protocol version negotiated when the connection was opened
+	ProtocolVersion int
+	mu              sync.RWMutex
 }
 
 // WebSocketConnection interface for WebSocket operations
@@ -46,21 +43,33 @@ type WebSocketConnection interface {
 
 // WebSocketService manages WebSocket connections and message broadcasting
 type WebSocketService struct {
-	clients       map[string]*Client // client ID -> client
-	groups        map[string]map[string]bool // group ID -> set of client IDs
-	register      chan *Client
-	unregister    chan *Client
-	broadcast     chan BroadcastMessage
-	mu            sync.RWMutex
-	messageService *MessageService
-	messageRepo   MessageRepository
-	pinService    *PinService
+	clients         map[string]*Client         // client ID -> client
+	groups          map[string]map[string]bool // group ID -> set of client IDs
+	history         map[string]*groupHistory   // group ID -> recent sequenced events for replay
+	register        chan *Client
+	unregister      chan *Client
+	broadcast       chan BroadcastMessage
+	mu              sync.RWMutex
+	messageService  *MessageService
+	messageRepo     MessageRepository
+	pinService      *PinService
+	reactionService *ReactionService
+	markerService   *ReadMarkerService
+	locationService *LocationService
+	sosService      *SOSService
+	accessPolicy    *AccessPolicy
+	broadcaster     Broadcaster
+	presence        PresenceTracker
+	changes         *ChangeFeed // Signalled for every event delivered on this node
+	typing          map[typingKey]*typingState
+	typingMu        sync.Mutex
 }
 
 // BroadcastMessage represents a message to broadcast
 type BroadcastMessage struct {
-	GroupID string
-	Message WebSocketMessage
+	GroupID   string         `json:"groupId"`
+	Message   protocol.Frame `json:"message"`
+	Ephemeral bool           `json:"ephemeral,omitempty"` // Not sequenced, replayed or persisted (typing, presence)
 }
 
 // MessageRepository interface for message persistence
@@ -69,36 +78,77 @@ type MessageRepository interface {
 	GetByID(ctx context.Context, messageID string) (*domain.Message, error)
 }
 
-// NewWebSocketService creates a new WebSocket service
-func NewWebSocketService(messageService *MessageService, messageRepo MessageRepository, pinService *PinService) *WebSocketService {
+// NewWebSocketService creates a new WebSocket service.
+// If broadcaster is nil, events are only delivered to clients connected to this instance.
+// If presence is nil, presence only covers clients connected to this instance.
+func NewWebSocketService(messageService *MessageService, messageRepo MessageRepository, pinService *PinService, reactionService *ReactionService, markerService *ReadMarkerService, locationService *LocationService, sosService *SOSService, accessPolicy *AccessPolicy, broadcaster Broadcaster, presence PresenceTracker) *WebSocketService {
+	if broadcaster == nil {
+		broadcaster = NewInMemoryBroadcaster()
+	}
+	if presence == nil {
+		presence = NewInMemoryPresenceTracker()
+	}
 	return &WebSocketService{
-		clients:        make(map[string]*Client),
-		groups:         make(map[string]map[string]bool),
-		register:       make(chan *Client),
-		unregister:     make(chan *Client),
-		broadcast:      make(chan BroadcastMessage, 256),
-		messageService: messageService,
-		messageRepo:    messageRepo,
-		pinService:     pinService,
+		clients:         make(map[string]*Client),
+		groups:          make(map[string]map[string]bool),
+		history:         make(map[string]*groupHistory),
+		register:        make(chan *Client),
+		unregister:      make(chan *Client),
+		broadcast:       make(chan BroadcastMessage, 256),
+		messageService:  messageService,
+		messageRepo:     messageRepo,
+		pinService:      pinService,
+		reactionService: reactionService,
+		markerService:   markerService,
+		locationService: locationService,
+		sosService:      sosService,
+		accessPolicy:    accessPolicy,
+		broadcaster:     broadcaster,
+		presence:        presence,
+		changes:         NewChangeFeed(),
+		typing:          make(map[typingKey]*typingState),
 	}
 }
 
 // Run starts the WebSocket service hub
 func (s *WebSocketService) Run(ctx context.Context) {
+	// Receive events published by any instance (including this one) and deliver them locally
+	go func() {
+		if err := s.broadcaster.Subscribe(ctx, func(msg BroadcastMessage) {
+			s.broadcast <- msg
+		}); err != nil {
+			log.Printf("Broadcast subscription ended: %v", err)
+		}
+	}()
+
+	historySweep := time.NewTicker(eventHistorySweepInterval)
+	defer historySweep.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-historySweep.C:
+			s.evictIdleHistory(time.Now())
 		case client := <-s.register:
 			s.registerClient(client)
 		case client := <-s.unregister:
 			s.unregisterClient(client)
 		case broadcast := <-s.broadcast:
 			s.broadcastToGroup(broadcast.GroupID, broadcast.Message)
+			if !broadcast.Ephemeral {
+				s.changes.Notify()
+			}
 		}
 	}
 }
 
+// Changes returns the feed signalled whenever a group event is delivered, from any instance,
+// or data is written through this node outside of group events
+func (s *WebSocketService) Changes() *ChangeFeed {
+	return s.changes
+}
+
 // RegisterClient registers a new WebSocket client
 func (s *WebSocketService) RegisterClient(client *Client) {
 	s.register <- client
@@ -109,9 +159,34 @@ func (s *WebSocketService) UnregisterClient(client *Client) {
 	s.unregister <- client
 }
 
-// BroadcastToGroup broadcasts a message to all clients subscribed to a group
-func (s *WebSocketService) BroadcastToGroup(groupID string, message WebSocketMessage) {
-	s.broadcast <- BroadcastMessage{GroupID: groupID, Message: message}
+// BroadcastToGroup broadcasts a message to all clients subscribed to a group on every instance
+func (s *WebSocketService) BroadcastToGroup(groupID string, message protocol.Frame) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.broadcaster.Publish(ctx, BroadcastMessage{GroupID: groupID, Message: message}); err != nil {
+		log.Printf("Failed to publish broadcast to group %s: %v", groupID, err)
+	}
+}
+
+// SendToDevice sends a frame to every connection of a device on this instance and wakes
+// replication streams, which pick the change up on other instances' connections
+func (s *WebSocketService) SendToDevice(deviceID string, message protocol.Frame) {
+	s.mu.Lock()
+	for clientID, client := range s.clients {
+		if client.DeviceID != deviceID {
+			continue
+		}
+		select {
+		case client.Send <- message:
+		default:
+			log.Printf("Client %s send buffer full, closing connection", clientID)
+			s.removeClientLocked(client)
+		}
+	}
+	s.mu.Unlock()
+
+	s.changes.Notify()
 }
 
 // registerClient adds a client to the service
@@ -124,11 +199,11 @@ func (s *WebSocketService) registerClient(client *Client) {
 
 	// Send connection confirmation
 	go func() {
-		msg := WebSocketMessage{
-			Type:      "connected",
-			Payload:   map[string]string{"clientId": client.ID},
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
-		}
+		msg := protocol.NewFrame(protocol.TypeConnected, protocol.ConnectedEvent{
+			ClientID:          client.ID,
+			ProtocolVersion:   client.ProtocolVersion,
+			SupportedVersions: protocol.SupportedVersions(),
+		})
 		select {
 		case client.Send <- msg:
 		case <-time.After(5 * time.Second):
@@ -137,6 +212,23 @@ func (s *WebSocketService) registerClient(client *Client) {
 	}()
 }
 
+// evictIdleHistory drops the replay buffers of groups with no subscribers on this instance that
+// have had no events for eventHistoryTTL, so buffers don't pile up for every group ever seen
+func (s *WebSocketService) evictIdleHistory(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for groupID, history := range s.history {
+		if len(s.groups[groupID]) > 0 {
+			history.lastActive = now
+			continue
+		}
+		if now.Sub(history.lastActive) >= eventHistoryTTL {
+			delete(s.history, groupID)
+		}
+	}
+}
+
 // unregisterClient removes a client from the service
 func (s *WebSocketService) unregisterClient(client *Client) {
 	s.mu.Lock()
@@ -146,7 +238,15 @@ func (s *WebSocketService) unregisterClient(client *Client) {
 		return
 	}
 
-	// Remove client from all groups
+	s.removeClientLocked(client)
+	log.Printf("WebSocket client unregistered: %s", client.ID)
+}
+
+// removeClientLocked removes a client from all groups and closes its send channel.
+// Caller must hold s.mu.
+func (s *WebSocketService) removeClientLocked(client *Client) {
+	var left []string
+	client.mu.Lock()
 	for groupID := range client.Subscriptions {
 		if clients, ok := s.groups[groupID]; ok {
 			delete(clients, client.ID)
@@ -154,17 +254,32 @@ func (s *WebSocketService) unregisterClient(client *Client) {
 				delete(s.groups, groupID)
 			}
 		}
+		left = append(left, groupID)
 	}
+	client.mu.Unlock()
 
 	delete(s.clients, client.ID)
 	close(client.Send)
-	log.Printf("WebSocket client unregistered: %s", client.ID)
+
+	// Announced asynchronously: this runs on the hub goroutine, which also drains broadcasts
+	if len(left) > 0 {
+		go s.announcePresence(protocol.TypePresenceLeave, client.DeviceID, client.ID, left)
+	}
 }
 
-// broadcastToGroup sends a message to all clients subscribed to a group
-func (s *WebSocketService) broadcastToGroup(groupID string, message WebSocketMessage) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// broadcastToGroup records a sequenced event for replay and sends it to all clients subscribed to a group
+func (s *WebSocketService) broadcastToGroup(groupID string, message protocol.Frame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if message.Seq > 0 {
+		history, ok := s.history[groupID]
+		if !ok {
+			history = newGroupHistory()
+			s.history[groupID] = history
+		}
+		history.append(message)
+	}
 
 	clients, ok := s.groups[groupID]
 	if !ok {
@@ -181,37 +296,193 @@ func (s *WebSocketService) broadcastToGroup(groupID string, message WebSocketMes
 		case client.Send <- message:
 		default:
 			log.Printf("Client %s send buffer full, closing connection", clientID)
-			close(client.Send)
-			delete(s.clients, clientID)
+			s.removeClientLocked(client)
 		}
 	}
 }
 
-// SubscribeClient subscribes a client to a group
-func (s *WebSocketService) SubscribeClient(clientID string, groupIDs []string) error {
+// SubscribeClient subscribes a client to groups.
+// Nothing is subscribed if the access policy denies any of the groups.
+func (s *WebSocketService) SubscribeClient(ctx context.Context, clientID string, groupIDs []string) error {
+	s.mu.RLock()
+	client, ok := s.clients[clientID]
+	s.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("client not found: %s", clientID)
+	}
+
+	if s.accessPolicy != nil {
+		for _, groupID := range groupIDs {
+			if err := s.accessPolicy.CanSubscribe(ctx, client.DeviceID, groupID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Deferred before the unlock below so presence is announced once the hub lock is released
+	var joined []string
+	defer func() { s.announcePresence(protocol.TypePresenceJoin, client.DeviceID, client.ID, joined) }()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	client, ok := s.clients[clientID]
-	if !ok {
+	if _, ok := s.clients[clientID]; !ok {
 		return fmt.Errorf("client not found: %s", clientID)
 	}
 
 	client.mu.Lock()
+	joined = s.addSubscriptionsLocked(client, groupIDs)
+	client.mu.Unlock()
+
+	return nil
+}
+
+// ResumeSubscription subscribes a client to groups and, in the same critical section,
+// sends the subscription confirmation followed by any events the client missed since
+// lastSeq. Groups whose gap is no longer in the replay buffer get a resync_required frame.
+// Groups the access policy denies are skipped and reported in the confirmation instead.
+func (s *WebSocketService) ResumeSubscription(ctx context.Context, client *Client, requestedIDs []string, lastSeq map[string]int64) error {
+	groupIDs, denied, err := s.authorizeSubscriptions(ctx, client.DeviceID, requestedIDs)
+	if err != nil {
+		return err
+	}
+
+	// Deferred before the unlock below so presence is announced once the hub lock is released
+	var joined []string
+	defer func() { s.announcePresence(protocol.TypePresenceJoin, client.DeviceID, client.ID, joined) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[client.ID]; !ok {
+		return fmt.Errorf("client not found: %s", client.ID)
+	}
+
+	client.mu.Lock()
+	joined = s.addSubscriptionsLocked(client, groupIDs)
+	client.mu.Unlock()
+
+	// Report the current sequence per group so clients know where to resume from next time
+	currentSeq := make(map[string]int64, len(groupIDs))
 	for _, groupID := range groupIDs {
+		if history, ok := s.history[groupID]; ok {
+			currentSeq[groupID] = history.lastSeq
+		} else {
+			currentSeq[groupID] = 0
+		}
+	}
+
+	frames := []protocol.Frame{
+		protocol.NewFrame(protocol.TypeSubscribed, protocol.SubscribedEvent{GroupIDs: groupIDs, Seq: currentSeq, Denied: denied}),
+	}
+
+	resuming := make([]string, 0, len(groupIDs))
+	for _, groupID := range groupIDs {
+		if since, ok := lastSeq[groupID]; ok && since > 0 {
+			resuming = append(resuming, groupID)
+		}
+	}
+
+	// A replay that doesn't fit in the send buffer is replaced with resync_required, keeping
+	// room for one frame for each group after it
+	room := cap(client.Send) - len(client.Send) - len(frames)
+	for i, groupID := range resuming {
+		since := lastSeq[groupID]
+		history, exists := s.history[groupID]
+		if !exists {
+			// Nothing buffered on this instance (e.g. after a restart or eviction): the client can't be sure it saw everything
+			frames = append(frames, resyncRequiredFrame(groupID, since, 0))
+			room--
+			continue
+		}
+
+		missed, ok := history.since(since)
+		if !ok || len(missed) > room-(len(resuming)-i-1) {
+			frames = append(frames, resyncRequiredFrame(groupID, since, history.lastSeq))
+			room--
+			continue
+		}
+		frames = append(frames, missed...)
+		room -= len(missed)
+	}
+
+	// Non-blocking sends: the hub lock is held. If the buffer fills anyway (other frames were
+	// queued meanwhile), the client is dropped so it reconnects and resumes rather than
+	// silently missing events.
+	for _, frame := range frames {
+		select {
+		case client.Send <- frame:
+		default:
+			log.Printf("Client %s send buffer full during subscription replay, closing connection", client.ID)
+			s.removeClientLocked(client)
+			joined = nil
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// addSubscriptionsLocked subscribes a client to groups and returns those it wasn't already
+// subscribed to. Caller must hold s.mu and client.mu.
+func (s *WebSocketService) addSubscriptionsLocked(client *Client, groupIDs []string) []string {
+	var joined []string
+	for _, groupID := range groupIDs {
+		if !client.Subscriptions[groupID] {
+			joined = append(joined, groupID)
+		}
 		if _, exists := s.groups[groupID]; !exists {
 			s.groups[groupID] = make(map[string]bool)
 		}
-		s.groups[groupID][clientID] = true
+		s.groups[groupID][client.ID] = true
 		client.Subscriptions[groupID] = true
 	}
-	client.mu.Unlock()
+	return joined
+}
 
-	return nil
+// authorizeSubscriptions splits the requested groups into those the device may subscribe to
+// and those the access policy denies, keyed by the denial reason
+func (s *WebSocketService) authorizeSubscriptions(ctx context.Context, deviceID string, groupIDs []string) ([]string, map[string]protocol.ErrorCode, error) {
+	if s.accessPolicy == nil {
+		return groupIDs, nil, nil
+	}
+
+	allowed := make([]string, 0, len(groupIDs))
+	var denied map[string]protocol.ErrorCode
+	for _, groupID := range groupIDs {
+		err := s.accessPolicy.CanSubscribe(ctx, deviceID, groupID)
+		if err == nil {
+			allowed = append(allowed, groupID)
+			continue
+		}
+		accessErr, ok := AsAccessError(err)
+		if !ok {
+			return nil, nil, err
+		}
+		if denied == nil {
+			denied = make(map[string]protocol.ErrorCode)
+		}
+		denied[groupID] = protocol.ErrorCode(accessErr.Code)
+	}
+	return allowed, denied, nil
+}
+
+// resyncRequiredFrame tells a client that missed events for a group can't be replayed
+func resyncRequiredFrame(groupID string, lastSeq int64, currentSeq int64) protocol.Frame {
+	return protocol.NewFrame(protocol.TypeResyncRequired, protocol.ResyncRequiredEvent{
+		GroupID:    groupID,
+		LastSeq:    lastSeq,
+		CurrentSeq: currentSeq,
+	})
 }
 
 // UnsubscribeClient unsubscribes a client from groups
 func (s *WebSocketService) UnsubscribeClient(clientID string, groupIDs []string) error {
+	// Deferred before the unlock below so presence is announced once the hub lock is released
+	var deviceID string
+	var left []string
+	defer func() { s.announcePresence(protocol.TypePresenceLeave, deviceID, clientID, left) }()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -219,9 +490,13 @@ func (s *WebSocketService) UnsubscribeClient(clientID string, groupIDs []string)
 	if !ok {
 		return fmt.Errorf("client not found: %s", clientID)
 	}
+	deviceID = client.DeviceID
 
 	client.mu.Lock()
 	for _, groupID := range groupIDs {
+		if !client.Subscriptions[groupID] {
+			continue
+		}
 		if clients, ok := s.groups[groupID]; ok {
 			delete(clients, clientID)
 			if len(clients) == 0 {
@@ -229,397 +504,565 @@ func (s *WebSocketService) UnsubscribeClient(clientID string, groupIDs []string)
 			}
 		}
 		delete(client.Subscriptions, groupID)
+		left = append(left, groupID)
 	}
 	client.mu.Unlock()
 
 	return nil
 }
 
-// HandleClientMessage processes incoming messages from a client
-func (s *WebSocketService) HandleClientMessage(ctx context.Context, client *Client, msg WebSocketMessage) error {
+// HandleClientMessage processes incoming messages from a client.
+// Returned errors are *protocol.Error values (or wrapped internal errors) that the caller
+// reports back to the client as an error frame.
+func (s *WebSocketService) HandleClientMessage(ctx context.Context, client *Client, msg protocol.Frame) error {
 	switch msg.Type {
-	case "subscribe":
-		var payload struct {
-			GroupIDs []string `json:"groupIds"`
-		}
-		if p, ok := msg.Payload.(map[string]interface{}); ok {
-			if ids, ok := p["groupIds"].([]interface{}); ok {
-				groupIDs := make([]string, 0, len(ids))
-				for _, id := range ids {
-					if str, ok := id.(string); ok {
-						groupIDs = append(groupIDs, str)
-					}
-				}
-				payload.GroupIDs = groupIDs
-			}
-		} else {
-			// Try to unmarshal from JSON
-			payloadBytes, _ := json.Marshal(msg.Payload)
-			json.Unmarshal(payloadBytes, &payload)
+	case protocol.TypeSubscribe:
+		var req protocol.SubscribeRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
 		}
 
-		if err := s.SubscribeClient(client.ID, payload.GroupIDs); err != nil {
+		// Subscribes, confirms and replays missed events atomically with respect to new broadcasts
+		if err := s.ResumeSubscription(ctx, client, req.GroupIDs, req.LastSeq); err != nil {
 			return fmt.Errorf("failed to subscribe: %w", err)
 		}
 
-		// Send confirmation
-		response := WebSocketMessage{
-			Type:      "subscribed",
-			Payload:   map[string]interface{}{"groupIds": payload.GroupIDs},
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
-		}
-		select {
-		case client.Send <- response:
-		case <-time.After(5 * time.Second):
-			log.Printf("Timeout sending subscription confirmation to client %s", client.ID)
-		}
-
-	case "unsubscribe":
-		var payload struct {
-			GroupIDs []string `json:"groupIds"`
-		}
-		if p, ok := msg.Payload.(map[string]interface{}); ok {
-			if ids, ok := p["groupIds"].([]interface{}); ok {
-				groupIDs := make([]string, 0, len(ids))
-				for _, id := range ids {
-					if str, ok := id.(string); ok {
-						groupIDs = append(groupIDs, str)
-					}
-				}
-				payload.GroupIDs = groupIDs
-			}
-		} else {
-			payloadBytes, _ := json.Marshal(msg.Payload)
-			json.Unmarshal(payloadBytes, &payload)
+	case protocol.TypeUnsubscribe:
+		var req protocol.UnsubscribeRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
 		}
 
-		if err := s.UnsubscribeClient(client.ID, payload.GroupIDs); err != nil {
+		if err := s.UnsubscribeClient(client.ID, req.GroupIDs); err != nil {
 			return fmt.Errorf("failed to unsubscribe: %w", err)
 		}
 
-		// Send confirmation
-		response := WebSocketMessage{
-			Type:      "unsubscribed",
-			Payload:   map[string]interface{}{"groupIds": payload.GroupIDs},
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
-		}
-		select {
-		case client.Send <- response:
-		case <-time.After(5 * time.Second):
-			log.Printf("Timeout sending unsubscription confirmation to client %s", client.ID)
-		}
+		s.sendToClient(client, protocol.NewFrame(protocol.TypeUnsubscribed, protocol.UnsubscribedEvent{GroupIDs: req.GroupIDs}))
 
-	case "send_message":
-		var payload struct {
-			GroupID        string   `json:"groupId"`
-			Content        string   `json:"content"`
-			MessageType    string   `json:"messageType"`
-			SOSType        *string  `json:"sosType,omitempty"`
-			Tags           []string `json:"tags,omitempty"`
-			DeviceSequence *int     `json:"deviceSequence,omitempty"`
+	case protocol.TypeSendMessage:
+		var req protocol.SendMessageRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
 		}
 
-		// Parse payload
-		if p, ok := msg.Payload.(map[string]interface{}); ok {
-			if gid, ok := p["groupId"].(string); ok {
-				payload.GroupID = gid
-			}
-			if content, ok := p["content"].(string); ok {
-				payload.Content = content
-			}
-			if mt, ok := p["messageType"].(string); ok {
-				payload.MessageType = mt
-			}
-			if st, ok := p["sosType"].(string); ok {
-				payload.SOSType = &st
+		if s.accessPolicy != nil {
+			if err := s.accessPolicy.CanPost(ctx, client.DeviceID, req.GroupID); err != nil {
+				return accessProtocolError(err)
 			}
-			if tags, ok := p["tags"].([]interface{}); ok {
-				payload.Tags = make([]string, 0, len(tags))
-				for _, tag := range tags {
-					if str, ok := tag.(string); ok {
-						payload.Tags = append(payload.Tags, str)
-					}
-				}
-			}
-			if ds, ok := p["deviceSequence"].(float64); ok {
-				seq := int(ds)
-				payload.DeviceSequence = &seq
-			}
-		} else {
-			payloadBytes, _ := json.Marshal(msg.Payload)
-			json.Unmarshal(payloadBytes, &payload)
 		}
 
-		// Create message using message service
 		msgType := domain.MessageTypeText
-		if payload.MessageType == "sos" {
-			msgType = domain.MessageTypeSOS
+		if req.MessageType != "" {
+			msgType = domain.MessageType(req.MessageType)
 		}
 
 		var sosType *domain.SOSType
-		if payload.SOSType != nil {
-			st := domain.SOSType(*payload.SOSType)
+		if req.SOSType != nil {
+			st := domain.SOSType(*req.SOSType)
 			sosType = &st
 		}
 
 		createReq := CreateMessageRequest{
-			GroupID:        payload.GroupID,
+			GroupID:        req.GroupID,
 			DeviceID:       client.DeviceID,
-			Content:        payload.Content,
+			Content:        req.Content,
 			MessageType:    msgType,
 			SOSType:        sosType,
-			Tags:           payload.Tags,
-			DeviceSequence: payload.DeviceSequence,
+			Tags:           req.Tags,
+			DeviceSequence: req.DeviceSequence,
+			ReplyToID:      req.ReplyToID,
+			AttachmentIDs:  req.AttachmentIDs,
+			Latitude:       req.Latitude,
+			Longitude:      req.Longitude,
+			Accuracy:       req.Accuracy,
 		}
 
 		message, err := s.messageService.CreateMessage(ctx, createReq)
 		if err != nil {
-			errorMsg := WebSocketMessage{
-				Type:      "message_error",
-				Payload:   map[string]string{"error": err.Error()},
-				Timestamp: time.Now().UTC().Format(time.RFC3339),
-			}
-			select {
-			case client.Send <- errorMsg:
-			case <-time.After(5 * time.Second):
+			if _, ok := AsRateLimitError(err); ok {
+				return rateLimitProtocolError(err)
 			}
-			return err
+			return protocol.NewError(protocol.CodeValidationFailed, "%v", err)
 		}
 
 		// Save message to database
 		if err := s.messageRepo.InsertMessages(ctx, []*domain.Message{message}); err != nil {
-			errorMsg := WebSocketMessage{
-				Type:      "message_error",
-				Payload:   map[string]string{"error": fmt.Sprintf("failed to save message: %v", err)},
-				Timestamp: time.Now().UTC().Format(time.RFC3339),
-			}
-			select {
-			case client.Send <- errorMsg:
-			case <-time.After(5 * time.Second):
+			if errors.Is(err, database.ErrAttachmentsUnavailable) {
+				return protocol.NewError(protocol.CodeValidationFailed, "%v", err)
 			}
 			return fmt.Errorf("failed to save message: %w", err)
 		}
 
-		// Validate GroupID before broadcasting
-		if payload.GroupID == "" {
-			errorMsg := WebSocketMessage{
-				Type:      "message_error",
-				Payload:   map[string]string{"error": "groupId is required"},
-				Timestamp: time.Now().UTC().Format(time.RFC3339),
-			}
-			select {
-			case client.Send <- errorMsg:
-			case <-time.After(5 * time.Second):
-			}
-			return fmt.Errorf("groupId is required")
-		}
-
-		// Convert to WebSocket message format
-		newMsg := WebSocketMessage{
-			Type: "new_message",
-			Payload: map[string]interface{}{
-				"id":             message.ID,
-				"groupId":        message.GroupID,
-				"deviceId":       message.DeviceID,
-				"content":        message.Content,
-				"messageType":    string(message.MessageType),
-				"sosType":        message.SOSType,
-				"tags":           message.Tags,
-				"pinned":         message.Pinned,
-				"createdAt":      message.CreatedAt.Format(time.RFC3339),
-				"deviceSequence": message.DeviceSequence,
-			},
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
-		}
-
 		// Broadcast to all subscribers of the group
-		// Use message.GroupID (from DB) instead of payload.GroupID to ensure consistency
-		s.BroadcastToGroup(message.GroupID, newMsg)
+		s.BroadcastToGroup(message.GroupID, NewMessageFrame(message))
 
 		// Send confirmation to sender
-		confirmMsg := WebSocketMessage{
-			Type:      "message_sent",
-			Payload:   map[string]string{"messageId": message.ID},
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
-		}
-		select {
-		case client.Send <- confirmMsg:
-		case <-time.After(5 * time.Second):
+		s.sendToClient(client, protocol.NewFrame(protocol.TypeMessageSent, protocol.MessageSentEvent{MessageID: message.ID}))
+
+	case protocol.TypeTypingStart:
+		var req protocol.TypingRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
 		}
 
-	case "ping":
-		// Respond with pong
-		response := WebSocketMessage{
-			Type:      "pong",
-			Payload:   map[string]string{},
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		if err := s.StartTyping(client, req.GroupID); err != nil {
+			return err
 		}
-		select {
-		case client.Send <- response:
-		case <-time.After(5 * time.Second):
+
+	case protocol.TypeTypingStop:
+		var req protocol.TypingRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
 		}
 
-	case "pin_message":
-		var payload struct {
-			MessageID string  `json:"messageId"`
-			GroupID   string  `json:"groupId"`
-			Tag       *string `json:"tag,omitempty"`
-			PinnedAt  string  `json:"pinnedAt,omitempty"`
+		s.StopTyping(req.GroupID, client.DeviceID)
+
+	case protocol.TypeShareLocation:
+		var req protocol.ShareLocationRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
 		}
 
-		// Parse payload
-		if p, ok := msg.Payload.(map[string]interface{}); ok {
-			if mid, ok := p["messageId"].(string); ok {
-				payload.MessageID = mid
-			}
-			if gid, ok := p["groupId"].(string); ok {
-				payload.GroupID = gid
+		if req.Stop {
+			ended, err := s.locationService.StopSharing(ctx, client.DeviceID, req.GroupID)
+			if err != nil {
+				return err
 			}
-			if tagVal, ok := p["tag"]; ok {
-				if tagStr, ok := tagVal.(string); ok {
-					payload.Tag = &tagStr
-				} else if tagVal == nil {
-					payload.Tag = nil
-				}
+			if ended {
+				s.LocationShareEnded(req.GroupID, client.DeviceID)
 			}
-			if pat, ok := p["pinnedAt"].(string); ok {
-				payload.PinnedAt = pat
-			}
-		} else {
-			payloadBytes, _ := json.Marshal(msg.Payload)
-			json.Unmarshal(payloadBytes, &payload)
+			return nil
 		}
 
-		if payload.MessageID == "" {
-			errorMsg := WebSocketMessage{
-				Type:      "error",
-				Payload:   map[string]string{"error": "messageId is required"},
-				Timestamp: time.Now().UTC().Format(time.RFC3339),
+		share, err := s.locationService.ShareLocation(ctx, ShareLocationRequest{
+			GroupID:   req.GroupID,
+			DeviceID:  client.DeviceID,
+			Latitude:  *req.Latitude,
+			Longitude: *req.Longitude,
+			Accuracy:  req.Accuracy,
+			Duration:  time.Duration(req.DurationSeconds) * time.Second,
+			MessageID: req.MessageID,
+		})
+		if err != nil {
+			if _, ok := AsAccessError(err); ok {
+				return accessProtocolError(err)
 			}
-			select {
-			case client.Send <- errorMsg:
-			case <-time.After(5 * time.Second):
+			if _, ok := AsRateLimitError(err); ok {
+				return rateLimitProtocolError(err)
 			}
-			return fmt.Errorf("messageId is required")
+			if strings.Contains(err.Error(), "not found") {
+				return protocol.NewError(protocol.CodeNotFound, "%v", err)
+			}
+			return protocol.NewError(protocol.CodeValidationFailed, "%v", err)
+		}
+
+		// Live positions are streamed, not stored in the group's event history
+		s.BroadcastEphemeral(share.GroupID, LocationSharedFrame(share))
+
+	case protocol.TypePing:
+		var req protocol.PingRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
+		}
+
+		s.sendToClient(client, protocol.NewFrame(protocol.TypePong, protocol.PongEvent{}))
+
+	case protocol.TypePinMessage:
+		var req protocol.PinMessageRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
 		}
 
 		// Pin message using pin service
-		pin, err := s.pinService.PinMessage(ctx, client.DeviceID, payload.MessageID, payload.Tag)
+		pin, err := s.pinService.PinMessage(ctx, client.DeviceID, req.MessageID, req.Tag)
 		if err != nil {
-			errorMsg := WebSocketMessage{
-				Type:      "error",
-				Payload:   map[string]string{"error": err.Error()},
-				Timestamp: time.Now().UTC().Format(time.RFC3339),
+			if _, ok := AsAccessError(err); ok {
+				return accessProtocolError(err)
 			}
-			select {
-			case client.Send <- errorMsg:
-			case <-time.After(5 * time.Second):
+			if _, ok := AsRateLimitError(err); ok {
+				return rateLimitProtocolError(err)
+			}
+			if strings.Contains(err.Error(), "not found") {
+				return protocol.NewError(protocol.CodeNotFound, "%v", err)
 			}
 			return fmt.Errorf("failed to pin message: %w", err)
 		}
 
-		// Get group ID from pin (it's set by PinMessage)
-		groupID := pin.GroupID
-
 		// Broadcast message_pinned event to all subscribers of the group
-		pinnedMsg := WebSocketMessage{
-			Type: "message_pinned",
-			Payload: map[string]interface{}{
-				"messageId": pin.MessageID,
-				"groupId":   groupID,
-				"deviceId":  pin.DeviceID,
-				"pinnedAt":  pin.PinnedAt.Format(time.RFC3339),
-				"tag":       pin.Tag,
-			},
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
-		}
-		s.BroadcastToGroup(groupID, pinnedMsg)
-
-	case "unpin_message":
-		var payload struct {
-			MessageID string `json:"messageId"`
-		}
-
-		// Parse payload
-		if p, ok := msg.Payload.(map[string]interface{}); ok {
-			if mid, ok := p["messageId"].(string); ok {
-				payload.MessageID = mid
+		s.BroadcastToGroup(pin.GroupID, protocol.NewFrame(protocol.TypeMessagePinned, protocol.MessagePinnedEvent{
+			MessageID: pin.MessageID,
+			GroupID:   pin.GroupID,
+			DeviceID:  pin.DeviceID,
+			PinnedAt:  pin.PinnedAt.Format(time.RFC3339),
+			Tag:       pin.Tag,
+		}))
+
+	case protocol.TypeUnpinMessage:
+		var req protocol.UnpinMessageRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
+		}
+
+		// Get message to find group ID before unpinning
+		message, err := s.messageRepo.GetByID(ctx, req.MessageID)
+		if err != nil || message == nil {
+			return protocol.NewError(protocol.CodeNotFound, "message not found")
+		}
+
+		// Unpin message using pin service
+		if err := s.pinService.UnpinMessage(ctx, client.DeviceID, req.MessageID); err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				return protocol.NewError(protocol.CodeNotFound, "%v", err)
 			}
+			return fmt.Errorf("failed to unpin message: %w", err)
+		}
+
+		// Broadcast message_unpinned event to all subscribers of the group
+		s.BroadcastToGroup(message.GroupID, protocol.NewFrame(protocol.TypeMessageUnpinned, protocol.MessageUnpinnedEvent{
+			MessageID: req.MessageID,
+			GroupID:   message.GroupID,
+			DeviceID:  client.DeviceID,
+		}))
+
+	case protocol.TypeEditMessage:
+		var req protocol.EditMessageRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
+		}
+
+		message, err := s.messageService.EditMessage(ctx, client.DeviceID, req.MessageID, req.Content)
+		if err != nil {
+			return messageChangeProtocolError(err)
+		}
+
+		s.BroadcastToGroup(message.GroupID, MessageEditedFrame(message))
+
+	case protocol.TypeDeleteMessage:
+		var req protocol.DeleteMessageRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
+		}
+
+		message, err := s.messageService.DeleteMessage(ctx, client.DeviceID, req.MessageID)
+		if err != nil {
+			return messageChangeProtocolError(err)
+		}
+
+		s.BroadcastToGroup(message.GroupID, MessageDeletedFrame(message))
+
+	case protocol.TypeAddReaction, protocol.TypeRemoveReaction:
+		var req protocol.ReactionRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
+		}
+
+		kind := domain.ReactionKind(req.Kind)
+		var change *ReactionChange
+		var err error
+		if msg.Type == protocol.TypeAddReaction {
+			change, err = s.reactionService.AddReaction(ctx, client.DeviceID, req.MessageID, kind)
 		} else {
-			payloadBytes, _ := json.Marshal(msg.Payload)
-			json.Unmarshal(payloadBytes, &payload)
+			change, err = s.reactionService.RemoveReaction(ctx, client.DeviceID, req.MessageID, kind)
+		}
+		if err != nil {
+			return reactionProtocolError(err)
 		}
 
-		if payload.MessageID == "" {
-			errorMsg := WebSocketMessage{
-				Type:      "error",
-				Payload:   map[string]string{"error": "messageId is required"},
-				Timestamp: time.Now().UTC().Format(time.RFC3339),
-			}
-			select {
-			case client.Send <- errorMsg:
-			case <-time.After(5 * time.Second):
-			}
-			return fmt.Errorf("messageId is required")
+		if change.Changed {
+			s.BroadcastToGroup(change.Reaction.GroupID, ReactionFrame(msg.Type == protocol.TypeAddReaction, change))
+		}
+		if change.Incident != nil {
+			s.BroadcastToGroup(change.Incident.GroupID, SOSIncidentFrame(change.Incident, client.DeviceID))
 		}
 
-		// Get message to find group ID before unpinning
-		message, err := s.messageRepo.GetByID(ctx, payload.MessageID)
+	case protocol.TypeUpdateSOS:
+		var req protocol.UpdateSOSRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
+		}
+
+		change, err := s.sosService.Transition(ctx, client.DeviceID, req.IncidentID, domain.SOSState(req.State))
 		if err != nil {
-			errorMsg := WebSocketMessage{
-				Type:      "error",
-				Payload:   map[string]string{"error": fmt.Sprintf("failed to get message: %v", err)},
-				Timestamp: time.Now().UTC().Format(time.RFC3339),
-			}
-			select {
-			case client.Send <- errorMsg:
-			case <-time.After(5 * time.Second):
-			}
-			return fmt.Errorf("failed to get message: %w", err)
+			return sosProtocolError(err)
 		}
-		if message == nil {
-			errorMsg := WebSocketMessage{
-				Type:      "error",
-				Payload:   map[string]string{"error": "message not found"},
-				Timestamp: time.Now().UTC().Format(time.RFC3339),
-			}
-			select {
-			case client.Send <- errorMsg:
-			case <-time.After(5 * time.Second):
-			}
-			return fmt.Errorf("message not found")
+		if change.Changed {
+			s.BroadcastToGroup(change.Incident.GroupID, SOSIncidentFrame(change.Incident, client.DeviceID))
+		} else {
+			s.sendToClient(client, SOSIncidentFrame(change.Incident, client.DeviceID))
 		}
-		groupID := message.GroupID
 
-		// Unpin message using pin service
-		if err := s.pinService.UnpinMessage(ctx, client.DeviceID, payload.MessageID); err != nil {
-			errorMsg := WebSocketMessage{
-				Type:      "error",
-				Payload:   map[string]string{"error": err.Error()},
-				Timestamp: time.Now().UTC().Format(time.RFC3339),
+	case protocol.TypeClaimSOS, protocol.TypeReleaseSOS:
+		var req protocol.SOSResponderRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
+		}
+
+		var change *SOSChange
+		var err error
+		if msg.Type == protocol.TypeClaimSOS {
+			change, err = s.sosService.Claim(ctx, client.DeviceID, req.IncidentID)
+		} else {
+			change, err = s.sosService.Release(ctx, client.DeviceID, req.IncidentID)
+		}
+		if err != nil {
+			return sosProtocolError(err)
+		}
+		if change.Changed {
+			s.BroadcastToGroup(change.Incident.GroupID, SOSIncidentFrame(change.Incident, client.DeviceID))
+		} else {
+			s.sendToClient(client, SOSIncidentFrame(change.Incident, client.DeviceID))
+		}
+
+	case protocol.TypeMarkRead:
+		var req protocol.MarkReadRequest
+		if err := protocol.DecodePayload(msg, &req); err != nil {
+			return err
+		}
+
+		marker, moved, err := s.markerService.MarkRead(ctx, client.DeviceID, req.GroupID, req.MessageID)
+		if err != nil {
+			if _, ok := AsAccessError(err); ok {
+				return accessProtocolError(err)
 			}
-			select {
-			case client.Send <- errorMsg:
-			case <-time.After(5 * time.Second):
+			if errors.Is(err, ErrMessageNotInGroup) {
+				return protocol.NewError(protocol.CodeValidationFailed, "%v", err)
 			}
-			return fmt.Errorf("failed to unpin message: %w", err)
+			if strings.Contains(err.Error(), "not found") {
+				return protocol.NewError(protocol.CodeNotFound, "%v", err)
+			}
+			return err
 		}
 
-		// Broadcast message_unpinned event to all subscribers of the group
-		unpinnedMsg := WebSocketMessage{
-			Type: "message_unpinned",
-			Payload: map[string]interface{}{
-				"messageId": payload.MessageID,
-				"groupId":   groupID,
-				"deviceId":  client.DeviceID,
-			},
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
+		if moved {
+			s.SendToDevice(client.DeviceID, ReadMarkerFrame(marker))
+		} else {
+			s.sendToClient(client, ReadMarkerFrame(marker))
 		}
-		s.BroadcastToGroup(groupID, unpinnedMsg)
 
 	default:
-		return fmt.Errorf("unknown message type: %s", msg.Type)
+		return protocol.NewError(protocol.CodeUnknownType, "unknown message type: %s", msg.Type)
 	}
 
 	return nil
 }
+
+// accessProtocolError reports an access policy denial under its own protocol error code.
+// Other errors (failed lookups) are wrapped as internal errors.
+func accessProtocolError(err error) error {
+	if accessErr, ok := AsAccessError(err); ok {
+		return protocol.NewError(protocol.ErrorCode(accessErr.Code), "%v", accessErr)
+	}
+	return fmt.Errorf("failed to check group access: %w", err)
+}
+
+// rateLimitProtocolError reports a rate limit denial with when the request may be retried
+func rateLimitProtocolError(err error) error {
+	rateErr, ok := AsRateLimitError(err)
+	if !ok {
+		return err
+	}
+	protoErr := protocol.NewError(protocol.CodeRateLimited, "%v", rateErr)
+	protoErr.RetryAfter = rateErr.RetryAfterSeconds()
+	return protoErr
+}
+
+// messageChangeProtocolError maps a failed edit or deletion to the protocol error reported to the author
+func messageChangeProtocolError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotMessageAuthor), errors.Is(err, ErrEditWindowExpired):
+		return protocol.NewError(protocol.CodeForbidden, "%v", err)
+	case strings.Contains(err.Error(), "not found"):
+		return protocol.NewError(protocol.CodeNotFound, "message not found")
+	}
+	if _, ok := AsAccessError(err); ok {
+		return accessProtocolError(err)
+	}
+	if strings.Contains(err.Error(), "validation failed") {
+		return protocol.NewError(protocol.CodeValidationFailed, "%v", err)
+	}
+	return err
+}
+
+// reactionProtocolError maps a failed reaction change to the protocol error reported to the device
+func reactionProtocolError(err error) error {
+	switch {
+	case errors.Is(err, domain.ErrInvalidReactionKind), errors.Is(err, domain.ErrReactionNotSOS):
+		return protocol.NewError(protocol.CodeValidationFailed, "%v", err)
+	case strings.Contains(err.Error(), "not found"):
+		return protocol.NewError(protocol.CodeNotFound, "%v", err)
+	}
+	if _, ok := AsAccessError(err); ok {
+		return accessProtocolError(err)
+	}
+	return err
+}
+
+// sosProtocolError maps a failed SOS incident change to the protocol error reported to the device
+func sosProtocolError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotSOSResolver):
+		return protocol.NewError(protocol.CodeForbidden, "%v", err)
+	case errors.Is(err, domain.ErrInvalidSOSState), errors.Is(err, domain.ErrInvalidSOSTransition), errors.Is(err, domain.ErrSOSResolved):
+		return protocol.NewError(protocol.CodeValidationFailed, "%v", err)
+	case strings.Contains(err.Error(), "not found"):
+		return protocol.NewError(protocol.CodeNotFound, "%v", err)
+	}
+	if _, ok := AsAccessError(err); ok {
+		return accessProtocolError(err)
+	}
+	return err
+}
+
+// sendToClient queues a frame for a single client, giving up after a short timeout
+func (s *WebSocketService) sendToClient(client *Client, frame protocol.Frame) {
+	select {
+	case client.Send <- frame:
+	case <-time.After(5 * time.Second):
+		log.Printf("Timeout sending %s to client %s", frame.Type, client.ID)
+	}
+}
+
+// NewMessageFrame converts a stored message into a new_message event frame
+func NewMessageFrame(message *domain.Message) protocol.Frame {
+	var sosType *string
+	if message.SOSType != nil {
+		st := string(*message.SOSType)
+		sosType = &st
+	}
+
+	var replyTo *protocol.QuotedMessage
+	if message.ReplyTo != nil {
+		replyTo = &protocol.QuotedMessage{
+			ID:       message.ReplyTo.ID,
+			DeviceID: message.ReplyTo.DeviceID,
+			Snippet:  message.ReplyTo.Snippet,
+			Deleted:  message.ReplyTo.Deleted,
+		}
+	}
+
+	return protocol.NewFrame(protocol.TypeNewMessage, protocol.NewMessageEvent{
+		ID:             message.ID,
+		GroupID:        message.GroupID,
+		DeviceID:       message.DeviceID,
+		Content:        message.Content,
+		MessageType:    string(message.MessageType),
+		SOSType:        sosType,
+		Tags:           message.Tags,
+		Pinned:         message.Pinned,
+		CreatedAt:      message.CreatedAt.Format(time.RFC3339),
+		DeviceSequence: message.DeviceSequence,
+		ReplyToID:      message.ReplyToID,
+		ReplyTo:        replyTo,
+		AttachmentIDs:  message.AttachmentIDs,
+		Latitude:       message.Latitude,
+		Longitude:      message.Longitude,
+		Accuracy:       message.Accuracy,
+	})
+}
+
+// LocationSharedFrame converts a live location share into a location_shared event frame
+func LocationSharedFrame(share *domain.LocationShare) protocol.Frame {
+	return protocol.NewFrame(protocol.TypeLocationShared, protocol.LocationEvent{
+		GroupID:   share.GroupID,
+		DeviceID:  share.DeviceID,
+		MessageID: share.MessageID,
+		Latitude:  &share.Latitude,
+		Longitude: &share.Longitude,
+		Accuracy:  share.Accuracy,
+		UpdatedAt: share.UpdatedAt.Format(time.RFC3339),
+		ExpiresAt: share.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// LocationShareEnded broadcasts location_share_ended for a device's share in a group that was
+// stopped or expired
+func (s *WebSocketService) LocationShareEnded(groupID, deviceID string) {
+	s.BroadcastEphemeral(groupID, protocol.NewFrame(protocol.TypeLocationEnded, protocol.LocationEvent{
+		GroupID:  groupID,
+		DeviceID: deviceID,
+	}))
+}
+
+// MessageEditedFrame converts an edited message into a message_edited event frame
+func MessageEditedFrame(message *domain.Message) protocol.Frame {
+	editedAt := message.CreatedAt
+	if message.EditedAt != nil {
+		editedAt = *message.EditedAt
+	}
+	return protocol.NewFrame(protocol.TypeMessageEdited, protocol.MessageEditedEvent{
+		MessageID: message.ID,
+		GroupID:   message.GroupID,
+		DeviceID:  message.DeviceID,
+		Content:   message.Content,
+		EditedAt:  editedAt.Format(time.RFC3339),
+	})
+}
+
+// MessageDeletedFrame converts a deleted message into a message_deleted event frame
+func MessageDeletedFrame(message *domain.Message) protocol.Frame {
+	return protocol.NewFrame(protocol.TypeMessageDeleted, protocol.MessageDeletedEvent{
+		MessageID: message.ID,
+		GroupID:   message.GroupID,
+		DeviceID:  message.DeviceID,
+		DeletedAt: message.DeletedAt.Format(time.RFC3339),
+	})
+}
+
+// SOSIncidentFrame converts an SOS incident changed by a device into an sos_updated event frame
+func SOSIncidentFrame(incident *domain.SOSIncident, updatedBy string) protocol.Frame {
+	responders := make([]protocol.SOSResponder, 0, len(incident.Responders))
+	for _, responder := range incident.Responders {
+		responders = append(responders, protocol.SOSResponder{
+			DeviceID:  responder.DeviceID,
+			ClaimedAt: responder.ClaimedAt.Format(time.RFC3339),
+		})
+	}
+	event := protocol.SOSIncidentEvent{
+		IncidentID: incident.ID,
+		GroupID:    incident.GroupID,
+		DeviceID:   incident.DeviceID,
+		State:      string(incident.State),
+		Responders: responders,
+		UpdatedBy:  updatedBy,
+		UpdatedAt:  incident.UpdatedAt.Format(time.RFC3339),
+		ResolvedBy: incident.ResolvedBy,
+	}
+	if incident.AcknowledgedAt != nil {
+		event.AcknowledgedAt = incident.AcknowledgedAt.Format(time.RFC3339)
+	}
+	if incident.ResolvedAt != nil {
+		event.ResolvedAt = incident.ResolvedAt.Format(time.RFC3339)
+	}
+	if incident.EscalatedAt != nil {
+		event.EscalatedAt = incident.EscalatedAt.Format(time.RFC3339)
+	}
+	return protocol.NewFrame(protocol.TypeSOSUpdated, event)
+}
+
+// ReactionFrame converts a reaction change into a reaction_added (or, if not added, reaction_removed) event frame
+func ReactionFrame(added bool, change *ReactionChange) protocol.Frame {
+	frameType := protocol.TypeReactionRemoved
+	if added {
+		frameType = protocol.TypeReactionAdded
+	}
+	reaction := change.Reaction
+	return protocol.NewFrame(frameType, protocol.ReactionEvent{
+		ReactionID: reaction.ID,
+		MessageID:  reaction.MessageID,
+		GroupID:    reaction.GroupID,
+		DeviceID:   reaction.DeviceID,
+		Kind:       string(reaction.Kind),
+		Count:      change.Count,
+		UpdatedAt:  reaction.UpdatedAt.Format(time.RFC3339),
+	})
+}
+
+// ReadMarkerFrame converts a read marker into a read_marker event frame
+func ReadMarkerFrame(marker *domain.ReadMarker) protocol.Frame {
+	return protocol.NewFrame(protocol.TypeReadMarker, protocol.ReadMarkerEvent{
+		GroupID:           marker.GroupID,
+		LastReadMessageID: marker.LastReadMessageID,
+		LastReadAt:        marker.LastReadAt.Format(time.RFC3339Nano),
+		UpdatedAt:         marker.UpdatedAt.Format(time.RFC3339),
+	})
+}
@@ -14,3 +14,19 @@ const (
 func GenerateID() (string, error) {
 	return gonanoid.New(IDLength)
 }
+
+// IsValidID reports whether id looks like an identifier produced by GenerateID:
+// IDLength characters from the default NanoID alphabet (A-Za-z0-9_-).
+func IsValidID(id string) bool {
+	if len(id) != IDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
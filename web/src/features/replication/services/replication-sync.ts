@@ -60,8 +60,10 @@ type PullDocumentsResponse = {
   documents: Document[];
   deletions?: DeletionSignal[]; // NEW: Deletion signals
   checkpoint: string; // Legacy field for backward compatibility
-  checkpoints?: Record<string, string>; // Per-collection checkpoints: collection -> ISO timestamp
+  checkpoints?: Record<string, string>; // Per-collection checkpoints: collection -> opaque cursor
+  deletion_checkpoints?: Record<string, string>; // Per-collection deletion cursors, sent back as deletion_checkpoint
   has_more: boolean;
+  resync?: string[]; // Collections to discard locally and re-pull from scratch (tombstones were purged)
 };
 
 /**
@@ -71,6 +73,13 @@ function getCheckpointKey(collection: string): string {
   return `nearby_msg_replication_checkpoint_${collection}`;
 }
 
+/**
+ * Gets the key a collection's deletion cursor is stored under; deletions page separately from documents
+ */
+function getDeletionCheckpointName(collection: string): string {
+  return `${collection}_deletions`;
+}
+
 /**
  * Gets checkpoint for a specific collection
  */
@@ -112,7 +121,7 @@ function getCheckpointForCollections(
  * Each collection's checkpoint is updated independently based on its own latest document timestamp.
  * This eliminates the bug where all collections shared the same checkpoint, which could cause
  * data inconsistency (e.g., if only messages updated, groups checkpoint would incorrectly update).
- * @param checkpoints - Map of collection names to ISO timestamp strings (e.g., { "messages": "2025-01-28T10:00:00Z", "groups": "2025-01-28T09:30:00Z" })
+ * @param checkpoints - Map of collection names to opaque cursor strings returned by the server
  */
 function updateCheckpointsForCollections(
   checkpoints: Record<string, string>
@@ -511,9 +520,17 @@ async function pullDocuments(
   // No need to call migrateLegacyCheckpoint() here anymore
 
   const checkpoint = getCheckpointForCollections(collections);
+  const deletionCheckpoint: Record<string, string> = {};
+  for (const collection of collections) {
+    const cursor = getCheckpoint(getDeletionCheckpointName(collection));
+    if (cursor) {
+      deletionCheckpoint[collection] = cursor;
+    }
+  }
   const body: Record<string, unknown> = {
     collections,
     checkpoint: Object.keys(checkpoint).length > 0 ? checkpoint : undefined,
+    deletion_checkpoint: Object.keys(deletionCheckpoint).length > 0 ? deletionCheckpoint : undefined,
   };
 
   if (groupIds && groupIds.length > 0) {
@@ -536,6 +553,18 @@ async function pullDocuments(
 
   const db = await getDatabase();
 
+  // Collections we fell too far behind on: the server purged tombstones we never saw,
+  // so drop the local copy and rebuild it from this response onwards
+  if (response.resync && response.resync.length > 0) {
+    for (const collection of response.resync as ReplicationCollection[]) {
+      try {
+        await db[collection].find().remove();
+      } catch (error) {
+        log.error('Failed to clear collection for resync', error, { collection });
+      }
+    }
+  }
+
   // Document processor map - replaces switch case for cleaner, extensible code.
   // This pattern eliminates duplication and makes adding new collections trivial (just add to map).
   type DocumentProcessor = (
@@ -660,9 +689,11 @@ async function pullDocuments(
               await discardMutationsForEntity('user_status' as MutationCollection, entityId);
               break;
             }
-            case 'pinned_messages':
-              // Pinned messages don't have deletion sync yet (not in scope)
+            case 'pinned_messages': {
+              const pinDoc = await db.pinned_messages.findOne(entityId).exec();
+              if (pinDoc) await pinDoc.remove();
               break;
+            }
             default:
               log.warn('Unknown collection for deletion', { collection });
           }
@@ -695,6 +726,12 @@ async function pullDocuments(
     }
     updateCheckpointsForCollections(legacyCheckpoints);
   }
+
+  if (response.deletion_checkpoints) {
+    for (const [collection, cursor] of Object.entries(response.deletion_checkpoints)) {
+      setCheckpoint(getDeletionCheckpointName(collection), cursor);
+    }
+  }
 }
 
 async function syncCycle(): Promise<void> {
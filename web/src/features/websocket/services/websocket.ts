@@ -27,6 +27,30 @@ export type WebSocketMessageType =
   | "unpin_message"
   | "message_pinned"
   | "message_unpinned"
+  | "edit_message"
+  | "message_edited"
+  | "delete_message"
+  | "message_deleted"
+  | "add_reaction"
+  | "remove_reaction"
+  | "reaction_added"
+  | "reaction_removed"
+  | "mark_read"
+  | "read_marker"
+  | "typing_start"
+  | "typing_stop"
+  | "typing_started"
+  | "typing_stopped"
+  | "presence_join"
+  | "presence_leave"
+  | "share_location"
+  | "location_shared"
+  | "location_share_ended"
+  | "update_sos"
+  | "claim_sos"
+  | "release_sos"
+  | "sos_updated"
+  | "sos_escalated"
   | "subscribed"
   | "unsubscribed"
   | "ping"
@@ -43,6 +67,30 @@ export interface SendMessagePayload {
   sosType?: "medical" | "flood" | "fire" | "missing_person";
   tags?: string[];
   deviceSequence?: number;
+  latitude?: number;
+  longitude?: number;
+  accuracy?: number; // Meters
+}
+
+export interface ShareLocationPayload {
+  groupId: string;
+  latitude?: number; // Required unless stop is set
+  longitude?: number;
+  accuracy?: number; // Meters
+  durationSeconds?: number; // Restarts the share (default 15 minutes, max 1 hour)
+  messageId?: string; // SOS message the share follows up
+  stop?: boolean;
+}
+
+export interface LocationSharedPayload {
+  groupId: string;
+  deviceId: string;
+  messageId?: string;
+  latitude?: number; // Set on location_shared
+  longitude?: number;
+  accuracy?: number;
+  updatedAt?: string;
+  expiresAt?: string;
 }
 
 export interface NewMessagePayload {
@@ -70,6 +118,9 @@ export interface SubscribePayload {
 export interface ErrorPayload {
   error: string;
   code?: string;
+  requestType?: string;
+  requestId?: string;
+  retryAfter?: number; // Seconds until a rate_limited request may be retried
 }
 
 /**
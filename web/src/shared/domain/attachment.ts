@@ -0,0 +1,20 @@
+/**
+ * Attachment domain model
+ * A photo or voice note uploaded to a group and sent with a message
+ */
+
+export type AttachmentKind = 'image' | 'audio';
+
+export interface Attachment {
+  id: string; // NanoID (21 chars)
+  group_id: string; // NanoID (21 chars)
+  device_id: string; // NanoID (21 chars)
+  message_id?: string; // Set once a message is sent with the attachment
+  kind: AttachmentKind;
+  mime_type: string; // Sniffed by the server from the file content
+  size_bytes: number;
+  width?: number; // Image dimensions, when known
+  height?: number;
+  created_at: string; // ISO timestamp
+  updated_at: string; // ISO timestamp
+}
@@ -9,6 +9,34 @@ export type SOSType = 'medical' | 'flood' | 'fire' | 'missing_person';
 
 export type SyncStatus = 'pending' | 'syncing' | 'synced' | 'failed';
 
+/**
+ * Reaction kinds; 'ack' and 'responding' are only allowed on SOS messages
+ */
+export type ReactionKind = 'like' | 'love' | 'sad' | 'pray' | 'thanks' | 'ack' | 'responding';
+
+/**
+ * A device's reaction to a message (replicated as the 'reactions' collection)
+ */
+export interface MessageReaction {
+  id: string;
+  message_id: string;
+  group_id: string;
+  device_id: string;
+  kind: ReactionKind;
+  created_at: string; // ISO timestamp
+  updated_at: string; // ISO timestamp
+}
+
+/**
+ * Start of a replied-to message, embedded in its replies
+ */
+export interface MessageQuote {
+  id: string;
+  device_id: string;
+  snippet: string; // Empty once the parent is deleted
+  deleted: boolean;
+}
+
 export interface Message {
   id: string; // NanoID (21 chars)
   group_id: string; // NanoID (21 chars)
@@ -21,6 +49,16 @@ export interface Message {
   created_at: string; // ISO timestamp
   device_sequence?: number; // Device-local sequence number
   synced_at?: string; // ISO timestamp
+  edited_at?: string; // ISO timestamp, set once the author edits the message
+  updated_at?: string; // ISO timestamp of the last change to the message, its replies, reactions or quote
+  reply_to_id?: string; // Message this one replies to, in the same group
+  reply_to?: MessageQuote; // Quote of the message replied to
+  reply_count?: number; // Live replies to this message
+  reactions?: Partial<Record<ReactionKind, number>>; // Live reaction counts by kind
+  attachment_ids?: string[]; // Photos and voice notes, see Attachment
+  latitude?: number; // Where the message was sent from, e.g. for an SOS
+  longitude?: number;
+  accuracy?: number; // Meters
   sync_status?: SyncStatus; // Client-side sync status
 }
 
@@ -31,6 +69,10 @@ export interface MessageCreateRequest {
   sos_type?: SOSType; // Required if message_type is 'sos'
   tags?: string[];
   device_sequence?: number;
+  attachment_ids?: string[]; // Uploaded via POST /v1/attachments; content may then be empty
+  latitude?: number; // Latitude and longitude are given together
+  longitude?: number;
+  accuracy?: number; // Meters
 }
 
 /**
@@ -0,0 +1,21 @@
+/**
+ * Read Marker domain model
+ * Records how far a device has read in a group
+ */
+
+export interface ReadMarker {
+  id: string; // NanoID (21 chars)
+  device_id: string; // NanoID (21 chars)
+  group_id: string; // NanoID (21 chars)
+  last_read_message_id?: string; // Absent when the group was read up to a time
+  last_read_at: string; // ISO timestamp; messages at or before it are read
+  updated_at: string; // ISO timestamp
+}
+
+export interface UnreadCount {
+  group_id: string; // NanoID (21 chars)
+  unread: number;
+  unread_sos: number;
+  last_read_message_id?: string;
+  last_read_at?: string; // ISO timestamp; absent if the group was never marked read
+}
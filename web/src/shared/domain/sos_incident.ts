@@ -0,0 +1,28 @@
+/**
+ * SOS incident domain model
+ * Tracks an SOS message from open to resolved; shares the message's ID
+ */
+
+import type { SOSType } from './message';
+
+export type SOSState = 'open' | 'acknowledged' | 'in_progress' | 'resolved';
+
+export interface SOSResponder {
+  device_id: string; // NanoID (21 chars)
+  claimed_at: string; // ISO timestamp
+}
+
+export interface SOSIncident {
+  id: string; // The SOS message's ID
+  group_id: string; // NanoID (21 chars)
+  device_id: string; // Who raised the SOS
+  sos_type?: SOSType;
+  state: SOSState;
+  responders: SOSResponder[];
+  created_at: string; // ISO timestamp
+  updated_at: string; // ISO timestamp
+  acknowledged_at?: string; // ISO timestamp
+  resolved_at?: string; // ISO timestamp
+  resolved_by?: string; // Only the SOS author or the group creator can resolve
+  escalated_at?: string; // ISO timestamp, set once sent to nearby groups for being left open
+}
@@ -11,6 +11,9 @@ export const VALID_COLLECTIONS = [
   'favorite_groups',
   'pinned_messages',
   'user_status',
+  'reactions',
+  'read_markers',
+  'attachments',
 ] as const;
 
 export type Collection = (typeof VALID_COLLECTIONS)[number];